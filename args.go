@@ -3,10 +3,12 @@ package main
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/v4lproik/simple-blockchain-quickstart/commands"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
 	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 )
 
@@ -44,16 +46,22 @@ var opts struct {
 	LogFilePath          string `short:"l" long:"log_file_path" description:"Where application logs will be written. If this value is not specified, the logs will be displayed to the console" required:"false"`
 	Environment          string `short:"e" long:"environment" description:"Set the environment variable. Accepted values are [dev, prod]" required:"false" default:"dev"`
 	MinerAddress         string `short:"m" long:"miner_address" description:"Set miner address" required:"false"`
+	IdentityKeyFilePath  string `short:"i" long:"identity_key_file_path" description:"Node identity key file path, the key is generated if the file doesn't exist. If this value is not specified, the key is stored next to the nodes file" required:"false"`
+	StorageBackend       string `short:"s" long:"storage_backend" description:"Set how the transactions file is stored. Accepted values are [file, bolt]" required:"false" default:"file"`
+	VerifyChain          bool   `long:"verify_chain" description:"Verify every block of the transactions file when the node starts, the node doesn't start if a block is invalid" required:"false"`
 }
 
 func displayAppConfiguration() {
 	Logger.Infof("Environment: %s", opts.Environment)
 	Logger.Infof("Transactions file: %s", opts.TransactionsFilePath)
+	Logger.Infof("Storage backend: %s", opts.StorageBackend)
+	Logger.Infof("Verify chain at startup: %t", opts.VerifyChain)
 	Logger.Infof("Genesis file: %s", opts.GenesisFilePath)
 	Logger.Infof("Users file: %s", opts.UsersFilePath)
 	Logger.Infof("Nodes file: %s", opts.NodesFilePath)
 	Logger.Infof("Keystore dir: %s", opts.KeystoreDirPath)
 	Logger.Infof("This node miner address: %s", opts.MinerAddress)
+	Logger.Infof("Identity key file: %s", opts.IdentityKeyFilePath)
 	if opts.LogFilePath != "" {
 		Logger.Infof("Output in log file: %s", opts.LogFilePath)
 	} else {
@@ -68,6 +76,14 @@ func checkArgs() error {
 	if !env.isValid() {
 		return errors.New("checkArgs: environment " + opts.Environment + " is not accepted. Choose from [dev, prod]. Exiting")
 	}
+	// check storage backend
+	if opts.StorageBackend != models.FILE_STORAGE && opts.StorageBackend != models.BOLT_STORAGE {
+		return errors.New("checkArgs: storage backend " + opts.StorageBackend + " is not accepted. Choose from [file, bolt]. Exiting")
+	}
+	// the identity of the node is kept next to the nodes it knows about by default
+	if opts.IdentityKeyFilePath == "" {
+		opts.IdentityKeyFilePath = filepath.Join(filepath.Dir(opts.NodesFilePath), "node_identity.key")
+	}
 	// check miner address
 	_, err := models.NewAccount(opts.MinerAddress)
 	if err != nil {
@@ -78,33 +94,90 @@ func checkArgs() error {
 
 // general commands
 func addCommands(parser *flags.Parser) error {
-	err := addTransactionCommands(parser)
+	// the commands share the storage, a bolt database can only be opened once
+	storage, err := models.NewStorage(opts.StorageBackend, opts.TransactionsFilePath)
+	if err != nil {
+		return fmt.Errorf("addCommands: cannot open the storage %s", err)
+	}
+	// the consensus configuration is only loaded by the server, the genesis file tells which engine seals the chain
+	genesis, err := models.ReadGenesisFile(opts.GenesisFilePath)
+	if err != nil {
+		return fmt.Errorf("addCommands: cannot read the genesis file %s", err)
+	}
+	engine, err := models.NewEngineFromGenesis(genesis)
+	if err != nil {
+		return fmt.Errorf("addCommands: cannot create the consensus engine %s", err)
+	}
+
+	err = addTransactionCommands(parser, storage, engine)
 	if err != nil {
 		return fmt.Errorf("addCommands: cannot add transaction commands %s", err)
 	}
 
+	err = addChainCommands(parser, storage, engine)
+	if err != nil {
+		return fmt.Errorf("addCommands: cannot add chain commands %s", err)
+	}
+
 	err = addPasswordCommands(parser)
 	if err != nil {
 		return fmt.Errorf("addCommands: cannot add password commands %s", err)
 	}
 
+	err = addStorageCommands(parser)
+	if err != nil {
+		return fmt.Errorf("addCommands: cannot add storage commands %s", err)
+	}
+
 	return nil
 }
 
 // transaction
-func addTransactionCommands(parser *flags.Parser) error {
-	state, err := models.NewStateFromFile(opts.GenesisFilePath, opts.TransactionsFilePath)
+func addTransactionCommands(parser *flags.Parser, storage models.Storage, engine models.Engine) error {
+	// the chain is only replayed by the transaction commands, a chain which can't be replayed can still be verified
+	loadState := func() (models.State, error) {
+		state, err := models.NewStateFromStorage(opts.GenesisFilePath, storage, engine)
+		if err != nil {
+			return nil, fmt.Errorf("addTransactionCommands: %w", err)
+		}
+		return state, nil
+	}
+
+	keystoreService, err := services.NewEthKeystore(opts.KeystoreDirPath)
 	if err != nil {
 		return fmt.Errorf("addTransactionCommands: %w", err)
 	}
 
-	listT, _ := commands.NewListTransactionCommand(state)
+	listT, _ := commands.NewListTransactionCommand(loadState)
+	signT, _ := commands.NewSignTransactionCommand(loadState, keystoreService)
 	_, err = parser.AddCommand(
 		"transaction",
-		"transaction utility commands including: add, list",
+		"transaction utility commands including: list, sign",
 		"Utilities developed to ease the operations and debugging of transactions.",
 		&commands.TransactionCommands{
 			List: *listT,
+			Sign: *signT,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// chain
+func addChainCommands(parser *flags.Parser, storage models.Storage, engine models.Engine) error {
+	verifyC, err := commands.NewVerifyChainCommand(opts.GenesisFilePath, storage, engine)
+	if err != nil {
+		return fmt.Errorf("addChainCommands: %w", err)
+	}
+	_, err = parser.AddCommand(
+		"chain",
+		"chain utility commands including: verify",
+		"Utilities developed to ease the operations and debugging of the chain.",
+		&commands.ChainCommands{
+			Verify: *verifyC,
 		},
 	)
 	if err != nil {
@@ -131,3 +204,24 @@ func addPasswordCommands(parser *flags.Parser) error {
 
 	return nil
 }
+
+// storage
+func addStorageCommands(parser *flags.Parser) error {
+	migrateS, err := commands.NewMigrateStorageCommand(opts.GenesisFilePath)
+	if err != nil {
+		return fmt.Errorf("addStorageCommands: %w", err)
+	}
+	_, err = parser.AddCommand(
+		"storage",
+		"storage utility commands including: migrate",
+		"Utilities developed to ease the operations on the transactions database.",
+		&commands.StorageCommands{
+			Migrate: *migrateS,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+func init() {
+	test.InitTestContext()
+}
+
+func TestChainVerifyCommand(t *testing.T) {
+	// define variables
+	blocks, err := os.ReadFile("testdata/node1/blocks.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the value of the transaction of block 2 is tampered, the chain can't be replayed anymore
+	lines := strings.SplitN(string(blocks), "\n", 2)
+	tamperedBlocks := lines[0] + "\n" + strings.Replace(lines[1], `"value":900`, `"value":901`, 1)
+	dbFilePath := filepath.Join(t.TempDir(), "blocks.db")
+	if err = os.WriteFile(dbFilePath, []byte(tamperedBlocks), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.GenesisFilePath = "testdata/node1/genesis.json"
+	opts.TransactionsFilePath = dbFilePath
+	opts.KeystoreDirPath = "testdata/node1/keystore/"
+	opts.StorageBackend = models.FILE_STORAGE
+
+	// the commands are added without replaying the chain, chain verify reports the first invalid block
+	parser := flags.NewParser(&struct{}{}, flags.None)
+	if err = addCommands(parser); err != nil {
+		t.Fatalf("addCommands() error = %v", err)
+	}
+	_, err = parser.ParseArgs([]string{"chain", "verify"})
+
+	var rejectedBlockErr *models.RejectedBlockError
+	if !errors.As(err, &rejectedBlockErr) || !errors.Is(err, models.ErrBlockTxRoot) {
+		t.Fatalf("chain verify error = %v, want %v", err, models.ErrBlockTxRoot)
+	}
+	if rejectedBlockErr.Height != 2 {
+		t.Errorf("chain verify reported block at height %d, want %d", rejectedBlockErr.Height, 2)
+	}
+}
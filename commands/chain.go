@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+type ChainCommands struct {
+	Verify VerifyChainCommand `command:"verify" description:"Verify every block of the chain from the genesis"`
+}
+
+type VerifyChainCommand struct {
+	genesisFilePath string
+	storage         models.Storage
+	engine          models.Engine
+}
+
+func NewVerifyChainCommand(genesisFilePath string, storage models.Storage, engine models.Engine) (*VerifyChainCommand, error) {
+	if genesisFilePath == "" {
+		return nil, errors.New("NewVerifyChainCommand: genesis file path cannot be empty")
+	}
+	if storage == nil {
+		return nil, errors.New("NewVerifyChainCommand: storage cannot be nil")
+	}
+	if engine == nil {
+		return nil, errors.New("NewVerifyChainCommand: engine cannot be nil")
+	}
+	return &VerifyChainCommand{
+		genesisFilePath: genesisFilePath,
+		storage:         storage,
+		engine:          engine,
+	}, nil
+}
+
+func (c *VerifyChainCommand) Execute(_ []string) error {
+	state, err := models.NewVerifiedStateFromStorage(c.genesisFilePath, c.storage, c.engine)
+	if err != nil {
+		var rejectedBlockErr *models.RejectedBlockError
+		if errors.As(err, &rejectedBlockErr) {
+			Logger.Errorf("first invalid block: hash=%s height=%d reason=%s", rejectedBlockErr.Hash.Hex(), rejectedBlockErr.Height, rejectedBlockErr.Err)
+		}
+		return fmt.Errorf("Execute: the chain is invalid: %w", err)
+	}
+	Logger.Infof("chain verified: %d block(s), latest block hash=%s", state.GetLatestBlockHeight(), state.GetLatestBlockHash().Hex())
+	return nil
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+var ErrStorageNotEmpty = errors.New("destination storage already contains blocks")
+
+type StorageCommands struct {
+	Migrate MigrateStorageCommand `command:"migrate" description:"Import a json lines transactions file into a bolt database"`
+}
+
+type MigrateStorageCommand struct {
+	genesisFilePath string
+	From            string `short:"f" long:"from" description:"Json lines transactions file to import (eg. blocks.db)" required:"true"`
+	To              string `short:"t" long:"to" description:"Bolt database to create, it must not contain any block" required:"true"`
+}
+
+func NewMigrateStorageCommand(genesisFilePath string) (*MigrateStorageCommand, error) {
+	if genesisFilePath == "" {
+		return nil, errors.New("NewMigrateStorageCommand: genesis file path cannot be empty")
+	}
+	return &MigrateStorageCommand{
+		genesisFilePath: genesisFilePath,
+	}, nil
+}
+
+func (c *MigrateStorageCommand) Execute(_ []string) error {
+	// the balances are replayed from the blocks, the json lines file doesn't keep them
+	genesis, err := models.ReadGenesisFile(c.genesisFilePath)
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+	engine, err := models.NewEngineFromGenesis(genesis)
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+	// the transactions file is only read, the migration leaves it as it is
+	from, err := models.NewReadOnlyFileStorage(c.From)
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+	state, err := models.NewStateFromStorage(c.genesisFilePath, from, engine)
+	if err != nil {
+		_ = from.Close()
+		return fmt.Errorf("Execute: cannot read the transactions file: %w", err)
+	}
+	defer state.Close()
+
+	blocks := state.GetBlocksFromHeight(1, state.GetLatestBlockHeight())
+
+	to, err := models.NewBoltStorage(c.To)
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+	defer to.Close()
+
+	existingBlocks, err := to.Blocks()
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+	if len(existingBlocks) > 0 {
+		return fmt.Errorf("Execute: %s: %w", c.To, ErrStorageNotEmpty)
+	}
+
+	if err = to.ReplaceBlocks(blocks, state.Balances()); err != nil {
+		return fmt.Errorf("Execute: cannot import the blocks: %w", err)
+	}
+	Logger.Infof("%d block(s) imported into %s, latest block hash=%s", len(blocks), c.To, state.GetLatestBlockHash().Hex())
+	return nil
+}
@@ -1,13 +1,23 @@
 package commands
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 )
 
 type TransactionCommands struct {
 	List ListTransactionCommand `command:"list" description:"List all transactions"`
+	Sign SignTransactionCommand `command:"sign" description:"Sign a transaction with a keystore account"`
 }
 
 type TransactionCommandsOpts struct {
@@ -15,21 +25,108 @@ type TransactionCommandsOpts struct {
 	TransactionsFilePath string
 }
 
+// StateLoader replays the chain once a command needs the state, the other commands (eg. chain verify)
+// can then run on a chain which can't be replayed
+type StateLoader func() (models.State, error)
+
 type ListTransactionCommand struct {
-	state models.State
+	loadState StateLoader
 }
 
-func NewListTransactionCommand(state models.State) (*ListTransactionCommand, error) {
-	if state == nil {
-		return nil, errors.New("NewListTransactionCommand: state cannot be nil")
+func NewListTransactionCommand(loadState StateLoader) (*ListTransactionCommand, error) {
+	if loadState == nil {
+		return nil, errors.New("NewListTransactionCommand: state loader cannot be nil")
 	}
 	list := new(ListTransactionCommand)
-	list.state = state
+	list.loadState = loadState
 
 	return list, nil
 }
 
 func (c *ListTransactionCommand) Execute(_ []string) error {
-	c.state.Print()
+	state, err := c.loadState()
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+	state.Print()
+	return nil
+}
+
+// SignTransactionCommand the password of the keystore account is never passed on the command line,
+// it would be kept in the shell history and shown in the process list
+type SignTransactionCommand struct {
+	loadState        StateLoader
+	keystore         *services.EthKeystoreService
+	From             string `short:"f" long:"from" description:"Account sending the funds, must be in the keystore" required:"true"`
+	PasswordFilePath string `long:"password_file_path" description:"File holding the password of the keystore account, the password is read from the standard input otherwise" required:"false"`
+	To               string `short:"t" long:"to" description:"Account receiving the funds" required:"true"`
+	Value            uint   `short:"v" long:"value" description:"Amount to send" required:"true"`
+	Fee              uint   `long:"fee" description:"Fee paid to the miner including the transaction" required:"false"`
+	Nonce            uint64 `long:"nonce" description:"Nonce of the transaction, see the next nonce of the account exposed by the node" required:"true"`
+	Reason           string `long:"reason" description:"Reason of the transaction" required:"false"`
+}
+
+func NewSignTransactionCommand(loadState StateLoader, keystore *services.EthKeystoreService) (*SignTransactionCommand, error) {
+	if loadState == nil {
+		return nil, errors.New("NewSignTransactionCommand: state loader cannot be nil")
+	}
+	if keystore == nil {
+		return nil, errors.New("NewSignTransactionCommand: keystore cannot be nil")
+	}
+	return &SignTransactionCommand{
+		loadState: loadState,
+		keystore:  keystore,
+	}, nil
+}
+
+func (c *SignTransactionCommand) Execute(_ []string) error {
+	from, err := models.NewAccount(c.From)
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+	to, err := models.NewAccount(c.To)
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+
+	state, err := c.loadState()
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+
+	password, err := c.readPassword()
+	if err != nil {
+		return fmt.Errorf("Execute: %w", err)
+	}
+
+	tx := models.NewTransaction(from, to, c.Value, c.Fee, c.Nonce, c.Reason, utils.DefaultTimeService.UnixUint64(), state.ChainId())
+	if err = c.keystore.SignTransaction(tx, password); err != nil {
+		return fmt.Errorf("Execute: cannot sign the transaction: %w", err)
+	}
+
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		return fmt.Errorf("Execute: cannot marshal the transaction: %w", err)
+	}
+	Logger.Infof("signed transaction: %s", txJson)
 	return nil
 }
+
+// readPassword reads the password of the keystore account from its file, or from the first line of the standard input
+func (c *SignTransactionCommand) readPassword() (string, error) {
+	if c.PasswordFilePath != "" {
+		password, err := os.ReadFile(c.PasswordFilePath)
+		if err != nil {
+			return "", fmt.Errorf("readPassword: cannot read the password file: %w", err)
+		}
+		return strings.TrimRight(string(password), "\r\n"), nil
+	}
+
+	// the prompt goes to the standard error, the signed transaction is the only output
+	fmt.Fprint(os.Stderr, "Password of the keystore account: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("readPassword: cannot read the password: %w", err)
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
 	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
@@ -15,6 +16,10 @@ import (
 
 const (
 	AUTH_HEADER = "X-API-TOKEN"
+	// a browser can't set a header on a websocket, the token is sent as the second subprotocol after
+	// AUTH_WEBSOCKET_PROTOCOL or as a query parameter instead
+	AUTH_WEBSOCKET_PROTOCOL = "token"
+	AUTH_QUERY_PARAM        = "token"
 )
 
 // A helper to write user_id and user_model to the context
@@ -33,7 +38,7 @@ func AuthWebSessionMiddleware(auto401 bool, jwtService *services.JwtService) gin
 
 		// if authentication is required
 		// extract token
-		jwtToken := c.Request.Header.Get(AUTH_HEADER)
+		jwtToken := ExtractToken(c.Request)
 		if jwtToken == "" {
 			AbortWithError(c, NewError(http.StatusUnauthorized, "authentication token cannot be found"))
 			return
@@ -70,3 +75,16 @@ func AuthWebSessionMiddleware(auto401 bool, jwtService *services.JwtService) gin
 		}
 	}
 }
+
+// ExtractToken returns the token of the request, a websocket handshake can carry it in its subprotocols or in
+// its query parameters
+func ExtractToken(r *http.Request) string {
+	if jwtToken := r.Header.Get(AUTH_HEADER); jwtToken != "" || !websocket.IsWebSocketUpgrade(r) {
+		return jwtToken
+	}
+	// eg. Sec-WebSocket-Protocol: token, <token>
+	if protocols := websocket.Subprotocols(r); len(protocols) == 2 && protocols[0] == AUTH_WEBSOCKET_PROTOCOL {
+		return protocols[1]
+	}
+	return r.URL.Query().Get(AUTH_QUERY_PARAM)
+}
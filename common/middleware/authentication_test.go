@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExtractToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header map[string]string
+		want   string
+	}{
+		{
+			name:   "the token header should be used",
+			url:    "/api/balances",
+			header: map[string]string{AUTH_HEADER: "header.jwt.token"},
+			want:   "header.jwt.token",
+		},
+		{
+			name: "the token subprotocol of a websocket should be used",
+			url:  "/api/ws",
+			header: map[string]string{
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-Websocket-Protocol": AUTH_WEBSOCKET_PROTOCOL + ", protocol.jwt.token",
+			},
+			want: "protocol.jwt.token",
+		},
+		{
+			name: "the token query parameter of a websocket should be used",
+			url:  "/api/ws?" + AUTH_QUERY_PARAM + "=query.jwt.token",
+			header: map[string]string{
+				"Connection": "Upgrade",
+				"Upgrade":    "websocket",
+			},
+			want: "query.jwt.token",
+		},
+		{
+			name: "the token query parameter of a request which isn't a websocket should be ignored",
+			url:  "/api/balances?" + AUTH_QUERY_PARAM + "=query.jwt.token",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatalf("NewRequest() error = %v", err)
+			}
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			if got := ExtractToken(req); got != tt.want {
+				t.Errorf("ExtractToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	. "github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	OPERATOR_HEADER = "X-OPERATOR-TOKEN"
+)
+
+// OperatorMiddleware restricts the endpoints reserved to the operators of the node to the requests carrying the
+// operator token, the endpoints are disabled if no operator token is configured
+func OperatorMiddleware(operatorToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if operatorToken == "" {
+			AbortWithError(c, NewError(http.StatusForbidden, "operator endpoints are disabled"))
+			return
+		}
+		token := c.Request.Header.Get(OPERATOR_HEADER)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(operatorToken)) != 1 {
+			AbortWithError(c, NewError(http.StatusForbidden, "operator token is not valid"))
+			return
+		}
+	}
+}
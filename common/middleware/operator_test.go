@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOperatorMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		operatorToken string
+		token         string
+		expectedCode  int
+	}{
+		{
+			name:          "a request carrying the operator token should be accepted",
+			operatorToken: "operator-token",
+			token:         "operator-token",
+			expectedCode:  http.StatusOK,
+		},
+		{
+			name:          "a request carrying another token should be refused",
+			operatorToken: "operator-token",
+			token:         "other-token",
+			expectedCode:  http.StatusForbidden,
+		},
+		{
+			name:          "a request without token should be refused",
+			operatorToken: "operator-token",
+			expectedCode:  http.StatusForbidden,
+		},
+		{
+			name:         "a request should be refused when no operator token is configured",
+			expectedCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.DELETE("/operator", OperatorMiddleware(tt.operatorToken), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{})
+			})
+
+			req, _ := http.NewRequest("DELETE", "/operator", nil)
+			if tt.token != "" {
+				req.Header.Set(OPERATOR_HEADER, tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("OperatorMiddleware() status = %d, want %d", w.Code, tt.expectedCode)
+			}
+		})
+	}
+}
@@ -9,11 +9,18 @@ import (
 
 type Account string
 
+// NewAccount returns the account in the single form the accounts are stored in, its checksummed hex address
 func NewAccount(account string) (Account, error) {
 	if !common.IsHexAddress(account) {
 		return "", errors.New("NewAccount: account " + account + " variable is not a valid ethereum account")
 	}
-	return Account(account), nil
+	return Account(account).normalize(), nil
+}
+
+// normalize returns the account in the form the accounts are stored in, the transactions signed with an account
+// written in another case keep it as it is signed
+func (acc Account) normalize() Account {
+	return Account(common.HexToAddress(string(acc)).Hex())
 }
 
 func (acc *Account) isSameAccount(toCompare Account) bool {
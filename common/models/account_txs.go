@@ -0,0 +1,88 @@
+package models
+
+// TxDirection direction of a transaction from the point of view of an account
+type TxDirection string
+
+const (
+	// TX_DIRECTION_IN transactions received by the account
+	TX_DIRECTION_IN TxDirection = "in"
+	// TX_DIRECTION_OUT transactions sent by the account
+	TX_DIRECTION_OUT TxDirection = "out"
+)
+
+func (d TxDirection) IsValid() bool {
+	switch d {
+	case TX_DIRECTION_IN, TX_DIRECTION_OUT:
+		return true
+	}
+	return false
+}
+
+// AccountTxsFilter criteria the transactions of an account must match, zero values don't filter anything
+type AccountTxsFilter struct {
+	Direction TxDirection
+	Reason    Reason
+	// FromHeight and ToHeight are inclusive
+	FromHeight uint64
+	ToHeight   uint64
+}
+
+// AccountTx transaction of an account along with the block of the main chain including it
+type AccountTx struct {
+	BlockHash   Hash
+	BlockHeight uint64
+	Tx          Transaction
+}
+
+// accountTxRef position of a transaction in the main chain
+type accountTxRef struct {
+	height uint64
+	index  int
+}
+
+func (f AccountTxsFilter) match(account Account, tx Transaction) bool {
+	switch f.Direction {
+	case TX_DIRECTION_IN:
+		if tx.To.normalize() != account {
+			return false
+		}
+	case TX_DIRECTION_OUT:
+		if tx.From.normalize() != account {
+			return false
+		}
+	}
+	return f.Reason == "" || tx.Reason == string(f.Reason)
+}
+
+// accountTxsPage collects the transactions of an account matching the filter, past the offset and up to the limit
+type accountTxsPage struct {
+	account Account
+	filter  AccountTxsFilter
+	offset  uint64
+	limit   uint64
+	txs     []AccountTx
+}
+
+func newAccountTxsPage(account Account, filter AccountTxsFilter, offset uint64, limit uint64) *accountTxsPage {
+	return &accountTxsPage{account: account, filter: filter, offset: offset, limit: limit, txs: make([]AccountTx, 0)}
+}
+
+// add adds the transaction if it matches the filter, it returns false once the page is full
+func (p *accountTxsPage) add(blockHash Hash, blockHeight uint64, tx Transaction) bool {
+	if !p.filter.match(p.account, tx) {
+		return true
+	}
+	if p.offset > 0 {
+		p.offset--
+		return true
+	}
+	if uint64(len(p.txs)) == p.limit {
+		return false
+	}
+	p.txs = append(p.txs, AccountTx{
+		BlockHash:   blockHash,
+		BlockHeight: blockHeight,
+		Tx:          tx,
+	})
+	return true
+}
@@ -3,6 +3,14 @@ package models
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"fmt"
+)
+
+const (
+	// MaxBlockTimeDriftInSeconds how far in the future a block time can be compared to this node clock
+	MaxBlockTimeDriftInSeconds = 2 * 60
+	// MedianTimeBlockCount number of blocks used to compute the median time a new block must be later than
+	MedianTimeBlockCount = 11
 )
 
 type Block struct {
@@ -11,10 +19,15 @@ type Block struct {
 }
 
 type BlockHeader struct {
-	Parent Hash   `json:"parent"`
-	Height uint64 `json:"height"`
-	Nonce  uint32 `json:"nonce"`
-	Time   uint64 `json:"time"`
+	Parent Hash    `json:"parent"`
+	TxRoot Hash    `json:"tx_root"`
+	Height uint64  `json:"height"`
+	Bits   uint32  `json:"bits"`
+	Nonce  uint32  `json:"nonce"`
+	Time   uint64  `json:"time"`
+	Miner  Account `json:"miner"`
+	// Signature seal of the block by its miner with the poa engine, empty with the pow engine
+	Signature Signature `json:"signature,omitempty"`
 }
 
 type BlockDB struct {
@@ -22,22 +35,75 @@ type BlockDB struct {
 	Block Block `json:"block"`
 }
 
-func NewBlock(parent Hash, height uint64, nonce uint32, time uint64, txs []Transaction) Block {
+func NewBlock(parent Hash, height uint64, bits uint32, nonce uint32, time uint64, miner Account, txs []Transaction) Block {
+	txRoot, _ := TxRoot(txs)
 	return Block{
 		BlockHeader{
 			parent,
+			txRoot,
 			height,
+			bits,
 			nonce,
 			time,
+			miner,
+			nil,
 		},
 		txs,
 	}
 }
 
+// Hash returns the hash of the block header, the transactions are part of it through the header TxRoot
 func (b Block) Hash() (Hash, error) {
-	blockJson, err := json.Marshal(b)
+	return b.Header.Hash()
+}
+
+func (h BlockHeader) Hash() (Hash, error) {
+	headerJson, err := json.Marshal(h)
 	if err != nil {
 		return Hash{}, err
 	}
-	return sha256.Sum256(blockJson), nil
+	return sha256.Sum256(headerJson), nil
+}
+
+// SealHash returns the hash of the block header without its signature, the hash its miner signs
+func (h BlockHeader) SealHash() (Hash, error) {
+	h.Signature = nil
+	return h.Hash()
+}
+
+// RejectedBlockError is returned when a block is refused because it doesn't follow the consensus rules
+type RejectedBlockError struct {
+	Hash   Hash
+	Height uint64
+	Err    error
+}
+
+func (e *RejectedBlockError) Error() string {
+	return fmt.Sprintf("block %s at height %d rejected: %s", e.Hash.Hex(), e.Height, e.Err.Error())
+}
+
+func (e *RejectedBlockError) Unwrap() error {
+	return e.Err
+}
+
+// checkBlock runs the checks of a block which don't depend on the chain it's added to
+// the header must commit to the transactions of the block
+func checkBlock(block Block, now uint64) error {
+	txRoot, err := TxRoot(block.Txs)
+	if err != nil {
+		return fmt.Errorf("checkBlock: %w", err)
+	}
+	if txRoot != block.Header.TxRoot {
+		return fmt.Errorf("checkBlock: %w", ErrBlockTxRoot)
+	}
+	return checkBlockHeader(block.Header, now)
+}
+
+// checkBlockHeader runs the checks of a block header which don't depend on the chain it's added to
+// the block can't come from the future, its seal is checked by the consensus engine
+func checkBlockHeader(header BlockHeader, now uint64) error {
+	if header.Time > now+MaxBlockTimeDriftInSeconds {
+		return fmt.Errorf("checkBlockHeader: %w", ErrBlockTimeTooNew)
+	}
+	return nil
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// POW_ENGINE blocks sealed with a proof of work, the chain with the most cumulative work wins
+	POW_ENGINE = "pow"
+	// POA_ENGINE blocks sealed in turns by the signers listed in the genesis file
+	POA_ENGINE = "poa"
+)
+
+var ErrUnknownEngine = errors.New("consensus engine is unknown")
+
+// ChainReader main chain a header is prepared or verified on top of
+type ChainReader interface {
+	// Headers returns the headers of the main chain by ascending height
+	Headers() []BlockHeader
+	// Blocks returns the blocks of the main chain by ascending height
+	Blocks() []BlockDB
+}
+
+// Engine consensus rules deciding how a block is sealed, which blocks are accepted and which fork wins
+type Engine interface {
+	// Name returns the name the engine is selected with in the configuration
+	Name() string
+	// PrepareHeader sets the consensus fields of a header about to be sealed on top of the chain
+	PrepareHeader(chain ChainReader, header *BlockHeader) error
+	// Seal turns the block into one the other nodes accept, it stops once ctx is done
+	Seal(ctx context.Context, block Block) (Block, error)
+	// VerifySeal checks the seal of a header regardless of the chain it's added to, so a block which
+	// hasn't been sealed is refused before being kept on any branch
+	VerifySeal(header BlockHeader, hash Hash) error
+	// VerifyHeader checks the consensus fields of a header added on top of the chain
+	VerifyHeader(chain ChainReader, header BlockHeader) error
+	// BlockWeight returns the weight a block adds to its chain
+	BlockWeight(header BlockHeader) *big.Int
+	// SelectFork tells whether a fork should replace the main chain given their cumulative weights
+	SelectFork(mainChainWeight *big.Int, forkWeight *big.Int) bool
+}
+
+// DefaultEngine engine used when the consensus configuration isn't available (eg. cli commands)
+func DefaultEngine() Engine {
+	return NewProofOfWork(DefaultDifficulty())
+}
+
+// NewEngineFromGenesis engine used when the consensus configuration isn't available (eg. cli commands),
+// the blocks of a chain whose genesis file lists signers are sealed by them
+func NewEngineFromGenesis(genesis GenesisFile) (Engine, error) {
+	if len(genesis.Signers) == 0 {
+		return DefaultEngine(), nil
+	}
+	signers, err := genesis.SignerAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("NewEngineFromGenesis: %w", err)
+	}
+	engine, err := NewProofOfAuthority(signers)
+	if err != nil {
+		return nil, fmt.Errorf("NewEngineFromGenesis: %w", err)
+	}
+	return engine, nil
+}
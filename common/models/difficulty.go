@@ -0,0 +1,132 @@
+package models
+
+import (
+	"math/big"
+)
+
+// DifficultyRetargetInterval number of blocks after which the difficulty is adjusted
+const DifficultyRetargetInterval = 10
+
+// the difficulty cannot be adjusted by more than this factor at each retarget
+const maxDifficultyAdjustmentFactor = 4
+
+// difficulty used when the consensus configuration isn't available (eg. cli commands)
+const (
+	defaultComplexity             = 3
+	defaultBlockIntervalInSeconds = 5
+)
+
+// Difficulty rules computing the proof of work target (bits) each block must meet
+type Difficulty struct {
+	// target of the first blocks, it's also the easiest target a block can have
+	initialBits            uint32
+	blockIntervalInSeconds uint64
+}
+
+// NewDifficulty creates the rules from the complexity (number of leading zero bytes) of the first blocks
+// and the time expected between two blocks
+func NewDifficulty(complexity uint32, blockIntervalInSeconds uint32) Difficulty {
+	return Difficulty{
+		initialBits:            ComplexityToBits(complexity),
+		blockIntervalInSeconds: uint64(blockIntervalInSeconds),
+	}
+}
+
+// DefaultDifficulty creates the rules with the default complexity and block interval
+func DefaultDifficulty() Difficulty {
+	return NewDifficulty(defaultComplexity, defaultBlockIntervalInSeconds)
+}
+
+// InitialBits returns the bits of the first blocks
+func (d Difficulty) InitialBits() uint32 {
+	return d.initialBits
+}
+
+// NextBits returns the bits the block following the headers must have
+// headers are the headers of the chain ordered by height, starting at height 1
+func (d Difficulty) NextBits(headers []BlockHeader) uint32 {
+	height := uint64(len(headers)) + 1
+	if height == 1 {
+		return d.initialBits
+	}
+
+	parent := headers[len(headers)-1]
+	if (height-1)%DifficultyRetargetInterval != 0 || d.blockIntervalInSeconds == 0 {
+		return parent.Bits
+	}
+
+	// compare the time it took to mine the last blocks with the time it should have taken
+	first := headers[len(headers)-DifficultyRetargetInterval]
+	expectedTimespan := int64(d.blockIntervalInSeconds * (DifficultyRetargetInterval - 1))
+	actualTimespan := int64(parent.Time) - int64(first.Time)
+	if actualTimespan < expectedTimespan/maxDifficultyAdjustmentFactor {
+		actualTimespan = expectedTimespan / maxDifficultyAdjustmentFactor
+	}
+	if actualTimespan > expectedTimespan*maxDifficultyAdjustmentFactor {
+		actualTimespan = expectedTimespan * maxDifficultyAdjustmentFactor
+	}
+
+	// blocks found faster than expected lower the target, making the next blocks harder to find
+	target := CompactToTarget(parent.Bits)
+	target.Mul(target, big.NewInt(actualTimespan))
+	target.Div(target, big.NewInt(expectedTimespan))
+
+	// the difficulty can't go below the one the chain has started with
+	if maxTarget := CompactToTarget(d.initialBits); target.Cmp(maxTarget) > 0 {
+		target = maxTarget
+	}
+	return TargetToCompact(target)
+}
+
+// ComplexityToBits returns the bits of the target requiring complexity leading zero bytes
+func ComplexityToBits(complexity uint32) uint32 {
+	target := new(big.Int).Lsh(big.NewInt(1), uint(256-8*complexity))
+	target.Sub(target, big.NewInt(1))
+	return TargetToCompact(target)
+}
+
+// CompactToTarget converts the compact representation of a target into the target
+// the compact representation is the one used by bitcoin: 1 byte of exponent and 3 bytes of mantissa
+func CompactToTarget(bits uint32) *big.Int {
+	exponent := uint(bits >> 24)
+	mantissa := int64(bits & 0x007fffff)
+
+	if exponent <= 3 {
+		return big.NewInt(mantissa >> (8 * (3 - exponent)))
+	}
+	return new(big.Int).Lsh(big.NewInt(mantissa), 8*(exponent-3))
+}
+
+// TargetToCompact converts a target into its compact representation
+func TargetToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	exponent := uint(len(target.Bytes()))
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64() << (8 * (3 - exponent)))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, 8*(exponent-3)).Uint64())
+	}
+
+	// the mantissa is signed, shift it when its sign bit is set
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	return uint32(exponent<<24) | mantissa
+}
+
+// Work returns the number of hashes expected to be computed to find a block meeting the target represented by bits
+func Work(bits uint32) *big.Int {
+	target := CompactToTarget(bits)
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
+
+// HashMeetsTarget checks if the hash is lower or equal to the target represented by bits
+func HashMeetsTarget(hash Hash, bits uint32) bool {
+	return new(big.Int).SetBytes(hash[:]).Cmp(CompactToTarget(bits)) <= 0
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCompactToTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		bits uint32
+		want *big.Int
+	}{
+		{
+			name: "bits with a small exponent should shift the mantissa to the right",
+			bits: 0x01123456,
+			want: big.NewInt(0x12),
+		},
+		{
+			name: "bits with a large exponent should shift the mantissa to the left",
+			bits: 0x1d00ffff,
+			want: new(big.Int).Lsh(big.NewInt(0xffff), 8*26),
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompactToTarget(tt.bits)
+			if got.Cmp(tt.want) != 0 {
+				t.Errorf("CompactToTarget() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDifficulty_NextBits(t *testing.T) {
+	// define variables
+	difficulty := NewDifficulty(1, 8)
+	initialBits := difficulty.InitialBits()
+	harderBits := TargetToCompact(new(big.Int).Div(CompactToTarget(initialBits), big.NewInt(4)))
+
+	newHeaders := func(bits uint32, count int, interval uint64) []BlockHeader {
+		headers := make([]BlockHeader, count)
+		for i := range headers {
+			headers[i] = BlockHeader{Height: uint64(i + 1), Bits: bits, Time: uint64(i) * interval}
+		}
+		return headers
+	}
+
+	tests := []struct {
+		name    string
+		headers []BlockHeader
+		want    uint32
+	}{
+		{
+			name:    "first block should use the initial difficulty",
+			headers: []BlockHeader{},
+			want:    initialBits,
+		},
+		{
+			name:    "block in the middle of an interval should use its parent difficulty",
+			headers: newHeaders(harderBits, 5, 1),
+			want:    harderBits,
+		},
+		{
+			name:    "blocks mined faster than expected should increase the difficulty",
+			headers: newHeaders(initialBits, DifficultyRetargetInterval, 1),
+			want:    harderBits,
+		},
+		{
+			name:    "blocks mined slower than expected should not go below the initial difficulty",
+			headers: newHeaders(initialBits, DifficultyRetargetInterval, 100),
+			want:    initialBits,
+		},
+		{
+			name:    "blocks mined slower than expected should decrease the difficulty",
+			headers: newHeaders(harderBits, DifficultyRetargetInterval, 16),
+			want:    TargetToCompact(new(big.Int).Mul(CompactToTarget(harderBits), big.NewInt(2))),
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := difficulty.NextBits(tt.headers); got != tt.want {
+				t.Errorf("NextBits() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashMeetsTarget(t *testing.T) {
+	bits := ComplexityToBits(1)
+
+	if !HashMeetsTarget(Hash{0x00, 0x01}, bits) {
+		t.Errorf("HashMeetsTarget() = false, want true for a hash starting with a zero byte")
+	}
+	if HashMeetsTarget(Hash{0x01}, bits) {
+		t.Errorf("HashMeetsTarget() = true, want false for a hash not starting with a zero byte")
+	}
+}
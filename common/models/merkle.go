@@ -0,0 +1,136 @@
+package models
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+var ErrMerkleLeafNotFound = errors.New("leaf is not part of the merkle tree")
+
+// MerkleProofNode sibling hash needed to compute the parent of a node on the way to the root
+type MerkleProofNode struct {
+	Hash Hash `json:"hash"`
+	// IsLeft is true when the sibling is on the left of the node
+	IsLeft bool `json:"is_left"`
+}
+
+// TxRoot returns the merkle root of the transactions hashes
+func TxRoot(txs []Transaction) (Hash, error) {
+	leaves, err := txsLeaves(txs)
+	if err != nil {
+		return Hash{}, fmt.Errorf("TxRoot: %w", err)
+	}
+	return MerkleRoot(leaves), nil
+}
+
+// TxProof returns the proof that the transaction is part of the transactions
+func TxProof(txs []Transaction, txHash TransactionId) ([]MerkleProofNode, error) {
+	leaves, err := txsLeaves(txs)
+	if err != nil {
+		return nil, fmt.Errorf("TxProof: %w", err)
+	}
+	for i, leaf := range leaves {
+		if leaf == Hash(txHash) {
+			return MerkleProof(leaves, i), nil
+		}
+	}
+	return nil, fmt.Errorf("TxProof: %w", ErrMerkleLeafNotFound)
+}
+
+func txsLeaves(txs []Transaction) ([]Hash, error) {
+	leaves := make([]Hash, len(txs))
+	for i, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = Hash(txHash)
+	}
+	return leaves, nil
+}
+
+const (
+	// merkleLeafPrefix and merkleNodePrefix keep a leaf from being mistaken for an inner node of the tree
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleRoot computes the root of the tree built on top of the leaves
+// when a level has an odd number of nodes, the last one is promoted to the next level as is
+// the root of an empty tree is the empty hash
+func MerkleRoot(leaves []Hash) Hash {
+	if len(leaves) == 0 {
+		return Hash{}
+	}
+
+	level := hashMerkleLeaves(leaves)
+	for len(level) > 1 {
+		level = nextMerkleLevel(level)
+	}
+	return level[0]
+}
+
+// MerkleProof returns the siblings needed to compute the root from the leaf at index
+func MerkleProof(leaves []Hash, index int) []MerkleProofNode {
+	proof := make([]MerkleProofNode, 0)
+
+	level := hashMerkleLeaves(leaves)
+	for len(level) > 1 {
+		// the last node of an odd level doesn't have any sibling, it's promoted as is
+		if sibling := index ^ 1; sibling < len(level) {
+			proof = append(proof, MerkleProofNode{
+				Hash:   level[sibling],
+				IsLeft: sibling < index,
+			})
+		}
+
+		level = nextMerkleLevel(level)
+		index /= 2
+	}
+	return proof
+}
+
+// VerifyMerkleProof checks that the leaf is part of the tree of the root
+func VerifyMerkleProof(leaf Hash, root Hash, proof []MerkleProofNode) bool {
+	node := hashMerkleLeaf(leaf)
+	for _, sibling := range proof {
+		if sibling.IsLeft {
+			node = hashMerkleNodes(sibling.Hash, node)
+		} else {
+			node = hashMerkleNodes(node, sibling.Hash)
+		}
+	}
+	return node == root
+}
+
+func hashMerkleLeaves(leaves []Hash) []Hash {
+	level := make([]Hash, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = hashMerkleLeaf(leaf)
+	}
+	return level
+}
+
+func nextMerkleLevel(level []Hash) []Hash {
+	next := make([]Hash, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, hashMerkleNodes(level[i], level[i+1]))
+	}
+	return next
+}
+
+func hashMerkleLeaf(leaf Hash) Hash {
+	return sha256.Sum256(append([]byte{merkleLeafPrefix}, leaf[:]...))
+}
+
+func hashMerkleNodes(left Hash, right Hash) Hash {
+	data := make([]byte, 0, 1+2*len(left))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left[:]...)
+	return sha256.Sum256(append(data, right[:]...))
+}
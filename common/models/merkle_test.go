@@ -0,0 +1,107 @@
+package models
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func TestMerkleProof(t *testing.T) {
+	newLeaves := func(count int) []Hash {
+		leaves := make([]Hash, count)
+		for i := range leaves {
+			leaves[i] = sha256.Sum256([]byte(fmt.Sprintf("leaf %d", i)))
+		}
+		return leaves
+	}
+
+	// run tests
+	for count := 1; count <= 7; count++ {
+		t.Run(fmt.Sprintf("proofs of a tree with %d leaves should be verified against its root", count), func(t *testing.T) {
+			leaves := newLeaves(count)
+			root := MerkleRoot(leaves)
+
+			for i, leaf := range leaves {
+				proof := MerkleProof(leaves, i)
+				if !VerifyMerkleProof(leaf, root, proof) {
+					t.Errorf("VerifyMerkleProof() = false for leaf %d", i)
+				}
+				if VerifyMerkleProof(sha256.Sum256([]byte("unknown leaf")), root, proof) {
+					t.Errorf("VerifyMerkleProof() = true for a leaf which is not part of the tree")
+				}
+			}
+		})
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	leaves := []Hash{{0x01}, {0x02}, {0x03}}
+
+	tests := []struct {
+		name   string
+		leaves []Hash
+		want   Hash
+	}{
+		{
+			name:   "root of an empty tree should be the empty hash",
+			leaves: []Hash{},
+			want:   Hash{},
+		},
+		{
+			name:   "root of a single leaf tree should be the hash of the leaf",
+			leaves: leaves[:1],
+			want:   hashMerkleLeaf(leaves[0]),
+		},
+		{
+			name:   "root of a tree with an odd number of leaves should promote the last leaf",
+			leaves: leaves,
+			want: hashMerkleNodes(
+				hashMerkleNodes(hashMerkleLeaf(leaves[0]), hashMerkleLeaf(leaves[1])),
+				hashMerkleLeaf(leaves[2]),
+			),
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MerkleRoot(tt.leaves); got != tt.want {
+				t.Errorf("MerkleRoot() = %s, want %s", got.Hex(), tt.want.Hex())
+			}
+		})
+	}
+}
+
+func TestMerkleRoot_Collisions(t *testing.T) {
+	leaves := []Hash{{0x01}, {0x02}, {0x03}, {0x04}}
+	innerNodes := []Hash{
+		hashMerkleNodes(hashMerkleLeaf(leaves[0]), hashMerkleLeaf(leaves[1])),
+		hashMerkleNodes(hashMerkleLeaf(leaves[2]), hashMerkleLeaf(leaves[3])),
+	}
+
+	tests := []struct {
+		name   string
+		leaves []Hash
+		other  []Hash
+	}{
+		{
+			name:   "a tree whose last leaf is duplicated should not share the root of the original tree",
+			leaves: leaves[:3],
+			other:  append(leaves[:3:3], leaves[2]),
+		},
+		{
+			name:   "a tree whose leaves are the inner nodes of another tree should not share its root",
+			leaves: leaves,
+			other:  innerNodes,
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if MerkleRoot(tt.leaves) == MerkleRoot(tt.other) {
+				t.Errorf("MerkleRoot() = %s for both trees", MerkleRoot(tt.leaves).Hex())
+			}
+		})
+	}
+}
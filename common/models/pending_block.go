@@ -3,15 +3,17 @@ package models
 type PendingBlock struct {
 	Parent       Hash
 	Height       uint64
+	Bits         uint32
 	Time         uint64
 	MinerAddress Account
 	Txs          []Transaction
 }
 
-func NewPendingBlock(parent Hash, height uint64, minerAddress Account, time uint64, txs []Transaction) PendingBlock {
+func NewPendingBlock(parent Hash, height uint64, bits uint32, minerAddress Account, time uint64, txs []Transaction) PendingBlock {
 	return PendingBlock{
 		Parent:       parent,
 		Height:       height,
+		Bits:         bits,
 		Time:         time,
 		MinerAddress: minerAddress,
 		Txs:          txs,
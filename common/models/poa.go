@@ -0,0 +1,370 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+const (
+	// POA_IN_TURN_BITS weight of a block sealed by the signer whose turn it is
+	POA_IN_TURN_BITS = 2
+	// POA_NO_TURN_BITS weight of a block sealed by another signer, so the chain sealed in turns wins
+	POA_NO_TURN_BITS = 1
+	// POA_OUT_OF_TURN_DELAY_IN_MS time a signer waits before sealing out of turn, so the signer whose turn it is goes first
+	POA_OUT_OF_TURN_DELAY_IN_MS = 1000
+	// POA_OUT_OF_TURN_WIGGLE_IN_MS random time added to the delay, so the signers out of turn don't seal all at once
+	POA_OUT_OF_TURN_WIGGLE_IN_MS = 1000
+	// POA_SNAPSHOTS_CACHE_SIZE number of signers snapshots kept, the latest blocks are verified without replaying the chain
+	POA_SNAPSHOTS_CACHE_SIZE = 128
+)
+
+var (
+	ErrNoSigners             = errors.New("the genesis file doesn't list any signer")
+	ErrUnauthorizedSigner    = errors.New("block miner is not an authorised signer")
+	ErrSignerRecentlySigned  = errors.New("block miner has signed one of the latest blocks")
+	ErrSignerLocked          = errors.New("no unlocked account to sign the block with")
+	ErrBlockSignatureMissing = errors.New("block is not signed")
+	ErrBlockSignatureInvalid = errors.New("block signature is not valid")
+	ErrBlockSignerMismatch   = errors.New("block signer doesn't match with the miner")
+)
+
+// SignHashFn signs the hash with the key of the account
+type SignHashFn func(account Account, hash Hash) (Signature, error)
+
+// ProofOfAuthority engine sealing blocks with the signature of an authorised signer, the signers take turns in
+// round-robin and vote to add or remove signers with signer-add and signer-remove transactions
+type ProofOfAuthority struct {
+	genesisSigners []Account
+
+	mu     sync.Mutex
+	signFn SignHashFn
+	// signers snapshots by hash of the block they have been taken at
+	snapshots      map[Hash]*signersSnapshot
+	snapshotHashes []Hash
+}
+
+func NewProofOfAuthority(signers []Account) (*ProofOfAuthority, error) {
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("NewProofOfAuthority: %w", ErrNoSigners)
+	}
+	return &ProofOfAuthority{
+		genesisSigners: signers,
+		snapshots:      make(map[Hash]*signersSnapshot),
+	}, nil
+}
+
+// Authorize lets the engine seal the blocks of the miner with the unlocked key signFn signs with
+func (p *ProofOfAuthority) Authorize(signFn SignHashFn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.signFn = signFn
+}
+
+func (p *ProofOfAuthority) Name() string {
+	return POA_ENGINE
+}
+
+// Signers returns the signers allowed to seal the next block of the chain
+func (p *ProofOfAuthority) Signers(chain ChainReader) []Account {
+	sortedSigners := p.snapshot(chain).sortedSigners()
+	signers := make([]Account, len(sortedSigners))
+	for i, signer := range sortedSigners {
+		signers[i] = Account(signer.Hex())
+	}
+	return signers
+}
+
+// PrepareHeader the miner must be a signer which hasn't sealed one of the latest blocks,
+// the bits hold the weight of the block depending on whether it's the miner turn
+func (p *ProofOfAuthority) PrepareHeader(chain ChainReader, header *BlockHeader) error {
+	snap := p.snapshot(chain)
+	miner := common.HexToAddress(string(header.Miner))
+	if err := snap.checkSigner(header.Height, miner); err != nil {
+		return fmt.Errorf("PrepareHeader: %w", err)
+	}
+	header.Bits = snap.bits(header.Height, miner)
+	header.Nonce = 0
+	return nil
+}
+
+// Seal signs the block with the key of its miner, a signer out of turn waits to let the signer whose turn it is go first
+func (p *ProofOfAuthority) Seal(ctx context.Context, block Block) (Block, error) {
+	p.mu.Lock()
+	signFn := p.signFn
+	p.mu.Unlock()
+	if signFn == nil {
+		return block, fmt.Errorf("Seal: %w", ErrSignerLocked)
+	}
+
+	if block.Header.Bits != POA_IN_TURN_BITS {
+		delay := time.Duration(POA_OUT_OF_TURN_DELAY_IN_MS+rand.Int63n(POA_OUT_OF_TURN_WIGGLE_IN_MS)) * time.Millisecond
+		Logger.Debugf("Seal: out of turn, waiting %s before sealing block at height %d", delay, block.Header.Height)
+		select {
+		case <-ctx.Done():
+			return block, errors.New("Seal: sealing task has been shutdown")
+		case <-time.After(delay):
+		}
+	}
+
+	sealHash, err := block.Header.SealHash()
+	if err != nil {
+		// notest
+		return block, fmt.Errorf("Seal: failed to get seal hash: %w", err)
+	}
+	signature, err := signFn(block.Header.Miner, sealHash)
+	if err != nil {
+		return block, fmt.Errorf("Seal: failed to sign the block: %w", err)
+	}
+	block.Header.Signature = signature
+
+	blockHash, _ := block.Hash()
+	Logger.Infof("Seal: block sealed by %s, block hash=%s", block.Header.Miner, blockHash.Hex())
+	return block, nil
+}
+
+// VerifySeal the header must be signed by its miner, whether the miner is a signer depends on the chain
+func (p *ProofOfAuthority) VerifySeal(header BlockHeader, _ Hash) error {
+	if len(header.Signature) == 0 {
+		return fmt.Errorf("VerifySeal: %w", ErrBlockSignatureMissing)
+	}
+	if len(header.Signature) != crypto.SignatureLength {
+		return fmt.Errorf("VerifySeal: %w", ErrBlockSignatureInvalid)
+	}
+
+	sealHash, err := header.SealHash()
+	if err != nil {
+		return fmt.Errorf("VerifySeal: failed to get seal hash: %w", err)
+	}
+	publicKey, err := crypto.SigToPub(sealHash[:], header.Signature)
+	if err != nil {
+		return fmt.Errorf("VerifySeal: %w: %s", ErrBlockSignatureInvalid, err.Error())
+	}
+	if crypto.PubkeyToAddress(*publicKey) != common.HexToAddress(string(header.Miner)) {
+		return fmt.Errorf("VerifySeal: %w", ErrBlockSignerMismatch)
+	}
+	return nil
+}
+
+// VerifyHeader the miner must be a signer which hasn't sealed one of the latest blocks,
+// the bits must match with the miner turn
+func (p *ProofOfAuthority) VerifyHeader(chain ChainReader, header BlockHeader) error {
+	snap := p.snapshot(chain)
+	miner := common.HexToAddress(string(header.Miner))
+	if err := snap.checkSigner(header.Height, miner); err != nil {
+		return fmt.Errorf("VerifyHeader: %w", err)
+	}
+	if header.Bits != snap.bits(header.Height, miner) {
+		return fmt.Errorf("VerifyHeader: %w", ErrBlockDifficulty)
+	}
+	return nil
+}
+
+// BlockWeight the blocks sealed in turn weigh more than the others
+func (p *ProofOfAuthority) BlockWeight(header BlockHeader) *big.Int {
+	return big.NewInt(int64(header.Bits))
+}
+
+// SelectFork the chain with the most blocks sealed in turn wins, on equal weight we stick to the chain we have seen first
+func (p *ProofOfAuthority) SelectFork(mainChainWeight *big.Int, forkWeight *big.Int) bool {
+	return forkWeight.Cmp(mainChainWeight) > 0
+}
+
+// snapshot returns the signers allowed to seal the next block of the chain, the blocks following the latest
+// cached snapshot are replayed from it
+func (p *ProofOfAuthority) snapshot(chain ChainReader) *signersSnapshot {
+	blocks := chain.Blocks()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var snap *signersSnapshot
+	i := len(blocks)
+	for ; i > 0; i-- {
+		if cached, ok := p.snapshots[blocks[i-1].Hash]; ok {
+			snap = cached
+			break
+		}
+	}
+	if snap == nil {
+		snap = newSignersSnapshot(p.genesisSigners)
+	}
+	if i == len(blocks) {
+		return snap
+	}
+
+	// the cached snapshots are shared, so they are never modified
+	snap = snap.copy()
+	for _, blockDB := range blocks[i:] {
+		snap.apply(blockDB.Block)
+	}
+	p.cacheSnapshot(blocks[len(blocks)-1].Hash, snap)
+	return snap
+}
+
+// cacheSnapshot keeps the snapshot, the oldest one is dropped once the cache is full
+func (p *ProofOfAuthority) cacheSnapshot(hash Hash, snap *signersSnapshot) {
+	if len(p.snapshotHashes) >= POA_SNAPSHOTS_CACHE_SIZE {
+		delete(p.snapshots, p.snapshotHashes[0])
+		p.snapshotHashes = p.snapshotHashes[1:]
+	}
+	p.snapshots[hash] = snap
+	p.snapshotHashes = append(p.snapshotHashes, hash)
+}
+
+// signersSnapshot signers allowed to seal the block following the block the snapshot has been taken at
+type signersSnapshot struct {
+	signers map[common.Address]struct{}
+	// signer of each of the latest blocks by height
+	recents map[uint64]common.Address
+	// votes of the signers for each candidate, true to add it and false to remove it
+	votes map[common.Address]map[common.Address]bool
+}
+
+func newSignersSnapshot(genesisSigners []Account) *signersSnapshot {
+	snap := &signersSnapshot{
+		signers: make(map[common.Address]struct{}, len(genesisSigners)),
+		recents: make(map[uint64]common.Address),
+		votes:   make(map[common.Address]map[common.Address]bool),
+	}
+	for _, signer := range genesisSigners {
+		snap.signers[common.HexToAddress(string(signer))] = struct{}{}
+	}
+	return snap
+}
+
+func (s *signersSnapshot) copy() *signersSnapshot {
+	copiedSnap := &signersSnapshot{
+		signers: make(map[common.Address]struct{}, len(s.signers)),
+		recents: make(map[uint64]common.Address, len(s.recents)),
+		votes:   make(map[common.Address]map[common.Address]bool, len(s.votes)),
+	}
+	for signer := range s.signers {
+		copiedSnap.signers[signer] = struct{}{}
+	}
+	for height, signer := range s.recents {
+		copiedSnap.recents[height] = signer
+	}
+	for candidate, votes := range s.votes {
+		copiedSnap.votes[candidate] = make(map[common.Address]bool, len(votes))
+		for voter, authorize := range votes {
+			copiedSnap.votes[candidate][voter] = authorize
+		}
+	}
+	return copiedSnap
+}
+
+// limit a signer can seal only one block out of limit consecutive blocks, a minority of signers can't take over the chain
+func (s *signersSnapshot) limit() uint64 {
+	return uint64(len(s.signers)/2 + 1)
+}
+
+func (s *signersSnapshot) sortedSigners() []common.Address {
+	signers := make([]common.Address, 0, len(s.signers))
+	for signer := range s.signers {
+		signers = append(signers, signer)
+	}
+	sort.Slice(signers, func(i, j int) bool { return bytes.Compare(signers[i][:], signers[j][:]) < 0 })
+	return signers
+}
+
+// bits returns the weight of the block at the height sealed by the signer, the signers take turns by ascending address
+func (s *signersSnapshot) bits(height uint64, signer common.Address) uint32 {
+	signers := s.sortedSigners()
+	if signers[height%uint64(len(signers))] == signer {
+		return POA_IN_TURN_BITS
+	}
+	return POA_NO_TURN_BITS
+}
+
+// checkSigner checks the signer is allowed to seal the block at the height
+func (s *signersSnapshot) checkSigner(height uint64, signer common.Address) error {
+	if _, ok := s.signers[signer]; !ok {
+		return ErrUnauthorizedSigner
+	}
+	for seen, recent := range s.recents {
+		if recent == signer && seen+s.limit() > height {
+			return ErrSignerRecentlySigned
+		}
+	}
+	return nil
+}
+
+// apply records the signer of the block and tallies the votes of its transactions, a candidate voted for by
+// more than half of the signers is added or removed
+func (s *signersSnapshot) apply(block Block) {
+	height := block.Header.Height
+	if limit := s.limit(); height >= limit {
+		delete(s.recents, height-limit)
+	}
+	// blocks persisted locally without being mined do not have any signer
+	if block.Header.Miner != "" {
+		s.recents[height] = common.HexToAddress(string(block.Header.Miner))
+	}
+
+	for _, tx := range block.Txs {
+		if tx.Reason != SIGNER_ADD && tx.Reason != SIGNER_REMOVE {
+			continue
+		}
+		voter := common.HexToAddress(string(tx.From))
+		if _, ok := s.signers[voter]; !ok {
+			continue
+		}
+
+		// a vote for what the candidate already is doesn't count
+		candidate := common.HexToAddress(string(tx.To))
+		authorize := tx.Reason == SIGNER_ADD
+		if _, isSigner := s.signers[candidate]; isSigner == authorize {
+			continue
+		}
+		// the chain can't be left without any signer
+		if !authorize && len(s.signers) == 1 {
+			continue
+		}
+
+		if s.votes[candidate] == nil {
+			s.votes[candidate] = make(map[common.Address]bool)
+		}
+		s.votes[candidate][voter] = authorize
+		tally := 0
+		for _, vote := range s.votes[candidate] {
+			if vote == authorize {
+				tally++
+			}
+		}
+		if tally <= len(s.signers)/2 {
+			continue
+		}
+
+		delete(s.votes, candidate)
+		if authorize {
+			s.signers[candidate] = struct{}{}
+			Logger.Debugf("apply: signer %s added at height %d", candidate.Hex(), height)
+			continue
+		}
+		delete(s.signers, candidate)
+		// the votes of the revoked signer don't count anymore
+		for otherCandidate, votes := range s.votes {
+			delete(votes, candidate)
+			if len(votes) == 0 {
+				delete(s.votes, otherCandidate)
+			}
+		}
+		// the window of the latest signers shrinks along with the signers
+		if limit := s.limit(); height >= limit {
+			delete(s.recents, height-limit)
+		}
+		Logger.Debugf("apply: signer %s removed at height %d", candidate.Hex(), height)
+	}
+}
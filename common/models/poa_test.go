@@ -0,0 +1,349 @@
+package models
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+// newTestSigner creates a signer along with its key
+func newTestSigner(t *testing.T) (Account, *ecdsa.PrivateKey) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Account(crypto.PubkeyToAddress(key.PublicKey).Hex()), key
+}
+
+// newTestPoaChain links the blocks one after the other, each block is mined by the miner at the same index
+func newTestPoaChain(miners []Account, txs ...[]Transaction) testChain {
+	chain := make(testChain, 0, len(txs))
+	parent := Hash{}
+	for i, blockTxs := range txs {
+		block := NewBlock(parent, uint64(i+1), POA_NO_TURN_BITS, 0, uint64(i+1), miners[i], blockTxs)
+		blockHash, _ := block.Hash()
+		chain = append(chain, BlockDB{Hash: blockHash, Block: block})
+		parent = blockHash
+	}
+	return chain
+}
+
+func newTestVote(voter Account, candidate Account, reason string) Transaction {
+	return *NewTransaction(voter, candidate, 0, 0, 0, reason, 0, "")
+}
+
+func TestProofOfAuthority_Seal(t *testing.T) {
+	// define variables
+	signerA, keyA := newTestSigner(t)
+	signerB, keyB := newTestSigner(t)
+	outsider, _ := newTestSigner(t)
+	keys := map[Account]*ecdsa.PrivateKey{signerA: keyA, signerB: keyB}
+
+	engine, err := NewProofOfAuthority([]Account{signerA, signerB})
+	if err != nil {
+		t.Fatalf("NewProofOfAuthority() error = %v", err)
+	}
+	engine.Authorize(func(account Account, hash Hash) (Signature, error) {
+		return crypto.Sign(hash[:], keys[account])
+	})
+
+	// the signers take turns by ascending address
+	signers := engine.Signers(testChain{})
+	inTurnSigner, outOfTurnSigner := signers[1], signers[0]
+
+	// a block sealed in turn is signed by its miner
+	header := BlockHeader{Height: 1, Time: 10, Miner: inTurnSigner}
+	if err = engine.PrepareHeader(testChain{}, &header); err != nil {
+		t.Fatalf("PrepareHeader() error = %v", err)
+	}
+	if header.Bits != POA_IN_TURN_BITS {
+		t.Errorf("PrepareHeader() bits = %d, want %d", header.Bits, POA_IN_TURN_BITS)
+	}
+	block := NewBlock(header.Parent, header.Height, header.Bits, 0, header.Time, header.Miner, []Transaction{})
+	sealed, err := engine.Seal(context.Background(), block)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	hash, _ := sealed.Hash()
+	if err = engine.VerifySeal(sealed.Header, hash); err != nil {
+		t.Errorf("VerifySeal() error = %v", err)
+	}
+	if err = engine.VerifyHeader(testChain{}, sealed.Header); err != nil {
+		t.Errorf("VerifyHeader() error = %v", err)
+	}
+
+	// a block claiming another miner than its signer is refused
+	tampered := sealed.Header
+	tampered.Miner = outOfTurnSigner
+	if err = engine.VerifySeal(tampered, hash); !errors.Is(err, ErrBlockSignerMismatch) {
+		t.Errorf("VerifySeal() error = %v, want %v", err, ErrBlockSignerMismatch)
+	}
+	unsigned := block.Header
+	if err = engine.VerifySeal(unsigned, hash); !errors.Is(err, ErrBlockSignatureMissing) {
+		t.Errorf("VerifySeal() error = %v, want %v", err, ErrBlockSignatureMissing)
+	}
+
+	// a block sealed out of turn must say so
+	tampered = sealed.Header
+	tampered.Miner = outOfTurnSigner
+	if err = engine.VerifyHeader(testChain{}, tampered); !errors.Is(err, ErrBlockDifficulty) {
+		t.Errorf("VerifyHeader() error = %v, want %v", err, ErrBlockDifficulty)
+	}
+
+	// an account which isn't a signer can't seal any block
+	header = BlockHeader{Height: 1, Time: 10, Miner: outsider}
+	if err = engine.PrepareHeader(testChain{}, &header); !errors.Is(err, ErrUnauthorizedSigner) {
+		t.Errorf("PrepareHeader() error = %v, want %v", err, ErrUnauthorizedSigner)
+	}
+
+	// a signer out of turn waits for the signer whose turn it is
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	header = BlockHeader{Height: 1, Time: 10, Miner: outOfTurnSigner}
+	_ = engine.PrepareHeader(testChain{}, &header)
+	block = NewBlock(header.Parent, header.Height, header.Bits, 0, header.Time, header.Miner, []Transaction{})
+	if _, err = engine.Seal(ctx, block); err == nil {
+		t.Errorf("Seal() error = %v, want the sealing to be cancelled", err)
+	}
+}
+
+func TestProofOfAuthority_RecentlySigned(t *testing.T) {
+	// define variables
+	signerA, _ := newTestSigner(t)
+	signerB, _ := newTestSigner(t)
+	engine, _ := NewProofOfAuthority([]Account{signerA, signerB})
+	chain := newTestPoaChain([]Account{signerA}, []Transaction{})
+
+	// with 2 signers, a signer can only seal one block out of 2
+	header := BlockHeader{Height: 2, Miner: signerA}
+	if err := engine.PrepareHeader(chain, &header); !errors.Is(err, ErrSignerRecentlySigned) {
+		t.Errorf("PrepareHeader() error = %v, want %v", err, ErrSignerRecentlySigned)
+	}
+	header = BlockHeader{Height: 2, Miner: signerB}
+	if err := engine.PrepareHeader(chain, &header); err != nil {
+		t.Errorf("PrepareHeader() error = %v", err)
+	}
+}
+
+func TestProofOfAuthority_Votes(t *testing.T) {
+	// define variables
+	signerA, _ := newTestSigner(t)
+	signerB, _ := newTestSigner(t)
+	signerC, _ := newTestSigner(t)
+	outsider, _ := newTestSigner(t)
+
+	tests := []struct {
+		name           string
+		genesisSigners []Account
+		miners         []Account
+		txs            [][]Transaction
+		want           []Account
+	}{
+		{
+			name:           "a candidate voted for by half of the signers should not be added",
+			genesisSigners: []Account{signerA, signerB},
+			miners:         []Account{signerA},
+			txs:            [][]Transaction{{newTestVote(signerA, signerC, SIGNER_ADD)}},
+			want:           []Account{signerA, signerB},
+		},
+		{
+			name:           "a candidate voted for by more than half of the signers should be added",
+			genesisSigners: []Account{signerA, signerB},
+			miners:         []Account{signerA, signerB},
+			txs: [][]Transaction{
+				{newTestVote(signerA, signerC, SIGNER_ADD)},
+				{newTestVote(signerB, signerC, SIGNER_ADD)},
+			},
+			want: []Account{signerA, signerB, signerC},
+		},
+		{
+			name:           "a signer voted against by more than half of the signers should be removed",
+			genesisSigners: []Account{signerA, signerB, signerC},
+			miners:         []Account{signerA, signerB},
+			txs: [][]Transaction{
+				{newTestVote(signerA, signerC, SIGNER_REMOVE)},
+				{newTestVote(signerB, signerC, SIGNER_REMOVE)},
+			},
+			want: []Account{signerA, signerB},
+		},
+		{
+			name:           "the votes of an account which isn't a signer should not count",
+			genesisSigners: []Account{signerA},
+			miners:         []Account{signerA},
+			txs:            [][]Transaction{{newTestVote(outsider, signerC, SIGNER_ADD)}},
+			want:           []Account{signerA},
+		},
+		{
+			name:           "the last signer should not be removed",
+			genesisSigners: []Account{signerA},
+			miners:         []Account{signerA},
+			txs:            [][]Transaction{{newTestVote(signerA, signerA, SIGNER_REMOVE)}},
+			want:           []Account{signerA},
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, _ := NewProofOfAuthority(tt.genesisSigners)
+			got := engine.Signers(newTestPoaChain(tt.miners, tt.txs...))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Signers() = %v, want %v", got, tt.want)
+			}
+			want := make(map[Account]struct{}, len(tt.want))
+			for _, signer := range tt.want {
+				want[signer] = struct{}{}
+			}
+			for _, signer := range got {
+				if _, ok := want[signer]; !ok {
+					t.Errorf("Signers() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestProofOfAuthority_AddBlock(t *testing.T) {
+	// define variables
+	signerA, keyA := newTestSigner(t)
+	signerB, keyB := newTestSigner(t)
+	keys := map[Account]*ecdsa.PrivateKey{signerA: keyA, signerB: keyB}
+
+	dir := t.TempDir()
+	genesisFilePath := filepath.Join(dir, "genesis.json")
+	dbFilePath := filepath.Join(dir, "blocks.db")
+	genesis := fmt.Sprintf(`{"chain_id":"%s","block_reward":50,"balances":{},"signers":["%s","%s"]}`, test.ChainId, signerA, signerB)
+	if err := os.WriteFile(genesisFilePath, []byte(genesis), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dbFilePath, []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	genesisFile, _ := ReadGenesisFile(genesisFilePath)
+	engine, err := NewEngineFromGenesis(genesisFile)
+	if err != nil {
+		t.Fatalf("NewEngineFromGenesis() error = %v", err)
+	}
+	engine.(*ProofOfAuthority).Authorize(func(account Account, hash Hash) (Signature, error) {
+		return crypto.Sign(hash[:], keys[account])
+	})
+	state, err := NewStateFromFile(genesisFilePath, dbFilePath, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = state.Close() })
+
+	sealBlock := func(miner Account, time uint64) Block {
+		header := BlockHeader{Parent: state.GetLatestBlockHash(), Height: state.GetLatestBlockHeight() + 1, Time: time, Miner: miner}
+		if err := state.PrepareHeader(&header); err != nil {
+			t.Fatalf("PrepareHeader() error = %v", err)
+		}
+		block := NewBlock(header.Parent, header.Height, header.Bits, 0, header.Time, header.Miner, []Transaction{})
+		sealed, err := engine.Seal(context.Background(), block)
+		if err != nil {
+			t.Fatalf("Seal() error = %v", err)
+		}
+		return sealed
+	}
+
+	// the signers seal the blocks in turns, the miner is rewarded as with the pow engine
+	signers := engine.(*ProofOfAuthority).Signers(state)
+	block1 := sealBlock(signers[1], 10)
+	if _, err = state.AddBlock(block1); err != nil {
+		t.Fatalf("AddBlock() error = %v", err)
+	}
+	if got := state.GetBalance(signers[1]); got != 50 {
+		t.Errorf("GetBalance() = %d, want %d", got, 50)
+	}
+
+	// a signer which has just sealed a block has to wait for the other signer
+	unsigned := NewBlock(state.GetLatestBlockHash(), 2, POA_NO_TURN_BITS, 0, 20, signers[1], []Transaction{})
+	if _, err = state.AddBlock(unsigned); !errors.Is(err, ErrBlockSignatureMissing) {
+		t.Errorf("AddBlock() error = %v, want %v", err, ErrBlockSignatureMissing)
+	}
+	recentlySigned := unsigned
+	sealHash, _ := recentlySigned.Header.SealHash()
+	recentlySigned.Header.Signature, _ = crypto.Sign(sealHash[:], keys[signers[1]])
+	if _, err = state.AddBlock(recentlySigned); !errors.Is(err, ErrSignerRecentlySigned) {
+		t.Errorf("AddBlock() error = %v, want %v", err, ErrSignerRecentlySigned)
+	}
+	if _, err = state.AddBlock(sealBlock(signers[0], 20)); err != nil {
+		t.Errorf("AddBlock() error = %v", err)
+	}
+
+	// only the signers can vote
+	outsider, _ := newTestSigner(t)
+	if !state.CanVote(signerA) || state.CanVote(outsider) {
+		t.Errorf("CanVote() signer = %v, outsider = %v, want true, false", state.CanVote(signerA), state.CanVote(outsider))
+	}
+
+	// a vote signed by a signer whose account is written in lowercase, as in the genesis files
+	lowercaseSigner := Account(strings.ToLower(string(signerA)))
+	vote := newTestVote(lowercaseSigner, outsider, SIGNER_ADD)
+	if err = vote.Sign(keyA); err != nil {
+		t.Fatal(err)
+	}
+	if err = vote.VerifySignature(); err != nil {
+		t.Errorf("VerifySignature() error = %v", err)
+	}
+	if !state.CanVote(vote.From) {
+		t.Errorf("CanVote() = false, want true for the lowercase account of a signer")
+	}
+}
+
+func TestProofOfAuthority_VerifyStoredChain(t *testing.T) {
+	// define variables
+	signer, signerKey := newTestSigner(t)
+	outsider, outsiderKey := newTestSigner(t)
+
+	dir := t.TempDir()
+	genesisFilePath := filepath.Join(dir, "genesis.json")
+	genesis := fmt.Sprintf(`{"chain_id":"%s","block_reward":50,"balances":{},"signers":["%s"]}`, test.ChainId, signer)
+	if err := os.WriteFile(genesisFilePath, []byte(genesis), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dbFilePath := filepath.Join(dir, "blocks.db")
+	if err := os.WriteFile(dbFilePath, []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewFileStorage(dbFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	// block1 is sealed by the signer, block2 is sealed by an account which isn't a signer
+	sealBlock := func(parent Hash, height uint64, miner Account, key *ecdsa.PrivateKey) BlockDB {
+		block := NewBlock(parent, height, POA_IN_TURN_BITS, 0, height, miner, []Transaction{})
+		sealHash, _ := block.Header.SealHash()
+		block.Header.Signature, _ = crypto.Sign(sealHash[:], key)
+		hash, _ := block.Hash()
+		return BlockDB{Hash: hash, Block: block}
+	}
+	block1 := sealBlock(Hash{}, 1, signer, signerKey)
+	block2 := sealBlock(block1.Hash, 2, outsider, outsiderKey)
+	for _, blockDB := range []BlockDB{block1, block2} {
+		if err = storage.AppendBlock(blockDB, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the signature matches the miner, but the miner isn't allowed to seal any block
+	engine, _ := NewProofOfAuthority([]Account{signer})
+	_, err = NewVerifiedStateFromStorage(genesisFilePath, storage, engine)
+	var rejectedBlockErr *RejectedBlockError
+	if !errors.As(err, &rejectedBlockErr) || !errors.Is(err, ErrUnauthorizedSigner) {
+		t.Fatalf("NewVerifiedStateFromStorage() error = %v, want %v", err, ErrUnauthorizedSigner)
+	}
+	if rejectedBlockErr.Height != 2 {
+		t.Errorf("NewVerifiedStateFromStorage() rejected block at height %d, want %d", rejectedBlockErr.Height, 2)
+	}
+}
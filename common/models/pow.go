@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+// ProofOfWork engine sealing blocks with a nonce making their hash meet the target of the difficulty
+type ProofOfWork struct {
+	difficulty Difficulty
+}
+
+func NewProofOfWork(difficulty Difficulty) *ProofOfWork {
+	return &ProofOfWork{difficulty: difficulty}
+}
+
+func (p *ProofOfWork) Name() string {
+	return POW_ENGINE
+}
+
+// PrepareHeader the difficulty is not chosen by the miner, it's derived from the time taken to mine the previous blocks
+func (p *ProofOfWork) PrepareHeader(chain ChainReader, header *BlockHeader) error {
+	header.Bits = p.difficulty.NextBits(chain.Headers())
+	return nil
+}
+
+// Seal tries random nonces until the block hash is lower or equal to the target defined by the difficulty
+func (p *ProofOfWork) Seal(ctx context.Context, block Block) (Block, error) {
+	count := uint32(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return block, errors.New("Seal: mining task has been shutdown")
+		default:
+		}
+
+		block.Header.Nonce = utils.GenerateNonce()
+		blockHash, err := block.Hash()
+		if err != nil {
+			// notest
+			return block, fmt.Errorf("Seal: failed to get block hash: %w", err)
+		}
+
+		printAttempts(count)
+		count++
+
+		if HashMeetsTarget(blockHash, block.Header.Bits) {
+			Logger.Infof("Seal: attempt %d found a nonce=%d, block hash=%s", count, block.Header.Nonce, blockHash.Hex())
+			return block, nil
+		}
+	}
+}
+
+// VerifySeal the proof of work must meet the target the header declares
+func (p *ProofOfWork) VerifySeal(header BlockHeader, hash Hash) error {
+	if !HashMeetsTarget(hash, header.Bits) {
+		return fmt.Errorf("VerifySeal: %w", ErrBlockProofOfWork)
+	}
+	return nil
+}
+
+// VerifyHeader the target the header declares must be the one derived from the chain
+func (p *ProofOfWork) VerifyHeader(chain ChainReader, header BlockHeader) error {
+	if header.Bits != p.difficulty.NextBits(chain.Headers()) {
+		return fmt.Errorf("VerifyHeader: %w", ErrBlockDifficulty)
+	}
+	return nil
+}
+
+// BlockWeight the number of hashes expected to be computed to find the block
+func (p *ProofOfWork) BlockWeight(header BlockHeader) *big.Int {
+	return Work(header.Bits)
+}
+
+// SelectFork the chain with the most cumulative proof of work wins even if it's not the longest one,
+// on equal work we stick to the chain we have seen first
+func (p *ProofOfWork) SelectFork(mainChainWeight *big.Int, forkWeight *big.Int) bool {
+	return forkWeight.Cmp(mainChainWeight) > 0
+}
+
+func printAttempts(i uint32) {
+	if i%1000000 == 0 {
+		Logger.Debugf("attempt: %d", i+1)
+	}
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// testChain main chain made of the blocks
+type testChain []BlockDB
+
+func (c testChain) Headers() []BlockHeader {
+	headers := make([]BlockHeader, len(c))
+	for i, blockDB := range c {
+		headers[i] = blockDB.Block.Header
+	}
+	return headers
+}
+
+func (c testChain) Blocks() []BlockDB {
+	return c
+}
+
+func TestProofOfWork_Seal(t *testing.T) {
+	// define variables
+	engine := NewProofOfWork(NewDifficulty(1, 5))
+	header := BlockHeader{Height: 1, Time: 10}
+	if err := engine.PrepareHeader(testChain{}, &header); err != nil {
+		t.Fatalf("PrepareHeader() error = %v", err)
+	}
+	block := NewBlock(header.Parent, header.Height, header.Bits, 0, header.Time, header.Miner, []Transaction{})
+
+	// a sealed block meets the target the engine has prepared
+	sealed, err := engine.Seal(context.Background(), block)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	hash, _ := sealed.Hash()
+	if err = engine.VerifySeal(sealed.Header, hash); err != nil {
+		t.Errorf("VerifySeal() error = %v", err)
+	}
+	if err = engine.VerifyHeader(testChain{}, sealed.Header); err != nil {
+		t.Errorf("VerifyHeader() error = %v", err)
+	}
+
+	// a header declaring another target is refused
+	tampered := sealed.Header
+	tampered.Bits = ComplexityToBits(2)
+	if err = engine.VerifyHeader(testChain{}, tampered); !errors.Is(err, ErrBlockDifficulty) {
+		t.Errorf("VerifyHeader() error = %v, want %v", err, ErrBlockDifficulty)
+	}
+}
+
+func TestProofOfWork_SelectFork(t *testing.T) {
+	tests := []struct {
+		name            string
+		mainChainWeight *big.Int
+		forkWeight      *big.Int
+		want            bool
+	}{
+		{
+			name:            "a heavier fork should replace the main chain",
+			mainChainWeight: big.NewInt(10),
+			forkWeight:      big.NewInt(11),
+			want:            true,
+		},
+		{
+			name:            "a fork as heavy as the main chain should not replace it",
+			mainChainWeight: big.NewInt(10),
+			forkWeight:      big.NewInt(10),
+			want:            false,
+		},
+		{
+			name:            "a lighter fork should not replace the main chain",
+			mainChainWeight: big.NewInt(10),
+			forkWeight:      big.NewInt(9),
+			want:            false,
+		},
+	}
+
+	// run tests
+	engine := NewProofOfWork(DefaultDifficulty())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := engine.SelectFork(tt.mainChainWeight, tt.forkWeight); got != tt.want {
+				t.Errorf("SelectFork() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
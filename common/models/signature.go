@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/hex"
+)
+
+// Signature secp256k1 signature in its [R || S || V] form
+type Signature []byte
+
+func (s Signature) MarshalText() ([]byte, error) {
+	return []byte(s.Hex()), nil
+}
+
+func (s *Signature) UnmarshalText(data []byte) error {
+	sig, err := hex.DecodeString(string(data))
+	if err != nil {
+		return err
+	}
+	*s = sig
+	return nil
+}
+
+func (s Signature) Hex() string {
+	return hex.EncodeToString(s)
+}
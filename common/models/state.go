@@ -1,17 +1,19 @@
 package models
 
 import (
-	"bufio"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"math/big"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
 
-	"github.com/jinzhu/copier"
 	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 )
 
@@ -19,126 +21,504 @@ var (
 	ErrInsufficientBalance = errors.New("insufficient balance")
 	ErrNextBlockHeight     = errors.New("latest block height doesn't match with next block (height + 1)")
 	ErrNextBlockHash       = errors.New("latest block hash doesn't match with next block")
+	ErrTxNonceAlreadyUsed  = errors.New("transaction nonce has already been used by the account")
+	ErrTxNonceTooHigh      = errors.New("transaction nonce is higher than the account next nonce")
+	ErrTxSelfReward        = errors.New("self-reward transactions are not allowed, miners are rewarded by the protocol")
+	ErrTxReceiverInvalid   = errors.New("transaction receiver is not a valid account")
+	ErrBlockMinerMissing   = errors.New("block miner is not a valid account")
+	ErrBlockDifficulty     = errors.New("block difficulty doesn't match with the expected difficulty")
+	ErrBlockProofOfWork    = errors.New("block hash doesn't meet the target of its difficulty")
+	ErrBlockTimeTooOld     = errors.New("block time is not later than the median time of the previous blocks")
+	ErrBlockTimeTooNew     = errors.New("block time is too far in the future")
+	ErrBlockTxRoot         = errors.New("block transactions root doesn't match with its transactions")
+	ErrBlockHashMismatch   = errors.New("block hash doesn't match with its header")
+	ErrSideBlockTooDeep    = errors.New("block forks from the main chain too far below the latest block")
+	ErrSideBlocksFull      = errors.New("too many blocks are kept on competing branches with more work")
+)
+
+const (
+	// NewHeadsSubscriptionSize number of new heads a subscriber can lag behind before missing some
+	NewHeadsSubscriptionSize = 100
+	// MaxSideBlockDepth blocks of competing branches forking further below the latest block are refused and forgotten
+	MaxSideBlockDepth = 100
+	// MaxSideBlocks number of blocks of competing branches kept at most
+	MaxSideBlocks = 1000
 )
 
 type GenesisFile struct {
-	Time     time.Time       `json:"genesis_time"`
-	ChainId  string          `json:"chain_id"`
-	Balances map[string]uint `json:"balances"`
+	Time        time.Time       `json:"genesis_time"`
+	ChainId     string          `json:"chain_id"`
+	BlockReward uint            `json:"block_reward"`
+	Balances    map[string]uint `json:"balances"`
+	// Signers accounts allowed to seal the first blocks with the poa engine
+	Signers []string `json:"signers,omitempty"`
+}
+
+// ReadGenesisFile reads the genesis file the chain starts from
+func ReadGenesisFile(genesisFilePath string) (GenesisFile, error) {
+	file, err := ioutil.ReadFile(genesisFilePath)
+	if err != nil {
+		return GenesisFile{}, fmt.Errorf("ReadGenesisFile: failed to read file: %w", err)
+	}
+
+	// extract genesis file information into struct
+	data := GenesisFile{}
+	err = json.Unmarshal(file, &data)
+	if err != nil {
+		return GenesisFile{}, fmt.Errorf("ReadGenesisFile: failed to unmarshall state: %w", err)
+	}
+	return data, nil
+}
+
+// Hash identifies the chain the genesis file starts, nodes with different genesis files can't share blocks
+func (g GenesisFile) Hash() (Hash, error) {
+	genesisJson, err := json.Marshal(g)
+	if err != nil {
+		return Hash{}, err
+	}
+	return sha256.Sum256(genesisJson), nil
+}
+
+// SignerAccounts returns the signers of the genesis file
+func (g GenesisFile) SignerAccounts() ([]Account, error) {
+	signers := make([]Account, len(g.Signers))
+	for i, signer := range g.Signers {
+		acc, err := NewAccount(signer)
+		if err != nil {
+			return nil, fmt.Errorf("SignerAccounts: invalid signer: %w", err)
+		}
+		signers[i] = acc
+	}
+	return signers, nil
 }
 
 type (
+	// StateReader read-only view of the state, enough to check a transaction can be applied on top of the main chain
+	StateReader interface {
+		// ChainId returns the chain id defined in the genesis file
+		ChainId() string
+		// GetNextNonce returns the nonce expected for the next transaction of the account
+		GetNextNonce(Account) uint64
+		// GetBalance returns the balance of the account
+		GetBalance(Account) uint
+		// CanVote returns false if the consensus restricts the votes and the account isn't allowed to cast one
+		CanVote(Account) bool
+	}
+
 	State interface {
+		StateReader
+
+		// GenesisHash returns the hash of the genesis file
+		GenesisHash() Hash
 		// Add adds a transaction
 		Add(Transaction) error
-		// AddBlock to the state
-		AddBlock(Block) error
-		// AddBlocks to the state
-		AddBlocks([]Block) error
+		// AddBlock to the state, it returns the transactions which are not part of the main chain
+		// anymore if the block has triggered a chain reorganisation
+		AddBlock(Block) ([]Transaction, error)
+		// AddBlocks to the state, it returns the transactions orphaned by the blocks
+		AddBlocks([]Block) ([]Transaction, error)
 		// Balances return the balances as map
 		Balances() map[Account]uint
-		Persist() (Hash, error)
+		// PrepareHeader sets the consensus fields of the next block header with the consensus engine
+		PrepareHeader(*BlockHeader) error
+		// Engine returns the consensus engine the blocks are verified with
+		Engine() Engine
+		// GetTotalWork returns the cumulative weight of the main chain, its proof of work with the pow engine
+		GetTotalWork() *big.Int
+		// GetBlockLocator returns hashes of the main chain, from the latest block down to the genesis
+		GetBlockLocator() []Hash
 		Close() error
 		GetLatestBlockHash() Hash
 		GetLatestBlockHeight() uint64
+		// GetBlockByHash returns the block of the main chain with the hash
+		GetBlockByHash(Hash) (BlockDB, bool)
+		// GetBlockByHeight returns the block of the main chain at the height
+		GetBlockByHeight(uint64) (BlockDB, bool)
+		// GetBlocksFromHeight returns at most limit blocks of the main chain starting at the height
+		GetBlocksFromHeight(height uint64, limit uint64) []BlockDB
+		// GetBlockByTxHash returns the block of the main chain including the transaction
+		GetBlockByTxHash(TransactionId) (BlockDB, bool)
+		// GetAccountTxs returns the transactions of the main chain sent or received by the account by ascending height,
+		// offset transactions matching the filter are skipped and at most limit transactions are returned
+		GetAccountTxs(account Account, filter AccountTxsFilter, offset uint64, limit uint64) []AccountTx
+		// SubscribeNewHeads returns a channel receiving the blocks added on top of the main chain
+		SubscribeNewHeads() <-chan NewHeadEvent
 		Print()
 	}
 )
 
+// NewHeadEvent block added on top of the main chain, along with the balances it has changed
+// the balances changed by a chain reorganisation come with the latest block of the new branch
+type NewHeadEvent struct {
+	Block    BlockDB
+	Balances map[Account]uint
+}
+
+// newHeadSubscribers channels notified of the new heads of the main chain
+type newHeadSubscribers struct {
+	mu       sync.Mutex
+	channels []chan NewHeadEvent
+}
+
 type FromFileState struct {
-	balances         map[Account]uint
-	transactionsPool []Transaction
-	dbFile           *os.File
-	latestBlockHash  Hash
-	latestBlock      Block
+	// mu guards the balances, the nonces and the chain, the blocks are applied and reorganised under the write lock
+	mu sync.RWMutex
+
+	chainId         string
+	genesisHash     Hash
+	blockReward     uint
+	engine          Engine
+	genesisBalances map[Account]uint
+	balances        map[Account]uint
+	nonces          map[Account]uint64
+	storage         Storage
+	latestBlockHash Hash
+	latestBlock     Block
+
+	// main chain, the block at height h is stored at index h-1
+	blocks    []BlockDB
+	headers   []BlockHeader
+	chainWork []*big.Int
+	heights   map[Hash]uint64
+	// height of the main chain block including each transaction
+	txHeights map[TransactionId]uint64
+	// transactions sent or received by each account, by ascending height
+	accountTxs map[Account][]accountTxRef
+	// blocks of the competing branches, indexed by their hash
+	sideBlocks map[Hash]Block
+
+	subscribers *newHeadSubscribers
 }
 
-func NewStateFromFile(genesisFilePath string, transactionFilePath string) (*FromFileState, error) {
-	// read genesis file
-	file, err := ioutil.ReadFile(genesisFilePath)
+func NewStateFromFile(genesisFilePath string, transactionFilePath string, engine Engine) (*FromFileState, error) {
+	// read transactions database
+	storage, err := NewFileStorage(transactionFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("NewStateFromFile: failed to read file: %w", err)
+		return nil, fmt.Errorf("NewStateFromFile: failed to get txs database: %w", err)
 	}
 
-	// extract genesis file information into struct
-	data := GenesisFile{}
-	err = json.Unmarshal([]byte(file), &data)
+	state, err := NewStateFromStorage(genesisFilePath, storage, engine)
+	if err != nil {
+		_ = storage.Close()
+		return nil, fmt.Errorf("NewStateFromFile: %w", err)
+	}
+	return state, nil
+}
+
+// NewStateFromStorage replays the main chain kept by the storage on top of the genesis
+func NewStateFromStorage(genesisFilePath string, storage Storage, engine Engine) (*FromFileState, error) {
+	state, err := newStateFromStorage(genesisFilePath, storage, engine, false)
+	if err != nil {
+		return nil, fmt.Errorf("NewStateFromStorage: %w", err)
+	}
+	return state, nil
+}
+
+// NewVerifiedStateFromStorage replays the main chain kept by the storage on top of the genesis, verifying every block
+// a tampered block is reported with a RejectedBlockError
+func NewVerifiedStateFromStorage(genesisFilePath string, storage Storage, engine Engine) (*FromFileState, error) {
+	state, err := newStateFromStorage(genesisFilePath, storage, engine, true)
+	if err != nil {
+		return nil, fmt.Errorf("NewVerifiedStateFromStorage: %w", err)
+	}
+	return state, nil
+}
+
+func newStateFromStorage(genesisFilePath string, storage Storage, engine Engine, isVerified bool) (*FromFileState, error) {
+	// read genesis file
+	data, err := ReadGenesisFile(genesisFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("NewStateFromFile: failed to unmarshall state: %w", err)
+		return nil, fmt.Errorf("newStateFromStorage: %w", err)
 	}
 
 	balances := make(map[Account]uint)
 	for account, balance := range data.Balances {
 		acc, err := NewAccount(account)
 		if err != nil {
-			return nil, fmt.Errorf("NewStateFromFile: invalid account: %w", err)
+			return nil, fmt.Errorf("newStateFromStorage: invalid account: %w", err)
 		}
 		balances[acc] = balance
 	}
 
-	// read transactions database
-	db, err := getTransactionsDb(transactionFilePath)
+	state, err := getStateFromStorage(data, balances, storage, engine, isVerified)
 	if err != nil {
-		return nil, fmt.Errorf("NewStateFromFile: failed to get txs database: %w", err)
+		return nil, fmt.Errorf("newStateFromStorage: failed to intialise state: %w", err)
 	}
+	return state, nil
+}
 
-	state, err := getFileStateFromFile(balances, db)
+func getStateFromStorage(genesis GenesisFile, balances map[Account]uint, storage Storage, engine Engine, isVerified bool) (*FromFileState, error) {
+	state := newFileState(genesis.ChainId, genesis.BlockReward, engine, balances, storage)
+	genesisHash, err := genesis.Hash()
 	if err != nil {
-		return nil, fmt.Errorf("NewStateFromFile: failed to intialise state: %w", err)
+		return nil, fmt.Errorf("getStateFromStorage: failed to hash genesis: %w", err)
 	}
-	return state, nil
-}
+	state.genesisHash = genesisHash
 
-func getFileStateFromFile(balances map[Account]uint, db *os.File) (*FromFileState, error) {
-	state := &FromFileState{balances, make([]Transaction, 0), db, Hash{}, Block{}}
+	blocks, err := storage.Blocks()
+	if err != nil {
+		return nil, fmt.Errorf("getStateFromStorage: failed to read the blocks: %w", err)
+	}
 
 	// for each block found in database
-	scanner := bufio.NewScanner(db)
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, fmt.Errorf("getFileStateFromFile: failed at reading line: %w", err)
-		}
-
-		blockFsJson := scanner.Bytes()
-		var blockDB BlockDB
-		err := json.Unmarshal(blockFsJson, &blockDB)
-		if err != nil {
-			return nil, fmt.Errorf("getFileStateFromFile: failed to unmarshal: %w", err)
+	for _, blockDB := range blocks {
+		if isVerified {
+			if err = state.verifyBlock(blockDB); err != nil {
+				return nil, fmt.Errorf("getStateFromStorage: %w", newRejectedBlockError(blockDB.Block, blockDB.Hash, err))
+			}
+			state.appendBlock(blockDB)
+			continue
 		}
 
 		// we do not call applyBlocks here
 		// we are initiating the state from the initial database containing legit blocks, so it's
 		// safe not to apply any business logic on the blocks themselves
-		err = state.applyTxs(blockDB.Block.Txs)
+		err = state.applyBlockTxs(blockDB.Block)
 		if err != nil {
-			return nil, fmt.Errorf("getFileStateFromFile: failed to applyTxs: %w", err)
+			return nil, fmt.Errorf("getStateFromStorage: failed to applyBlockTxs: %w", err)
 		}
 
 		// keep a copy of the latest block and its hash,
 		// so it can be exposed to the network
-		state.latestBlockHash = blockDB.Hash
-		state.latestBlock = blockDB.Block
+		state.appendBlock(blockDB)
+	}
+
+	// the balances replayed from the blocks are the reference, the stored ones only tell whether the storage drifted
+	storedBalances, isStored, err := storage.Balances()
+	if err != nil {
+		return nil, fmt.Errorf("getStateFromStorage: failed to read the balances: %w", err)
+	}
+	if isStored && len(changedBalances(storedBalances, state.balances)) > 0 {
+		Logger.Warnf("getStateFromStorage: stored balances differ from the balances replayed from the blocks")
 	}
 	return state, nil
 }
 
-func getTransactionsDb(transactionFilePath string) (*os.File, error) {
-	return os.OpenFile(transactionFilePath, os.O_APPEND|os.O_RDWR, 0o600)
+func newFileState(chainId string, blockReward uint, engine Engine, genesisBalances map[Account]uint, storage Storage) *FromFileState {
+	balances := make(map[Account]uint, len(genesisBalances))
+	for account, balance := range genesisBalances {
+		balances[account] = balance
+	}
+
+	return &FromFileState{
+		chainId:         chainId,
+		blockReward:     blockReward,
+		engine:          engine,
+		genesisBalances: genesisBalances,
+		balances:        balances,
+		nonces:          make(map[Account]uint64),
+		storage:         storage,
+		heights:         make(map[Hash]uint64),
+		txHeights:       make(map[TransactionId]uint64),
+		accountTxs:      make(map[Account][]accountTxRef),
+		sideBlocks:      make(map[Hash]Block),
+		subscribers:     &newHeadSubscribers{},
+	}
+}
+
+// appendBlock adds a block, which has already been applied, on top of the main chain
+func (s *FromFileState) appendBlock(blockDB BlockDB) {
+	work := s.engine.BlockWeight(blockDB.Block.Header)
+	if len(s.chainWork) > 0 {
+		work.Add(work, s.chainWork[len(s.chainWork)-1])
+	}
+
+	s.blocks = append(s.blocks, blockDB)
+	s.headers = append(s.headers, blockDB.Block.Header)
+	s.chainWork = append(s.chainWork, work)
+	s.heights[blockDB.Hash] = blockDB.Block.Header.Height
+	for i, tx := range blockDB.Block.Txs {
+		txHash, _ := tx.Hash()
+		s.txHeights[txHash] = blockDB.Block.Header.Height
+
+		ref := accountTxRef{blockDB.Block.Header.Height, i}
+		from, to := tx.From.normalize(), tx.To.normalize()
+		s.accountTxs[from] = append(s.accountTxs[from], ref)
+		if to != from {
+			s.accountTxs[to] = append(s.accountTxs[to], ref)
+		}
+	}
+	s.latestBlockHash = blockDB.Hash
+	s.latestBlock = blockDB.Block
 }
 
+// Balances returns a copy of the balances
 func (s *FromFileState) Balances() map[Account]uint {
-	return s.balances
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	balances := make(map[Account]uint, len(s.balances))
+	for account, balance := range s.balances {
+		balances[account] = balance
+	}
+	return balances
 }
 
-func (s *FromFileState) Add(tx Transaction) error {
-	if err := s.applyTx(tx); err != nil {
-		return err
+func (s *FromFileState) ChainId() string {
+	return s.chainId
+}
+
+func (s *FromFileState) GenesisHash() Hash {
+	return s.genesisHash
+}
+
+func (s *FromFileState) GetNextNonce(account Account) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.nonces[account.normalize()]
+}
+
+func (s *FromFileState) GetBalance(account Account) uint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.balances[account.normalize()]
+}
+
+func (s *FromFileState) CanVote(account Account) bool {
+	poa, ok := s.engine.(*ProofOfAuthority)
+	if !ok {
+		return true
+	}
+
+	s.mu.RLock()
+	chain := s.chain()
+	s.mu.RUnlock()
+
+	// the accounts are compared as addresses, a signer votes whatever the case its account is written in
+	address := common.HexToAddress(string(account))
+	for _, signer := range poa.Signers(chain) {
+		if common.HexToAddress(string(signer)) == address {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *FromFileState) PrepareHeader(header *BlockHeader) error {
+	s.mu.RLock()
+	chain := s.chain()
+	s.mu.RUnlock()
+
+	if err := s.engine.PrepareHeader(chain, header); err != nil {
+		return fmt.Errorf("PrepareHeader: %w", err)
 	}
-	s.transactionsPool = append(s.transactionsPool, tx)
 	return nil
 }
 
-func (s *FromFileState) AddBlock(block Block) error {
+func (s *FromFileState) Engine() Engine {
+	return s.engine
+}
+
+// Headers returns the headers of the main chain by ascending height
+func (s *FromFileState) Headers() []BlockHeader {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.headers
+}
+
+// Blocks returns the blocks of the main chain by ascending height
+func (s *FromFileState) Blocks() []BlockDB {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.blocks
+}
+
+// chainSnapshot chain as it was when the snapshot has been taken, the blocks are only ever appended
+// to the slices or the slices are replaced, so it can be read without holding the state lock
+type chainSnapshot struct {
+	headers []BlockHeader
+	blocks  []BlockDB
+}
+
+func (c chainSnapshot) Headers() []BlockHeader {
+	return c.headers
+}
+
+func (c chainSnapshot) Blocks() []BlockDB {
+	return c.blocks
+}
+
+// chain returns a snapshot of the main chain the consensus engine can read while the lock is held
+func (s *FromFileState) chain() chainSnapshot {
+	return chainSnapshot{headers: s.headers, blocks: s.blocks}
+}
+
+func (s *FromFileState) GetTotalWork() *big.Int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.totalWork()
+}
+
+func (s *FromFileState) totalWork() *big.Int {
+	if len(s.chainWork) == 0 {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(s.chainWork[len(s.chainWork)-1])
+}
+
+// GetBlockLocator returns the hashes of the last blocks one by one then exponentially spaced, it ends with the
+// empty hash standing for the genesis so a peer can always find a common ancestor with its own chain
+func (s *FromFileState) GetBlockLocator() []Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	locator := make([]Hash, 0)
+	step := 1
+	for height := len(s.blocks); height > 0; height -= step {
+		locator = append(locator, s.blocks[height-1].Hash)
+		if len(locator) >= DifficultyRetargetInterval {
+			step *= 2
+		}
+	}
+	return append(locator, Hash{})
+}
+
+func (s *FromFileState) Add(tx Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.applyTx(tx)
+}
+
+func (s *FromFileState) AddBlock(block Block) ([]Transaction, error) {
+	blockHash, err := block.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("AddBlock: failed to get block hash: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a block we already know about, either on the main chain or on a competing branch
+	if _, ok := s.heights[blockHash]; ok {
+		return nil, nil
+	}
+	if _, ok := s.sideBlocks[blockHash]; ok {
+		return nil, nil
+	}
+
+	// refuse any block which hasn't been sealed, wherever it's added in the chain
+	if err = checkBlock(block, utils.DefaultTimeService.UnixUint64()); err != nil {
+		return nil, fmt.Errorf("AddBlock: %w", newRejectedBlockError(block, blockHash, err))
+	}
+	if err = s.engine.VerifySeal(block.Header, blockHash); err != nil {
+		return nil, fmt.Errorf("AddBlock: %w", newRejectedBlockError(block, blockHash, err))
+	}
+
+	// the block doesn't extend our latest block, it belongs to a competing branch
+	if !CompareBlockHash(s.latestBlockHash, block.Header.Parent) {
+		orphanedTxs, err := s.addSideBlock(block, blockHash)
+		if err != nil {
+			return nil, fmt.Errorf("AddBlock: %w", err)
+		}
+		return orphanedTxs, nil
+	}
+
 	// as we use the transaction pool to persist transactions, we have two choices here
 	// either we force a flush by persisting every pending transaction or we copy the state,
 	// we block the state until sync is done and then we re-establish the state and accept
@@ -147,105 +527,461 @@ func (s *FromFileState) AddBlock(block Block) error {
 
 	// TODO: create benchmark
 	// our state is a pointer so we need to copy its value
-	var copiedStateFromFile FromFileState
-	err := copier.CopyWithOption(&copiedStateFromFile, s, copier.Option{DeepCopy: true})
-	if err != nil {
-		return fmt.Errorf("AddBlock: failed to copy the state: %w", err)
-	}
+	// the maps are copied by hand, a struct copy would share them with the original state
+	copiedStateFromFile := s.copy()
 
 	// validate the block
 	err = copiedStateFromFile.applyBlock(block)
 	if err != nil {
-		return fmt.Errorf("AddBlock: failed to apply the block: %w", err)
+		return nil, fmt.Errorf("AddBlock: failed to apply the block: %w", newRejectedBlockError(block, blockHash, err))
 	}
 
 	// create a blockFS, ready to be added to the state
-	blockHash, err := block.Hash()
-	if err != nil {
-		return fmt.Errorf("AddBlock: failed to get block hash: %w", err)
-	}
-
 	blockDB := BlockDB{
 		Hash:  blockHash,
 		Block: block,
 	}
-	err = s.persistBlockToDB(blockDB)
+	err = s.storage.AppendBlock(blockDB, copiedStateFromFile.balances)
 	if err != nil {
-		return fmt.Errorf("AddBlock: failed to persist the block: %w", err)
+		return nil, fmt.Errorf("AddBlock: failed to persist the block: %w", err)
 	}
 
 	// now the blocks have been written in the DB
 	// the state (copy) balance has been updated each time a block has been inserted
 	// in the database. As no error happened during the writing process, we
 	// then need to update the state (original).
-	s.balances = copiedStateFromFile.Balances()
-	s.latestBlock = block
-	s.latestBlockHash = blockHash
+	balances := s.balances
+	s.balances = copiedStateFromFile.balances
+	s.nonces = copiedStateFromFile.nonces
+	s.appendBlock(blockDB)
+	s.pruneSideBlocks()
+
+	s.notifyNewHead(blockDB, changedBalances(balances, s.balances))
+	return nil, nil
+}
+
+// addSideBlock keeps a block of a competing branch and switches to this branch
+// if it has accumulated more proof of work than the main chain
+func (s *FromFileState) addSideBlock(block Block, blockHash Hash) ([]Transaction, error) {
+	branch, ancestorHeight, err := s.getBranch(block)
+	if err != nil {
+		return nil, fmt.Errorf("addSideBlock: %w", newRejectedBlockError(block, blockHash, err))
+	}
+	if ancestorHeight+MaxSideBlockDepth < s.latestBlock.Header.Height {
+		return nil, fmt.Errorf("addSideBlock: %w", newRejectedBlockError(block, blockHash, ErrSideBlockTooDeep))
+	}
+
+	// the header is checked against the branch it extends before the block is kept, the blocks
+	// already kept have been checked the same way so the height of the parent can be trusted
+	parentChain := s.branchChain(ancestorHeight, branch[:len(branch)-1])
+	if block.Header.Height != ancestorHeight+uint64(len(branch)) {
+		return nil, fmt.Errorf("addSideBlock: %w", newRejectedBlockError(block, blockHash, ErrNextBlockHeight))
+	}
+	if block.Header.Time <= medianTimePast(parentChain.headers) {
+		return nil, fmt.Errorf("addSideBlock: %w", newRejectedBlockError(block, blockHash, ErrBlockTimeTooOld))
+	}
+	if err = s.engine.VerifyHeader(parentChain, block.Header); err != nil {
+		return nil, fmt.Errorf("addSideBlock: %w", newRejectedBlockError(block, blockHash, err))
+	}
+
+	branchWork := big.NewInt(0)
+	if ancestorHeight > 0 {
+		branchWork.Set(s.chainWork[ancestorHeight-1])
+	}
+	for _, b := range branch {
+		branchWork.Add(branchWork, s.engine.BlockWeight(b.Header))
+	}
+
+	// the weakest competing branch makes room for the block
+	if len(s.sideBlocks) >= MaxSideBlocks {
+		if err = s.evictSideBlock(branch, branchWork); err != nil {
+			return nil, fmt.Errorf("addSideBlock: %w", newRejectedBlockError(block, blockHash, err))
+		}
+	}
+	s.sideBlocks[blockHash] = block
+
+	if !s.engine.SelectFork(s.totalWork(), branchWork) {
+		Logger.Debugf("addSideBlock: block %s kept on a competing branch forked at height %d", blockHash.Hex(), ancestorHeight)
+		return nil, nil
+	}
+
+	orphanedTxs, err := s.reorganise(ancestorHeight, branch)
+	if err != nil {
+		return nil, fmt.Errorf("addSideBlock: %w", err)
+	}
+	return orphanedTxs, nil
+}
+
+// getBranch walks back the competing branch of a block until it reaches the main chain
+// it returns the branch ordered by height as well as the height of the common ancestor
+func (s *FromFileState) getBranch(block Block) ([]Block, uint64, error) {
+	branch := []Block{block}
+	parent := block.Header.Parent
+	for {
+		if parent == (Hash{}) {
+			return branch, 0, nil
+		}
+		if height, ok := s.heights[parent]; ok {
+			return branch, height, nil
+		}
+
+		parentBlock, ok := s.sideBlocks[parent]
+		if !ok {
+			return nil, 0, fmt.Errorf("getBranch: %w", ErrNextBlockHash)
+		}
+		branch = append([]Block{parentBlock}, branch...)
+		parent = parentBlock.Header.Parent
+	}
+}
 
+// branchChain returns the main chain up to the common ancestor followed by the blocks of the branch
+func (s *FromFileState) branchChain(ancestorHeight uint64, branch []Block) chainSnapshot {
+	chain := chainSnapshot{
+		headers: make([]BlockHeader, ancestorHeight, ancestorHeight+uint64(len(branch))),
+		blocks:  make([]BlockDB, ancestorHeight, ancestorHeight+uint64(len(branch))),
+	}
+	copy(chain.headers, s.headers[:ancestorHeight])
+	copy(chain.blocks, s.blocks[:ancestorHeight])
+	for _, block := range branch {
+		blockHash, _ := block.Hash()
+		chain.headers = append(chain.headers, block.Header)
+		chain.blocks = append(chain.blocks, BlockDB{Hash: blockHash, Block: block})
+	}
+	return chain
+}
+
+// pruneSideBlocks forgets the blocks of the competing branches forking too far below the latest block
+// to ever win as well as the blocks whose branch doesn't reach the main chain anymore
+func (s *FromFileState) pruneSideBlocks() {
+	ancestors, works := s.sideBranches()
+	for hash := range s.sideBlocks {
+		if works[hash] == nil || ancestors[hash]+MaxSideBlockDepth < s.latestBlock.Header.Height {
+			delete(s.sideBlocks, hash)
+		}
+	}
+}
+
+// evictSideBlock forgets the tip of the competing branch with the least work, the branch of the
+// block to keep is left untouched and nothing is forgotten if every other branch has more work
+func (s *FromFileState) evictSideBlock(branch []Block, branchWork *big.Int) error {
+	_, works := s.sideBranches()
+
+	// the tips are the blocks no other block of the competing branches builds upon
+	tips := make(map[Hash]struct{}, len(s.sideBlocks))
+	for hash := range s.sideBlocks {
+		tips[hash] = struct{}{}
+	}
+	for _, block := range s.sideBlocks {
+		delete(tips, block.Header.Parent)
+	}
+	for _, block := range branch {
+		blockHash, _ := block.Hash()
+		delete(tips, blockHash)
+	}
+
+	var weakest Hash
+	var weakestWork *big.Int
+	for hash := range tips {
+		work := works[hash]
+		if work == nil {
+			// a block whose branch doesn't reach the main chain can't win
+			weakest, weakestWork = hash, big.NewInt(0)
+			break
+		}
+		if weakestWork == nil || work.Cmp(weakestWork) < 0 {
+			weakest, weakestWork = hash, work
+		}
+	}
+	if weakestWork == nil || weakestWork.Cmp(branchWork) >= 0 {
+		return fmt.Errorf("evictSideBlock: %w", ErrSideBlocksFull)
+	}
+
+	Logger.Debugf("evictSideBlock: block %s of a competing branch forgotten", weakest.Hex())
+	delete(s.sideBlocks, weakest)
 	return nil
 }
 
-func (s *FromFileState) AddBlocks(blocks []Block) error {
-	for _, block := range blocks {
-		err := s.AddBlock(block)
+// sideBranches returns, for each block of the competing branches, the height of the main chain block
+// its branch forks from and the work accumulated by the branch up to the block
+// the work is nil for the blocks whose branch doesn't reach the main chain anymore
+func (s *FromFileState) sideBranches() (map[Hash]uint64, map[Hash]*big.Int) {
+	ancestors := make(map[Hash]uint64, len(s.sideBlocks))
+	works := make(map[Hash]*big.Int, len(s.sideBlocks))
+
+	var walk func(hash Hash, block Block) *big.Int
+	walk = func(hash Hash, block Block) *big.Int {
+		if work, ok := works[hash]; ok {
+			return work
+		}
+
+		work := big.NewInt(0)
+		parent := block.Header.Parent
+		if height, ok := s.heights[parent]; ok {
+			ancestors[hash] = height
+			work.Set(s.chainWork[height-1])
+		} else if parent == (Hash{}) {
+			ancestors[hash] = 0
+		} else {
+			parentBlock, ok := s.sideBlocks[parent]
+			if !ok || walk(parent, parentBlock) == nil {
+				works[hash] = nil
+				return nil
+			}
+			ancestors[hash] = ancestors[parent]
+			work.Set(works[parent])
+		}
+		works[hash] = work.Add(work, s.engine.BlockWeight(block.Header))
+		return works[hash]
+	}
+	for hash, block := range s.sideBlocks {
+		walk(hash, block)
+	}
+	return ancestors, works
+}
+
+// reorganise replaces the blocks of the main chain above the common ancestor by the branch
+// it returns the transactions of the replaced blocks which haven't been included in the branch
+func (s *FromFileState) reorganise(ancestorHeight uint64, branch []Block) ([]Transaction, error) {
+	// roll back the balances and nonces to the common ancestor by undoing the blocks above it
+	rebuiltState := s.copy()
+	rebuiltState.rollback(ancestorHeight)
+
+	// then replay the new branch, the blocks have never been validated so far
+	branchTxs := make(map[TransactionId]struct{})
+	for i, block := range branch {
+		blockHash, err := block.Hash()
 		if err != nil {
-			return fmt.Errorf("AddBlocks: %w", err)
+			return nil, fmt.Errorf("reorganise: failed to get block hash: %w", err)
+		}
+		if err = rebuiltState.applyBlock(block); err != nil {
+			// the invalid block and its descendants can't become part of the main chain
+			for _, invalidBlock := range branch[i:] {
+				invalidBlockHash, _ := invalidBlock.Hash()
+				delete(s.sideBlocks, invalidBlockHash)
+			}
+			return nil, fmt.Errorf("reorganise: failed to apply the branch: %w", newRejectedBlockError(block, blockHash, err))
+		}
+		rebuiltState.appendBlock(BlockDB{Hash: blockHash, Block: block})
+
+		for _, tx := range block.Txs {
+			txHash, _ := tx.Hash()
+			branchTxs[txHash] = struct{}{}
 		}
 	}
-	return nil
+
+	// rewrite the database with the new main chain
+	if err := s.storage.ReplaceBlocks(rebuiltState.blocks, rebuiltState.balances); err != nil {
+		return nil, fmt.Errorf("reorganise: %w", err)
+	}
+
+	// the replaced blocks are now part of a competing branch
+	orphanedBlocks := s.blocks[ancestorHeight:]
+	orphanedTxs := make([]Transaction, 0)
+	for _, blockDB := range orphanedBlocks {
+		s.sideBlocks[blockDB.Hash] = blockDB.Block
+		for _, tx := range blockDB.Block.Txs {
+			txHash, _ := tx.Hash()
+			if _, ok := branchTxs[txHash]; !ok {
+				orphanedTxs = append(orphanedTxs, tx)
+			}
+		}
+	}
+	for _, blockDB := range rebuiltState.blocks[ancestorHeight:] {
+		delete(s.sideBlocks, blockDB.Hash)
+	}
+
+	balances := s.balances
+	s.balances = rebuiltState.balances
+	s.nonces = rebuiltState.nonces
+	s.blocks = rebuiltState.blocks
+	s.headers = rebuiltState.headers
+	s.chainWork = rebuiltState.chainWork
+	s.heights = rebuiltState.heights
+	s.txHeights = rebuiltState.txHeights
+	s.accountTxs = rebuiltState.accountTxs
+	s.latestBlock = rebuiltState.latestBlock
+	s.latestBlockHash = rebuiltState.latestBlockHash
+	s.pruneSideBlocks()
+
+	Logger.Infof("reorganise: chain reorganised at height %d, %d block(s) replaced by %d block(s)", ancestorHeight, len(orphanedBlocks), len(branch))
+
+	newHeads := s.blocks[ancestorHeight:]
+	for i, blockDB := range newHeads {
+		if i < len(newHeads)-1 {
+			s.notifyNewHead(blockDB, map[Account]uint{})
+			continue
+		}
+		s.notifyNewHead(blockDB, changedBalances(balances, s.balances))
+	}
+	return orphanedTxs, nil
 }
 
-func (s *FromFileState) Persist() (Hash, error) {
-	hash := Hash{}
+// rollback undoes the blocks of the main chain above the height, the indexes are copied beforehand
+// so the state the copy has been made from is left untouched
+func (s *FromFileState) rollback(height uint64) {
+	for i := len(s.blocks) - 1; i >= int(height); i-- {
+		s.undoBlockTxs(s.blocks[i].Block)
+	}
 
-	// create a new Block only with the new transactions
-	block := NewBlock(
-		s.latestBlockHash,
-		s.latestBlock.Header.Height+1,
-		0,
-		utils.DefaultTimeService.UnixUint64(),
-		s.transactionsPool,
-	)
-	// generate block hash
-	blockHash, err := block.Hash()
-	if err != nil {
-		return hash, fmt.Errorf("Persist: failed to get block hash: %w", err)
+	s.blocks = s.blocks[:height:height]
+	s.headers = s.headers[:height:height]
+	s.chainWork = s.chainWork[:height:height]
+
+	heights := make(map[Hash]uint64, len(s.heights))
+	for hash, h := range s.heights {
+		if h <= height {
+			heights[hash] = h
+		}
+	}
+	txHeights := make(map[TransactionId]uint64, len(s.txHeights))
+	for txHash, h := range s.txHeights {
+		if h <= height {
+			txHeights[txHash] = h
+		}
+	}
+	accountTxs := make(map[Account][]accountTxRef, len(s.accountTxs))
+	for account, refs := range s.accountTxs {
+		n := sort.Search(len(refs), func(i int) bool {
+			return refs[i].height > height
+		})
+		if n > 0 {
+			accountTxs[account] = refs[:n:n]
+		}
 	}
+	s.heights, s.txHeights, s.accountTxs = heights, txHeights, accountTxs
 
-	// create database block which includes its hash and the transactions (block itself)
-	blockDB := BlockDB{blockHash, block}
-	err = s.persistBlockToDB(blockDB)
-	if err != nil {
-		return blockHash, fmt.Errorf("Persist: failed to persist the block: %w", err)
+	s.latestBlockHash, s.latestBlock = Hash{}, Block{}
+	if height > 0 {
+		s.latestBlockHash = s.blocks[height-1].Hash
+		s.latestBlock = s.blocks[height-1].Block
 	}
+}
 
-	// latest block of the state is now the hash of the latest block inserted into the database
-	s.latestBlockHash = blockHash
-	s.latestBlock = blockDB.Block
+// undoBlockTxs reverts applyBlockTxs, the block has been applied so none of the amounts can overflow
+func (s *FromFileState) undoBlockTxs(block Block) {
+	if block.Header.Miner != "" {
+		reward := s.blockReward
+		for _, tx := range block.Txs {
+			reward += tx.Fee
+		}
+		s.balances[block.Header.Miner.normalize()] -= reward
+	}
+	for i := len(block.Txs) - 1; i >= 0; i-- {
+		tx := block.Txs[i]
+		from, to := tx.From.normalize(), tx.To.normalize()
+		s.balances[to] -= tx.Value
+		s.balances[from] += tx.Value + tx.Fee
+		s.nonces[from]--
+	}
+}
 
-	// empty the transactions pool as it should only transactions that haven't been written to database yet
-	s.transactionsPool = []Transaction{}
+// SubscribeNewHeads subscribe to the blocks added on top of the main chain
+func (s *FromFileState) SubscribeNewHeads() <-chan NewHeadEvent {
+	s.subscribers.mu.Lock()
+	defer s.subscribers.mu.Unlock()
 
-	return s.latestBlockHash, nil
+	subscriber := make(chan NewHeadEvent, NewHeadsSubscriptionSize)
+	s.subscribers.channels = append(s.subscribers.channels, subscriber)
+	return subscriber
 }
 
-func (s *FromFileState) persistBlockToDB(block BlockDB) error {
-	blockDBJson, err := json.Marshal(block)
-	if err != nil {
-		return fmt.Errorf("persistBlockToDB: failed to marshall the block: %w", err)
+// notifyNewHead lets the subscribers know about a new head, a slow subscriber must not block the state
+func (s *FromFileState) notifyNewHead(blockDB BlockDB, balances map[Account]uint) {
+	s.subscribers.mu.Lock()
+	defer s.subscribers.mu.Unlock()
+
+	for _, subscriber := range s.subscribers.channels {
+		select {
+		case subscriber <- NewHeadEvent{Block: blockDB, Balances: balances}:
+		default:
+			Logger.Warnf("notifyNewHead: subscriber is full, block %s not notified", blockDB.Hash.Hex())
+		}
 	}
+}
 
-	// add to the DB the new block as well as a new line
-	_, err = s.dbFile.Write(append(blockDBJson, '\n'))
-	if err != nil {
-		return fmt.Errorf("persistBlockToDB: failed to append block to file: %w", err)
+// changedBalances returns the balances which differ between before and after
+func changedBalances(before map[Account]uint, after map[Account]uint) map[Account]uint {
+	balances := make(map[Account]uint)
+	for account, balance := range after {
+		if before[account] != balance {
+			balances[account] = balance
+		}
 	}
-	return nil
+	for account := range before {
+		if _, ok := after[account]; !ok {
+			balances[account] = 0
+		}
+	}
+	return balances
+}
+
+// copy returns a copy of the state which can be modified without altering the original state
+func (s *FromFileState) copy() *FromFileState {
+	copiedState := &FromFileState{
+		chainId:         s.chainId,
+		genesisHash:     s.genesisHash,
+		blockReward:     s.blockReward,
+		engine:          s.engine,
+		genesisBalances: s.genesisBalances,
+		storage:         s.storage,
+		latestBlockHash: s.latestBlockHash,
+		latestBlock:     s.latestBlock,
+		blocks:          s.blocks,
+		headers:         s.headers,
+		chainWork:       s.chainWork,
+		heights:         s.heights,
+		txHeights:       s.txHeights,
+		accountTxs:      s.accountTxs,
+		sideBlocks:      s.sideBlocks,
+		subscribers:     s.subscribers,
+	}
+	copiedState.balances = make(map[Account]uint, len(s.balances))
+	for account, balance := range s.balances {
+		copiedState.balances[account] = balance
+	}
+	copiedState.nonces = make(map[Account]uint64, len(s.nonces))
+	for account, nonce := range s.nonces {
+		copiedState.nonces[account] = nonce
+	}
+	return copiedState
+}
+
+func (s *FromFileState) AddBlocks(blocks []Block) ([]Transaction, error) {
+	orphanedTxs := make([]Transaction, 0)
+	var err error
+	for _, block := range blocks {
+		var txs []Transaction
+		txs, err = s.AddBlock(block)
+		orphanedTxs = append(orphanedTxs, txs...)
+		if err != nil {
+			err = fmt.Errorf("AddBlocks: %w", err)
+			break
+		}
+	}
+
+	// a transaction orphaned by a reorganisation might have been included again by the following blocks
+	includedTxs := make(map[TransactionId]struct{})
+	for _, block := range blocks {
+		for _, tx := range block.Txs {
+			txHash, _ := tx.Hash()
+			includedTxs[txHash] = struct{}{}
+		}
+	}
+	txs := make([]Transaction, 0, len(orphanedTxs))
+	for _, tx := range orphanedTxs {
+		txHash, _ := tx.Hash()
+		if _, ok := includedTxs[txHash]; !ok {
+			txs = append(txs, tx)
+		}
+	}
+	return txs, err
 }
 
 // applyBlock checks if a block can be added to the database
 // also checks if the blocks which is trying to be added has previousBlock (or parentBlock)
 // is block.height == previousBlock.height + 1 and that its previousBlock.parentHash points to block.hash
+// the consensus fields and the time of the header must follow the previous blocks, the seal itself
+// is verified by the consensus engine before any block is added
 func (s *FromFileState) applyBlock(block Block) error {
 	if block.Header.Height != s.latestBlock.Header.Height+1 {
 		return fmt.Errorf("applyBlock: %w", ErrNextBlockHeight)
@@ -255,7 +991,119 @@ func (s *FromFileState) applyBlock(block Block) error {
 		return fmt.Errorf("applyBlock: %w", ErrNextBlockHash)
 	}
 
-	return s.applyTxs(block.Txs)
+	if _, err := NewAccount(string(block.Header.Miner)); err != nil {
+		return fmt.Errorf("applyBlock: %w", ErrBlockMinerMissing)
+	}
+
+	// the consensus fields are checked against the chain the block is added to
+	if err := s.engine.VerifyHeader(s.chain(), block.Header); err != nil {
+		return fmt.Errorf("applyBlock: %w", err)
+	}
+
+	if block.Header.Time <= s.medianTimePast() {
+		return fmt.Errorf("applyBlock: %w", ErrBlockTimeTooOld)
+	}
+
+	return s.applyBlockTxs(block)
+}
+
+// verifyBlock checks a stored block follows the main chain and applies it, the time of the header is not
+// checked as it depends on the clock the node had when the block was added
+func (s *FromFileState) verifyBlock(blockDB BlockDB) error {
+	block := blockDB.Block
+	blockHash, err := block.Hash()
+	if err != nil {
+		return fmt.Errorf("verifyBlock: failed to get block hash: %w", err)
+	}
+	if blockHash != blockDB.Hash {
+		return fmt.Errorf("verifyBlock: %w", ErrBlockHashMismatch)
+	}
+
+	if block.Header.Height != s.latestBlock.Header.Height+1 {
+		return fmt.Errorf("verifyBlock: %w", ErrNextBlockHeight)
+	}
+	if !CompareBlockHash(s.latestBlockHash, block.Header.Parent) {
+		return fmt.Errorf("verifyBlock: %w", ErrNextBlockHash)
+	}
+
+	txRoot, err := TxRoot(block.Txs)
+	if err != nil {
+		return fmt.Errorf("verifyBlock: %w", err)
+	}
+	if txRoot != block.Header.TxRoot {
+		return fmt.Errorf("verifyBlock: %w", ErrBlockTxRoot)
+	}
+	if err = s.engine.VerifySeal(block.Header, blockHash); err != nil {
+		return fmt.Errorf("verifyBlock: %w", err)
+	}
+	if err = s.engine.VerifyHeader(s.chain(), block.Header); err != nil {
+		return fmt.Errorf("verifyBlock: %w", err)
+	}
+
+	// the balances and nonces are replayed from the genesis, each transaction must be signed and affordable
+	if err = s.applyBlockTxs(block); err != nil {
+		return fmt.Errorf("verifyBlock: %w", err)
+	}
+	return nil
+}
+
+// medianTimePast returns the median time of the latest blocks of the chain
+func (s *FromFileState) medianTimePast() uint64 {
+	return medianTimePast(s.headers)
+}
+
+// medianTimePast returns the median time of the latest headers
+func medianTimePast(headers []BlockHeader) uint64 {
+	if len(headers) == 0 {
+		return 0
+	}
+
+	first := 0
+	if len(headers) > MedianTimeBlockCount {
+		first = len(headers) - MedianTimeBlockCount
+	}
+	times := make([]uint64, 0, MedianTimeBlockCount)
+	for _, header := range headers[first:] {
+		times = append(times, header.Time)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+func newRejectedBlockError(block Block, blockHash Hash, err error) error {
+	return &RejectedBlockError{
+		Hash:   blockHash,
+		Height: block.Header.Height,
+		Err:    err,
+	}
+}
+
+// applyBlockTxs applies the transactions of a block and credits its miner with the block reward
+// defined in the genesis file as well as the fees paid by the transactions
+func (s *FromFileState) applyBlockTxs(block Block) error {
+	if err := s.applyTxs(block.Txs); err != nil {
+		return err
+	}
+
+	// blocks persisted locally without being mined do not have any miner to reward
+	if block.Header.Miner == "" {
+		return nil
+	}
+
+	reward := s.blockReward
+	for _, tx := range block.Txs {
+		var err error
+		if reward, err = AddAmounts(reward, tx.Fee); err != nil {
+			return fmt.Errorf("applyBlockTxs: block reward: %w", err)
+		}
+	}
+	miner := block.Header.Miner.normalize()
+	balance, err := AddAmounts(s.balances[miner], reward)
+	if err != nil {
+		return fmt.Errorf("applyBlockTxs: miner balance: %w", err)
+	}
+	s.balances[miner] = balance
+	return nil
 }
 
 // applyTxs is a wrapper calling applyTx and propagate error if any
@@ -271,40 +1119,161 @@ func (s *FromFileState) applyTxs(txs []Transaction) error {
 // applyTx checks if a transaction can be added to the blockchain
 // also checks if the account has enough money as well as the transaction metadata is valid
 func (s *FromFileState) applyTx(tx Transaction) error {
+	// refuse the transaction if it's not meant for this chain or not signed by the sender
+	if tx.ChainId != s.chainId {
+		return fmt.Errorf("applyTx: %w", ErrTxChainIdMismatch)
+	}
+	if err := tx.VerifySignature(); err != nil {
+		return fmt.Errorf("applyTx: %w", err)
+	}
+	// refuse the transaction if its value would be credited to something else than an account
+	if _, err := NewAccount(string(tx.To)); err != nil {
+		return fmt.Errorf("applyTx: %w", ErrTxReceiverInvalid)
+	}
+
+	// the balances and nonces are kept by account whatever the case the transaction writes the accounts in
+	from, to := tx.From.normalize(), tx.To.normalize()
+
+	// refuse the transaction if it's a replay or if it doesn't follow the previous transaction of the account
+	nextNonce := s.nonces[from]
+	if tx.Nonce < nextNonce {
+		return fmt.Errorf("applyTx: %w", ErrTxNonceAlreadyUsed)
+	}
+	if tx.Nonce > nextNonce {
+		return fmt.Errorf("applyTx: %w", ErrTxNonceTooHigh)
+	}
+
+	// refuse the transaction if it's trying to mint, only the block reward credited to the miner can
 	if tx.Reason == SELF_REWARD {
-		// refuse the transaction if it's a self reward with different from/to address
-		if !tx.To.isSameAccount(tx.From) {
-			return errors.New("applyTx: to!=from accounts not allowed with self-reward reason")
-		}
-		s.balances[tx.To] += tx.Value
-		return nil
+		return fmt.Errorf("applyTx: %w", ErrTxSelfReward)
 	}
-	if tx.Value > s.balances[tx.From] {
+	cost, err := tx.Cost()
+	if err != nil {
+		return fmt.Errorf("applyTx: %w", err)
+	}
+	if cost > s.balances[from] {
 		return fmt.Errorf("applyTx: %w", ErrInsufficientBalance)
 	}
-	s.balances[tx.From] -= tx.Value
-	s.balances[tx.To] += tx.Value
+	s.balances[from] -= cost
+	balance, err := AddAmounts(s.balances[to], tx.Value)
+	if err != nil {
+		s.balances[from] += cost
+		return fmt.Errorf("applyTx: receiver balance: %w", err)
+	}
+	s.balances[to] = balance
+	s.nonces[from]++
 	return nil
 }
 
 func (s *FromFileState) Close() error {
-	return s.dbFile.Close()
+	return s.storage.Close()
 }
 
 func (s *FromFileState) GetLatestBlockHash() Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.latestBlockHash
 }
 
 func (s *FromFileState) GetLatestBlockHeight() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.latestBlock.Header.Height
 }
 
+func (s *FromFileState) GetBlockByHash(hash Hash) (BlockDB, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	height, ok := s.heights[hash]
+	if !ok {
+		return BlockDB{}, false
+	}
+	return s.blocks[height-1], true
+}
+
+func (s *FromFileState) GetBlockByHeight(height uint64) (BlockDB, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if height == 0 || height > uint64(len(s.blocks)) {
+		return BlockDB{}, false
+	}
+	return s.blocks[height-1], true
+}
+
+func (s *FromFileState) GetBlocksFromHeight(height uint64, limit uint64) []BlockDB {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if height == 0 || height > uint64(len(s.blocks)) {
+		return []BlockDB{}
+	}
+
+	last := height - 1 + limit
+	if last > uint64(len(s.blocks)) {
+		last = uint64(len(s.blocks))
+	}
+	blocks := make([]BlockDB, last-height+1)
+	copy(blocks, s.blocks[height-1:last])
+	return blocks
+}
+
+func (s *FromFileState) GetBlockByTxHash(txHash TransactionId) (BlockDB, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	height, ok := s.txHeights[txHash]
+	if !ok {
+		return BlockDB{}, false
+	}
+	return s.blocks[height-1], true
+}
+
+func (s *FromFileState) GetAccountTxs(account Account, filter AccountTxsFilter, offset uint64, limit uint64) []AccountTx {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// the backends keeping an account index serve the history from the disk, the index kept in memory answers otherwise
+	account = account.normalize()
+	accountTxs, isStored, err := s.storage.GetAccountTxs(account, filter, offset, limit)
+	if err != nil {
+		Logger.Errorf("GetAccountTxs: failed to read the stored account index: %s", err)
+	} else if isStored {
+		return accountTxs
+	}
+
+	refs := s.accountTxs[account]
+
+	// the references are sorted by height, skip the ones below the range
+	start := sort.Search(len(refs), func(i int) bool {
+		return refs[i].height >= filter.FromHeight
+	})
+
+	page := newAccountTxsPage(account, filter, offset, limit)
+	for _, ref := range refs[start:] {
+		if filter.ToHeight != 0 && ref.height > filter.ToHeight {
+			break
+		}
+		blockDB := s.blocks[ref.height-1]
+		if !page.add(blockDB.Hash, ref.height, blockDB.Block.Txs[ref.index]) {
+			break
+		}
+	}
+	return page.txs
+}
+
 func (s *FromFileState) Print() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	Logger.Infof("#####################")
 	Logger.Infof("# Accounts balances #")
 	Logger.Infof("#####################")
-	Logger.Infof("State: %x", s.GetLatestBlockHash())
-	Logger.Infof("Height: %x", s.GetLatestBlockHeight())
+	Logger.Infof("State: %x", s.latestBlockHash)
+	Logger.Infof("Height: %x", s.latestBlock.Header.Height)
 	Logger.Infof("---------------------")
 	for account, balance := range s.balances {
 		Logger.Infof("%s: %d", account, balance)
@@ -0,0 +1,584 @@
+package models
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+func init() {
+	test.InitTestContext()
+}
+
+func TestFromFileState_AddBlock_Reorganisation(t *testing.T) {
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+	receiverA := Account("0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf")
+	receiverB := Account("0x7b65a12633dbe9a413b17db515732d69e684ebe2")
+	miner := Account("0x01fc1af4a56cde68675dc44cabd486e8d3559f07")
+
+	state, dbFilePath := newTestState(t, sender, 1000)
+	bits := nextBlockBits(t, state)
+
+	newBlock := func(parent Block, txs ...Transaction) Block {
+		return mineTestBlock(parent, bits, uint64(parent.Header.Height+1), miner, txs...)
+	}
+	txA := newTestTx(senderKey, sender, receiverA, 1)
+	txB := newTestTx(senderKey, sender, receiverB, 1)
+
+	// main chain: block1 <- block2A
+	block1 := newBlock(Block{}, newTestTx(senderKey, sender, receiverA, 0))
+	block2A := newBlock(block1, txA)
+	if _, err := state.AddBlocks([]Block{block1, block2A}); err != nil {
+		t.Fatalf("AddBlocks() error = %v", err)
+	}
+
+	// competing branch: block1 <- block2B <- block3B
+	block2B := newBlock(block1, txB)
+	block3B := newBlock(block2B)
+
+	orphanedTxs, err := state.AddBlock(block2B)
+	if err != nil || len(orphanedTxs) != 0 {
+		t.Fatalf("AddBlock() competing block with the same work should be kept aside, orphaned = %v, error = %v", orphanedTxs, err)
+	}
+	if latestHash, _ := block2A.Hash(); state.GetLatestBlockHash() != latestHash {
+		t.Errorf("GetLatestBlockHash() should still be the first block seen at height 2")
+	}
+
+	orphanedTxs, err = state.AddBlock(block3B)
+	if err != nil {
+		t.Fatalf("AddBlock() error = %v", err)
+	}
+	if latestHash, _ := block3B.Hash(); state.GetLatestBlockHash() != latestHash {
+		t.Errorf("GetLatestBlockHash() should be the latest block of the heaviest branch")
+	}
+	if len(orphanedTxs) != 1 || orphanedTxs[0].To != receiverA {
+		t.Errorf("AddBlock() orphaned = %v, want the transaction of the replaced block", orphanedTxs)
+	}
+	if state.GetBalance(receiverB) != 10 || state.GetBalance(receiverA) != 10 {
+		t.Errorf("Balances() = %v, want balances replayed on the heaviest branch", state.Balances())
+	}
+	if state.GetNextNonce(sender) != 2 {
+		t.Errorf("GetNextNonce() = %d, want 2", state.GetNextNonce(sender))
+	}
+	if count := countDBBlocks(t, dbFilePath); count != 3 {
+		t.Errorf("database contains %d blocks, want 3", count)
+	}
+	if accountTxs := state.GetAccountTxs(receiverA, AccountTxsFilter{}, 0, 10); len(accountTxs) != 1 || accountTxs[0].BlockHeight != 1 {
+		t.Errorf("GetAccountTxs() = %v, want the transactions of the replaced block removed from the history", accountTxs)
+	}
+	if accountTxs := state.GetAccountTxs(receiverB, AccountTxsFilter{Direction: TX_DIRECTION_IN}, 0, 10); len(accountTxs) != 1 || accountTxs[0].BlockHeight != 2 {
+		t.Errorf("GetAccountTxs() = %v, want the transactions of the heaviest branch", accountTxs)
+	}
+
+	// a block whose parent is unknown belongs to no branch
+	if _, err = state.AddBlock(newBlock(newBlock(block2A))); !errors.Is(err, ErrNextBlockHash) {
+		t.Errorf("AddBlock() with an unknown parent error = %v, want %v", err, ErrNextBlockHash)
+	}
+}
+
+func TestFromFileState_AddBlock_Validation(t *testing.T) {
+	// define variables
+	miner := Account("0x01fc1af4a56cde68675dc44cabd486e8d3559f07")
+	state, _ := newTestState(t, miner, 0)
+	bits := nextBlockBits(t, state)
+
+	block1 := mineTestBlock(Block{}, bits, 10, miner)
+	block2 := mineTestBlock(block1, bits, 20, miner)
+	if _, err := state.AddBlocks([]Block{block1, block2}); err != nil {
+		t.Fatalf("AddBlocks() error = %v", err)
+	}
+
+	block2Hash, _ := block2.Hash()
+	unminedBlock := NewBlock(block2Hash, 3, bits, 0, 30, miner, nil)
+	for hash, _ := unminedBlock.Hash(); HashMeetsTarget(hash, bits); hash, _ = unminedBlock.Hash() {
+		unminedBlock.Header.Nonce++
+	}
+
+	tests := []struct {
+		name    string
+		block   Block
+		wantErr error
+	}{
+		{
+			name:    "adding a block whose hash doesn't meet its target should return error",
+			block:   unminedBlock,
+			wantErr: ErrBlockProofOfWork,
+		},
+		{
+			name:    "adding a block with another difficulty than the expected one should return error",
+			block:   mineTestBlock(block2, ComplexityToBits(1), 30, miner),
+			wantErr: ErrBlockDifficulty,
+		},
+		{
+			name:    "adding a block older than the median time of the previous blocks should return error",
+			block:   mineTestBlock(block2, bits, 5, miner),
+			wantErr: ErrBlockTimeTooOld,
+		},
+		{
+			name:    "adding a block too far in the future should return error",
+			block:   mineTestBlock(block2, bits, utils.DefaultTimeService.UnixUint64()+MaxBlockTimeDriftInSeconds+60, miner),
+			wantErr: ErrBlockTimeTooNew,
+		},
+		{
+			name:    "adding a valid block should be accepted",
+			block:   mineTestBlock(block2, bits, 30, miner),
+			wantErr: nil,
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := state.AddBlock(tt.block)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("AddBlock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var rejectedBlockError *RejectedBlockError
+			if tt.wantErr != nil && (!errors.As(err, &rejectedBlockError) || rejectedBlockError.Height != 3) {
+				t.Errorf("AddBlock() error = %v, want a rejected block error", err)
+			}
+		})
+	}
+}
+
+func TestFromFileState_Add_Accounts(t *testing.T) {
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+	lowerCaseSender := Account(strings.ToLower(string(sender)))
+	receiver := Account("0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf")
+	state, _ := newTestState(t, lowerCaseSender, 1000)
+
+	// the accounts are kept in their checksummed form whatever the case the genesis and the transactions write them in
+	if err := state.Add(newTestTx(senderKey, lowerCaseSender, receiver, 0)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := state.Add(newTestTx(senderKey, sender, receiver, 1)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	balances := state.Balances()
+	if balances[sender] != 980 || balances[receiver.normalize()] != 20 || len(balances) != 2 {
+		t.Errorf("Balances() = %v, want the balances kept by checksummed account", balances)
+	}
+	if state.GetNextNonce(lowerCaseSender) != 2 || state.GetBalance(receiver) != 20 {
+		t.Errorf("GetNextNonce() = %d, GetBalance() = %d, want 2, 20 whatever the case of the account", state.GetNextNonce(lowerCaseSender), state.GetBalance(receiver))
+	}
+
+	// the value of a transaction can't be credited to something else than an account
+	if err := state.Add(newTestTx(senderKey, sender, "not-an-account", 2)); !errors.Is(err, ErrTxReceiverInvalid) {
+		t.Errorf("Add() error = %v, want %v", err, ErrTxReceiverInvalid)
+	}
+}
+
+func TestFromFileState_AddBlock_SideBlocks(t *testing.T) {
+	// define variables
+	miner := Account("0x01fc1af4a56cde68675dc44cabd486e8d3559f07")
+	state, _ := newTestState(t, miner, 0)
+
+	block1 := mineTestBlock(Block{}, nextBlockBits(t, state), 5, miner)
+	block2A := mineTestBlock(block1, nextBlockBits(t, state), 10, miner)
+	if _, err := state.AddBlocks([]Block{block1, block2A}); err != nil {
+		t.Fatalf("AddBlocks() error = %v", err)
+	}
+
+	// a block of a competing branch with another difficulty than the expected one is not kept
+	if _, err := state.AddBlock(mineTestBlock(block1, ComplexityToBits(1), 10, miner)); !errors.Is(err, ErrBlockDifficulty) {
+		t.Errorf("AddBlock() error = %v, want %v", err, ErrBlockDifficulty)
+	}
+	if len(state.sideBlocks) != 0 {
+		t.Errorf("AddBlock() kept %d blocks on competing branches, want 0", len(state.sideBlocks))
+	}
+	// a block of a competing branch claiming another height than the one following its parent is not kept
+	wrongHeightBlock := mineTestBlock(block1, block2A.Header.Bits, 11, miner)
+	wrongHeightBlock.Header.Height = MaxSideBlockDepth + 10
+	if _, err := state.AddBlock(sealTestBlock(wrongHeightBlock)); !errors.Is(err, ErrNextBlockHeight) {
+		t.Errorf("AddBlock() error = %v, want %v", err, ErrNextBlockHeight)
+	}
+	// a block of a competing branch not later than the median time of its branch is not kept
+	if _, err := state.AddBlock(mineTestBlock(block1, block2A.Header.Bits, block1.Header.Time, miner)); !errors.Is(err, ErrBlockTimeTooOld) {
+		t.Errorf("AddBlock() error = %v, want %v", err, ErrBlockTimeTooOld)
+	}
+	if len(state.sideBlocks) != 0 {
+		t.Errorf("AddBlock() kept %d blocks on competing branches, want 0", len(state.sideBlocks))
+	}
+	block2B := mineTestBlock(block1, block2A.Header.Bits, 11, miner)
+	if _, err := state.AddBlock(block2B); err != nil {
+		t.Fatalf("AddBlock() error = %v", err)
+	}
+
+	// the competing branches too far below the latest block are forgotten then refused
+	latestBlock := block2A
+	for height := uint64(3); height <= MaxSideBlockDepth+3; height++ {
+		latestBlock = mineTestBlock(latestBlock, nextBlockBits(t, state), height*5, miner)
+		if _, err := state.AddBlock(latestBlock); err != nil {
+			t.Fatalf("AddBlock() error = %v", err)
+		}
+	}
+	if len(state.sideBlocks) != 0 {
+		t.Errorf("AddBlock() kept %d blocks on competing branches, want 0", len(state.sideBlocks))
+	}
+	if _, err := state.AddBlock(mineTestBlock(block1, block2A.Header.Bits, 12, miner)); !errors.Is(err, ErrSideBlockTooDeep) {
+		t.Errorf("AddBlock() error = %v, want %v", err, ErrSideBlockTooDeep)
+	}
+}
+
+func TestFromFileState_AddBlock_SideBlocksEviction(t *testing.T) {
+	// define variables
+	miner := Account("0x01fc1af4a56cde68675dc44cabd486e8d3559f07")
+	state, _ := newTestState(t, miner, 0)
+
+	block1 := mineTestBlock(Block{}, nextBlockBits(t, state), 5, miner)
+	block2A := mineTestBlock(block1, nextBlockBits(t, state), 10, miner)
+	if _, err := state.AddBlocks([]Block{block1, block2A}); err != nil {
+		t.Fatalf("AddBlocks() error = %v", err)
+	}
+
+	// fill the competing branches with blocks as heavy as the latest block
+	bits := block2A.Header.Bits
+	var siblings []Block
+	for i := 0; i < MaxSideBlocks; i++ {
+		sibling := mineTestBlock(block1, bits, uint64(11+i), miner)
+		if _, err := state.AddBlock(sibling); err != nil {
+			t.Fatalf("AddBlock() error = %v", err)
+		}
+		siblings = append(siblings, sibling)
+	}
+
+	// a block which doesn't bring more work than the weakest competing branch is refused
+	if _, err := state.AddBlock(mineTestBlock(block1, bits, uint64(11+MaxSideBlocks), miner)); !errors.Is(err, ErrSideBlocksFull) {
+		t.Errorf("AddBlock() error = %v, want %v", err, ErrSideBlocksFull)
+	}
+
+	// a heavier block takes the room of the weakest competing branch then wins
+	block3 := mineTestBlock(siblings[0], bits, uint64(12+MaxSideBlocks), miner)
+	if _, err := state.AddBlock(block3); err != nil {
+		t.Fatalf("AddBlock() error = %v", err)
+	}
+	block3Hash, _ := block3.Hash()
+	if state.latestBlockHash != block3Hash {
+		t.Errorf("AddBlock() latest block = %s, want %s", state.latestBlockHash.Hex(), block3Hash.Hex())
+	}
+	if len(state.sideBlocks) != MaxSideBlocks-1 {
+		t.Errorf("AddBlock() kept %d blocks on competing branches, want %d", len(state.sideBlocks), MaxSideBlocks-1)
+	}
+}
+
+func TestFromFileState_SubscribeNewHeads(t *testing.T) {
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+	receiver := Account("0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf")
+	miner := Account("0x01fc1af4a56cde68675dc44cabd486e8d3559f07")
+
+	state, _ := newTestState(t, sender, 1000)
+	bits := nextBlockBits(t, state)
+	newHeads := state.SubscribeNewHeads()
+
+	// a block extending the main chain is notified with the balances it has changed
+	block1 := mineTestBlock(Block{}, bits, 1, miner, newTestTx(senderKey, sender, receiver, 0))
+	if _, err := state.AddBlock(block1); err != nil {
+		t.Fatalf("AddBlock() error = %v", err)
+	}
+	event := <-newHeads
+	if block1Hash, _ := block1.Hash(); event.Block.Hash != block1Hash {
+		t.Errorf("SubscribeNewHeads() block = %s, want %s", event.Block.Hash.Hex(), block1Hash.Hex())
+	}
+	// the balances are kept by account in its checksummed form, whatever the case the blocks write it in
+	if event.Balances[sender] != 990 || event.Balances[receiver.normalize()] != 10 || event.Balances[miner.normalize()] != 50 {
+		t.Errorf("SubscribeNewHeads() balances = %v, want the balances changed by the block", event.Balances)
+	}
+
+	// a known block and a block kept on a competing branch are not notified
+	block2A := mineTestBlock(block1, bits, 2, miner)
+	block2B := mineTestBlock(block1, bits, 3, miner, newTestTx(senderKey, sender, receiver, 1))
+	block3B := mineTestBlock(block2B, bits, 4, miner)
+	if _, err := state.AddBlocks([]Block{block2A, block1, block2B}); err != nil {
+		t.Fatalf("AddBlocks() error = %v", err)
+	}
+	<-newHeads
+	if len(newHeads) != 0 {
+		t.Fatalf("SubscribeNewHeads() received %d unexpected blocks", len(newHeads))
+	}
+
+	// a reorganisation notifies each block of the new branch, the balances come with the latest one
+	if _, err := state.AddBlock(block3B); err != nil {
+		t.Fatalf("AddBlock() error = %v", err)
+	}
+	if event = <-newHeads; len(event.Balances) != 0 {
+		t.Errorf("SubscribeNewHeads() balances = %v, want no balances before the latest block of the branch", event.Balances)
+	}
+	if event = <-newHeads; event.Balances[receiver.normalize()] != 20 || event.Balances[miner.normalize()] != 150 {
+		t.Errorf("SubscribeNewHeads() balances = %v, want the balances changed by the reorganisation", event.Balances)
+	}
+}
+
+func TestFromFileState_ConcurrentAccess(t *testing.T) {
+	// define variables
+	miner := Account("0x01fc1af4a56cde68675dc44cabd486e8d3559f07")
+	state, _ := newTestState(t, miner, 1000)
+	bits := nextBlockBits(t, state)
+
+	// the state is read while blocks are added and the chain is reorganised, run with -race to catch a missing lock
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = state.GetBalance(miner)
+			_ = state.Balances()
+			_ = state.GetBlockLocator()
+			_ = state.GetBlocksFromHeight(1, 10)
+			_ = state.GetTotalWork()
+		}
+	}()
+
+	block1 := mineTestBlock(Block{}, bits, 1, miner)
+	block2A := mineTestBlock(block1, bits, 2, miner)
+	block2B := mineTestBlock(block1, bits, 3, miner)
+	block3B := mineTestBlock(block2B, bits, 4, miner)
+	if _, err := state.AddBlocks([]Block{block1, block2A, block2B, block3B}); err != nil {
+		t.Fatalf("AddBlocks() error = %v", err)
+	}
+	<-done
+
+	if got := state.GetBalance(miner); got != 1150 {
+		t.Errorf("GetBalance() = %d, want %d", got, 1150)
+	}
+}
+
+func TestNewVerifiedStateFromStorage(t *testing.T) {
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+	receiver := Account("0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf")
+	miner := Account("0x01fc1af4a56cde68675dc44cabd486e8d3559f07")
+	bits := ComplexityToBits(1)
+
+	// a valid chain: block1 <- block2 <- block3
+	block1 := mineTestBlock(Block{}, bits, 1, miner, newTestTx(senderKey, sender, receiver, 0))
+	block2 := mineTestBlock(block1, bits, 2, miner, newTestTx(senderKey, sender, receiver, 1))
+	block3 := mineTestBlock(block2, bits, 3, miner)
+
+	toBlocksDB := func(blocks ...Block) []BlockDB {
+		blocksDB := make([]BlockDB, len(blocks))
+		for i, block := range blocks {
+			hash, _ := block.Hash()
+			blocksDB[i] = BlockDB{Hash: hash, Block: block}
+		}
+		return blocksDB
+	}
+
+	tests := []struct {
+		name       string
+		blocks     func() []BlockDB
+		wantErr    error
+		wantHeight uint64
+	}{
+		{
+			name:   "a valid chain should be loaded",
+			blocks: func() []BlockDB { return toBlocksDB(block1, block2, block3) },
+		},
+		{
+			name: "a block whose stored hash differs from its header should be reported",
+			blocks: func() []BlockDB {
+				blocks := toBlocksDB(block1, block2, block3)
+				blocks[1].Hash = blocks[2].Hash
+				return blocks
+			},
+			wantErr:    ErrBlockHashMismatch,
+			wantHeight: 2,
+		},
+		{
+			name: "a tampered transaction should be reported",
+			blocks: func() []BlockDB {
+				blocks := toBlocksDB(block1, block2, block3)
+				blocks[1].Block.Txs = []Transaction{blocks[1].Block.Txs[0]}
+				blocks[1].Block.Txs[0].Value = 1
+				return blocks
+			},
+			wantErr:    ErrBlockTxRoot,
+			wantHeight: 2,
+		},
+		{
+			name:       "a missing block should be reported at the block following it",
+			blocks:     func() []BlockDB { return toBlocksDB(block1, block3) },
+			wantErr:    ErrNextBlockHeight,
+			wantHeight: 3,
+		},
+		{
+			name: "a block which doesn't link to its parent should be reported",
+			blocks: func() []BlockDB {
+				orphan := mineTestBlock(block1, bits, 2, miner)
+				orphan.Header.Parent = Hash{1}
+				for hash, _ := orphan.Hash(); !HashMeetsTarget(hash, bits); hash, _ = orphan.Hash() {
+					orphan.Header.Nonce++
+				}
+				return toBlocksDB(block1, orphan)
+			},
+			wantErr:    ErrNextBlockHash,
+			wantHeight: 2,
+		},
+		{
+			name: "a block which hasn't been mined should be reported",
+			blocks: func() []BlockDB {
+				unmined := block2
+				for hash, _ := unmined.Hash(); HashMeetsTarget(hash, bits); hash, _ = unmined.Hash() {
+					unmined.Header.Nonce++
+				}
+				return toBlocksDB(block1, unmined)
+			},
+			wantErr:    ErrBlockProofOfWork,
+			wantHeight: 2,
+		},
+		{
+			name:       "a block with another difficulty than the expected one should be reported",
+			blocks:     func() []BlockDB { return toBlocksDB(block1, mineTestBlock(block1, ComplexityToBits(2), 2, miner)) },
+			wantErr:    ErrBlockDifficulty,
+			wantHeight: 2,
+		},
+		{
+			name: "a transaction the sender can't afford should be reported",
+			blocks: func() []BlockDB {
+				tx := NewTransaction(sender, receiver, 1000, 0, 1, "", 2, test.ChainId)
+				_ = tx.Sign(senderKey)
+				return toBlocksDB(block1, mineTestBlock(block1, bits, 2, miner, *tx))
+			},
+			wantErr:    ErrInsufficientBalance,
+			wantHeight: 2,
+		},
+		{
+			name: "a transaction whose fee wraps its cost around should be reported",
+			blocks: func() []BlockDB {
+				tx := NewTransaction(sender, receiver, 1000, math.MaxUint-999, 1, "", 2, test.ChainId)
+				_ = tx.Sign(senderKey)
+				return toBlocksDB(block1, mineTestBlock(block1, bits, 2, miner, *tx))
+			},
+			wantErr:    ErrAmountOverflow,
+			wantHeight: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, dbFilePath := newTestState(t, sender, 100)
+			_ = state.Close()
+
+			storage, err := NewFileStorage(dbFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer storage.Close()
+			for _, blockDB := range tt.blocks() {
+				if err = storage.AppendBlock(blockDB, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			genesisFilePath := filepath.Join(filepath.Dir(dbFilePath), "genesis.json")
+			verifiedState, err := NewVerifiedStateFromStorage(genesisFilePath, storage, NewProofOfWork(NewDifficulty(1, 5)))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("NewVerifiedStateFromStorage() error = %v", err)
+				}
+				if verifiedState.GetLatestBlockHeight() != 3 {
+					t.Errorf("GetLatestBlockHeight() = %d, want 3", verifiedState.GetLatestBlockHeight())
+				}
+				return
+			}
+
+			var rejectedBlockErr *RejectedBlockError
+			if !errors.As(err, &rejectedBlockErr) || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewVerifiedStateFromStorage() error = %v, want %v", err, tt.wantErr)
+			}
+			if rejectedBlockErr.Height != tt.wantHeight {
+				t.Errorf("NewVerifiedStateFromStorage() rejected block at height %d, want %d", rejectedBlockErr.Height, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func newTestState(t *testing.T, account Account, balance uint) (*FromFileState, string) {
+	dir := t.TempDir()
+	genesisFilePath := filepath.Join(dir, "genesis.json")
+	dbFilePath := filepath.Join(dir, "blocks.db")
+
+	genesis := fmt.Sprintf(`{"chain_id":"%s","block_reward":50,"balances":{"%s":%d}}`, test.ChainId, account, balance)
+	if err := os.WriteFile(genesisFilePath, []byte(genesis), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dbFilePath, []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromFile(genesisFilePath, dbFilePath, NewProofOfWork(NewDifficulty(0, 5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = state.Close() })
+	return state, dbFilePath
+}
+
+// nextBlockBits returns the bits the engine expects for the next block of the state
+func nextBlockBits(t *testing.T, state *FromFileState) uint32 {
+	header := BlockHeader{Height: state.GetLatestBlockHeight() + 1}
+	if err := state.PrepareHeader(&header); err != nil {
+		t.Fatal(err)
+	}
+	return header.Bits
+}
+
+// mineTestBlock creates a block on top of the parent with a hash meeting the target represented by bits
+func mineTestBlock(parent Block, bits uint32, time uint64, miner Account, txs ...Transaction) Block {
+	parentHash, _ := parent.Hash()
+	if parent.Header.Height == 0 {
+		parentHash = Hash{}
+	}
+
+	return sealTestBlock(NewBlock(parentHash, parent.Header.Height+1, bits, 0, time, miner, txs))
+}
+
+// sealTestBlock looks for a nonce giving the block a hash meeting the target of its header
+func sealTestBlock(block Block) Block {
+	for hash, _ := block.Hash(); !HashMeetsTarget(hash, block.Header.Bits); hash, _ = block.Hash() {
+		block.Header.Nonce++
+	}
+	return block
+}
+
+func newTestTx(key *ecdsa.PrivateKey, from Account, to Account, nonce uint64) Transaction {
+	tx := NewTransaction(from, to, 10, 0, nonce, "", nonce, test.ChainId)
+	_ = tx.Sign(key)
+	return *tx
+}
+
+func countDBBlocks(t *testing.T, dbFilePath string) int {
+	db, err := os.Open(dbFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(db)
+	for scanner.Scan() {
+		var blockDB BlockDB
+		if err = json.Unmarshal(scanner.Bytes(), &blockDB); err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	return count
+}
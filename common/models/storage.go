@@ -0,0 +1,343 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+const (
+	// FILE_STORAGE blocks appended as json lines to a file, the balances are replayed from the blocks
+	FILE_STORAGE = "file"
+	// BOLT_STORAGE blocks, height index, account index and balances stored in a bolt key-value database
+	BOLT_STORAGE = "bolt"
+
+	// tornRecordChunkSize bytes read at a time, from the end of the database, looking for the last complete record
+	tornRecordChunkSize = 4096
+)
+
+var ErrUnknownStorage = errors.New("storage backend is unknown")
+
+// Storage persists the main chain
+type Storage interface {
+	// Blocks returns the blocks of the main chain by ascending height
+	Blocks() ([]BlockDB, error)
+	// AppendBlock persists the block on top of the main chain along with the balances once the block is applied
+	AppendBlock(block BlockDB, balances map[Account]uint) error
+	// ReplaceBlocks replaces the whole main chain, eg. after a chain reorganisation
+	ReplaceBlocks(blocks []BlockDB, balances map[Account]uint) error
+	// GetNextBlocksFromHash returns the blocks of the main chain following the block with the hash,
+	// the empty hash stands for the parent of the first block
+	GetNextBlocksFromHash(Hash) ([]Block, error)
+	// GetBlockByTxHash returns the block of the main chain including the transaction
+	GetBlockByTxHash(TransactionId) (BlockDB, bool, error)
+	// Balances returns the balances of the latest block, false if the backend doesn't keep them
+	Balances() (map[Account]uint, bool, error)
+	// GetAccountTxs returns the transactions of the main chain sent or received by the account by ascending height,
+	// false if the backend doesn't keep an account index
+	GetAccountTxs(account Account, filter AccountTxsFilter, offset uint64, limit uint64) ([]AccountTx, bool, error)
+	Close() error
+}
+
+// NewStorage opens the storage of the backend, the database of the file backend must exist
+func NewStorage(backend string, path string) (Storage, error) {
+	switch backend {
+	case FILE_STORAGE:
+		return NewFileStorage(path)
+	case BOLT_STORAGE:
+		return NewBoltStorage(path)
+	default:
+		return nil, fmt.Errorf("NewStorage: %s: %w", backend, ErrUnknownStorage)
+	}
+}
+
+// FileStorage json lines database, one block per line
+// a block is only reported as persisted once it has been synced to the disk
+type FileStorage struct {
+	mu sync.Mutex
+	db *os.File
+}
+
+func NewFileStorage(path string) (*FileStorage, error) {
+	db, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("NewFileStorage: cannot open txs database: %w", err)
+	}
+
+	storage := &FileStorage{db: db}
+	if err = storage.truncateTornRecord(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("NewFileStorage: %w", err)
+	}
+	return storage, nil
+}
+
+// NewReadOnlyFileStorage opens the database without modifying it, a partial block left at its end is not dropped
+// and the blocks can't be written
+func NewReadOnlyFileStorage(path string) (*FileStorage, error) {
+	db, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("NewReadOnlyFileStorage: cannot open txs database: %w", err)
+	}
+	return &FileStorage{db: db}, nil
+}
+
+func (f *FileStorage) Blocks() ([]BlockDB, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	blocks := make([]BlockDB, 0)
+	err := f.scan(func(blockDB BlockDB) bool {
+		blocks = append(blocks, blockDB)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+func (f *FileStorage) AppendBlock(block BlockDB, _ map[Account]uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.appendBlock(block)
+}
+
+func (f *FileStorage) appendBlock(block BlockDB) error {
+	info, err := f.db.Stat()
+	if err != nil {
+		return fmt.Errorf("appendBlock: failed to get the database size: %w", err)
+	}
+
+	// a failed append is rolled back, so the next block isn't written after a partial one
+	if err = writeBlock(f.db, block); err == nil {
+		err = f.db.Sync()
+	}
+	if err != nil {
+		_ = f.db.Truncate(info.Size())
+		return fmt.Errorf("appendBlock: failed to append block to file: %w", err)
+	}
+	return nil
+}
+
+// ReplaceBlocks writes the blocks to a temporary file swapped with the database once synced,
+// a crash never leaves the database half rewritten
+func (f *FileStorage) ReplaceBlocks(blocks []BlockDB, _ map[Account]uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := f.db.Name()
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("ReplaceBlocks: failed to create the temporary database: %w", err)
+	}
+	// removing the temporary file fails once it has been renamed
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, blockDB := range blocks {
+		if err = writeBlock(writer, blockDB); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("ReplaceBlocks: failed to write the temporary database: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("ReplaceBlocks: failed to replace the database: %w", err)
+	}
+	if err = syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("ReplaceBlocks: %w", err)
+	}
+
+	db, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("ReplaceBlocks: cannot reopen txs database: %w", err)
+	}
+	_ = f.db.Close()
+	f.db = db
+	return nil
+}
+
+func (f *FileStorage) GetNextBlocksFromHash(from Hash) ([]Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	blocks := make([]Block, 0)
+	hasFoundHash := from == Hash{}
+	err := f.scan(func(blockDB BlockDB) bool {
+		if hasFoundHash {
+			blocks = append(blocks, blockDB.Block)
+		} else if from == blockDB.Hash {
+			hasFoundHash = true
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetNextBlocksFromHash: %w", err)
+	}
+	return blocks, nil
+}
+
+func (f *FileStorage) GetBlockByTxHash(txHash TransactionId) (BlockDB, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var found BlockDB
+	isFound := false
+	err := f.scan(func(blockDB BlockDB) bool {
+		for _, tx := range blockDB.Block.Txs {
+			if hash, _ := tx.Hash(); hash == txHash {
+				found, isFound = blockDB, true
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return BlockDB{}, false, fmt.Errorf("GetBlockByTxHash: %w", err)
+	}
+	return found, isFound, nil
+}
+
+// Balances the json lines database only keeps the blocks
+func (f *FileStorage) Balances() (map[Account]uint, bool, error) {
+	return nil, false, nil
+}
+
+// GetAccountTxs the json lines database doesn't index the accounts
+func (f *FileStorage) GetAccountTxs(_ Account, _ AccountTxsFilter, _ uint64, _ uint64) ([]AccountTx, bool, error) {
+	return nil, false, nil
+}
+
+func (f *FileStorage) Close() error {
+	return f.db.Close()
+}
+
+// truncateTornRecord drops the partial block a crash in the middle of an append leaves after the last new line,
+// the block has never been reported as persisted
+// a complete block only missing its new line is kept and its new line is written
+func (f *FileStorage) truncateTornRecord() error {
+	info, err := f.db.Stat()
+	if err != nil {
+		return fmt.Errorf("truncateTornRecord: failed to get the database size: %w", err)
+	}
+	size := info.Size()
+
+	// look for the last new line, reading the database backwards
+	validSize := int64(0)
+	chunk := make([]byte, tornRecordChunkSize)
+	for end := size; end > 0; {
+		start := end - tornRecordChunkSize
+		if start < 0 {
+			start = 0
+		}
+		n, err := f.db.ReadAt(chunk[:end-start], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("truncateTornRecord: failed to read the database: %w", err)
+		}
+		if i := bytes.LastIndexByte(chunk[:n], '\n'); i >= 0 {
+			validSize = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+	if validSize == size {
+		return nil
+	}
+
+	tail := make([]byte, size-validSize)
+	if _, err = f.db.ReadAt(tail, validSize); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("truncateTornRecord: failed to read the database: %w", err)
+	}
+	var blockDB BlockDB
+	if err = json.Unmarshal(tail, &blockDB); err == nil {
+		Logger.Warnf("truncateTornRecord: adding the new line missing after the block written last to %s", f.db.Name())
+		if _, err = f.db.Write([]byte{'\n'}); err != nil {
+			return fmt.Errorf("truncateTornRecord: failed to complete the database: %w", err)
+		}
+		if err = f.db.Sync(); err != nil {
+			return fmt.Errorf("truncateTornRecord: failed to sync the database: %w", err)
+		}
+		return nil
+	}
+
+	Logger.Warnf("truncateTornRecord: dropping the %d byte(s) of the partial block written last to %s", size-validSize, f.db.Name())
+	if err = f.db.Truncate(validSize); err != nil {
+		return fmt.Errorf("truncateTornRecord: failed to truncate the database: %w", err)
+	}
+	if err = f.db.Sync(); err != nil {
+		return fmt.Errorf("truncateTornRecord: failed to sync the database: %w", err)
+	}
+	return nil
+}
+
+// writeBlock writes the block as a json line
+func writeBlock(w io.Writer, block BlockDB) error {
+	blockDBJson, err := json.Marshal(block)
+	if err != nil {
+		return fmt.Errorf("writeBlock: failed to marshall the block: %w", err)
+	}
+
+	// add to the DB the new block as well as a new line
+	if _, err = w.Write(append(blockDBJson, '\n')); err != nil {
+		return fmt.Errorf("writeBlock: %w", err)
+	}
+	return nil
+}
+
+// syncDir makes a file renamed in the directory durable
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("syncDir: failed to open the directory: %w", err)
+	}
+	defer dir.Close()
+
+	if err = dir.Sync(); err != nil {
+		return fmt.Errorf("syncDir: failed to sync the directory: %w", err)
+	}
+	return nil
+}
+
+// scan reads the blocks from the first one until fn returns false
+func (f *FileStorage) scan(fn func(BlockDB) bool) error {
+	// reset the pointer whatever happens, so the next reading starts from the first block
+	if _, err := f.db.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("scan: couldn't reset pointer on dbfile: %w", err)
+	}
+
+	// the blocks are decoded one after the other, whatever the size of their line
+	decoder := json.NewDecoder(f.db)
+	for {
+		var blockDB BlockDB
+		if err := decoder.Decode(&blockDB); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("scan: failed to unmarshal: %w", err)
+		}
+		if !fn(blockDB) {
+			return nil
+		}
+	}
+}
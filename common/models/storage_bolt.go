@@ -0,0 +1,355 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BOLT_OPEN_TIMEOUT_IN_SECONDS time to wait for another process to release the database
+const BOLT_OPEN_TIMEOUT_IN_SECONDS = 1
+
+var (
+	blocksBucket   = []byte("blocks")
+	heightsBucket  = []byte("heights")
+	balancesBucket = []byte("balances")
+	accountsBucket = []byte("accounts")
+
+	ErrCorruptedStorage = errors.New("storage is corrupted")
+)
+
+// BoltStorage keeps the blocks of the main chain by hash, a height to hash index, the transactions of each account
+// and the balances of the latest block
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: BOLT_OPEN_TIMEOUT_IN_SECONDS * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("NewBoltStorage: cannot open database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		// a database created before the account index existed gets its blocks indexed once
+		isAccountIndexMissing := tx.Bucket(accountsBucket) == nil
+		for _, bucket := range [][]byte{blocksBucket, heightsBucket, balancesBucket, accountsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if !isAccountIndexMissing {
+			return nil
+		}
+		var indexErr error
+		err := forEachBlock(tx, 1, func(blockDB BlockDB) bool {
+			indexErr = putAccountTxs(tx, blockDB)
+			return indexErr == nil
+		})
+		if err != nil {
+			return err
+		}
+		return indexErr
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("NewBoltStorage: cannot create buckets: %w", err)
+	}
+	return &BoltStorage{db: db}, nil
+}
+
+func (b *BoltStorage) Blocks() ([]BlockDB, error) {
+	blocks := make([]BlockDB, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return forEachBlock(tx, 1, func(blockDB BlockDB) bool {
+			blocks = append(blocks, blockDB)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+func (b *BoltStorage) AppendBlock(block BlockDB, balances map[Account]uint) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if err := putBlock(tx, block); err != nil {
+			return err
+		}
+		return putBalances(tx, balances)
+	})
+	if err != nil {
+		return fmt.Errorf("AppendBlock: %w", err)
+	}
+	return nil
+}
+
+func (b *BoltStorage) ReplaceBlocks(blocks []BlockDB, balances map[Account]uint) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		// the replaced blocks are dropped with the indexes, so they can't be mistaken for main chain blocks
+		for _, bucket := range [][]byte{blocksBucket, heightsBucket, accountsBucket} {
+			if err := tx.DeleteBucket(bucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
+		}
+		for _, block := range blocks {
+			if err := putBlock(tx, block); err != nil {
+				return err
+			}
+		}
+		return putBalances(tx, balances)
+	})
+	if err != nil {
+		return fmt.Errorf("ReplaceBlocks: %w", err)
+	}
+	return nil
+}
+
+func (b *BoltStorage) GetNextBlocksFromHash(from Hash) ([]Block, error) {
+	blocks := make([]Block, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		height := uint64(0)
+		if from != (Hash{}) {
+			blockDB, ok, err := getBlock(tx, from)
+			if err != nil || !ok {
+				return err
+			}
+			height = blockDB.Block.Header.Height
+		}
+
+		return forEachBlock(tx, height+1, func(blockDB BlockDB) bool {
+			blocks = append(blocks, blockDB.Block)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetNextBlocksFromHash: %w", err)
+	}
+	return blocks, nil
+}
+
+func (b *BoltStorage) GetBlockByTxHash(txHash TransactionId) (BlockDB, bool, error) {
+	var found BlockDB
+	isFound := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return forEachBlock(tx, 1, func(blockDB BlockDB) bool {
+			for _, blockTx := range blockDB.Block.Txs {
+				if hash, _ := blockTx.Hash(); hash == txHash {
+					found, isFound = blockDB, true
+					return false
+				}
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return BlockDB{}, false, fmt.Errorf("GetBlockByTxHash: %w", err)
+	}
+	return found, isFound, nil
+}
+
+func (b *BoltStorage) Balances() (map[Account]uint, bool, error) {
+	balances := make(map[Account]uint)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(balancesBucket).ForEach(func(k, v []byte) error {
+			if len(v) != 8 {
+				return fmt.Errorf("balance of %s: %w", k, ErrCorruptedStorage)
+			}
+			balances[Account(k)] = uint(binary.BigEndian.Uint64(v))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("Balances: %w", err)
+	}
+	return balances, true, nil
+}
+
+func (b *BoltStorage) GetAccountTxs(account Account, filter AccountTxsFilter, offset uint64, limit uint64) ([]AccountTx, bool, error) {
+	account = account.normalize()
+	page := newAccountTxsPage(account, filter, offset, limit)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(account)
+		cursor := tx.Bucket(accountsBucket).Cursor()
+
+		// the transactions of an account are often included in the same block, the block read last is kept
+		var blockDB BlockDB
+		for k, _ := cursor.Seek(accountTxKey(account, filter.FromHeight, 0)); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			height, index, err := parseAccountTxKey(k[len(prefix):])
+			if err != nil {
+				return fmt.Errorf("account %s: %w", account, err)
+			}
+			if filter.ToHeight != 0 && height > filter.ToHeight {
+				return nil
+			}
+			if blockDB.Block.Header.Height != height || blockDB.Hash == (Hash{}) {
+				hash, err := hashFromBytes(tx.Bucket(heightsBucket).Get(heightKey(height)))
+				if err != nil {
+					return fmt.Errorf("height %d: %w", height, err)
+				}
+				var ok bool
+				if blockDB, ok, err = getBlock(tx, hash); err != nil {
+					return err
+				} else if !ok {
+					return fmt.Errorf("block %s indexed but missing: %w", hash.Hex(), ErrCorruptedStorage)
+				}
+			}
+			if index >= uint32(len(blockDB.Block.Txs)) {
+				return fmt.Errorf("transaction %d of block %s indexed but missing: %w", index, blockDB.Hash.Hex(), ErrCorruptedStorage)
+			}
+			if !page.add(blockDB.Hash, height, blockDB.Block.Txs[index]) {
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("GetAccountTxs: %w", err)
+	}
+	return page.txs, true, nil
+}
+
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
+
+// putBlock stores the block by hash and indexes its height
+func putBlock(tx *bolt.Tx, block BlockDB) error {
+	blockDBJson, err := json.Marshal(block)
+	if err != nil {
+		return fmt.Errorf("putBlock: failed to marshall the block: %w", err)
+	}
+	if err = tx.Bucket(blocksBucket).Put(block.Hash[:], blockDBJson); err != nil {
+		return fmt.Errorf("putBlock: failed to put the block: %w", err)
+	}
+	if err = tx.Bucket(heightsBucket).Put(heightKey(block.Block.Header.Height), block.Hash[:]); err != nil {
+		return fmt.Errorf("putBlock: failed to index the block height: %w", err)
+	}
+	if err = putAccountTxs(tx, block); err != nil {
+		return fmt.Errorf("putBlock: %w", err)
+	}
+	return nil
+}
+
+// putAccountTxs indexes the transactions of the block under their sender and their receiver
+func putAccountTxs(tx *bolt.Tx, block BlockDB) error {
+	bucket := tx.Bucket(accountsBucket)
+	for i, blockTx := range block.Block.Txs {
+		for _, account := range []Account{blockTx.From.normalize(), blockTx.To.normalize()} {
+			if err := bucket.Put(accountTxKey(account, block.Block.Header.Height, uint32(i)), []byte{}); err != nil {
+				return fmt.Errorf("putAccountTxs: failed to index the transaction of %s: %w", account, err)
+			}
+		}
+	}
+	return nil
+}
+
+// putBalances replaces the stored balances, only the accounts whose balance has changed are written
+func putBalances(tx *bolt.Tx, balances map[Account]uint) error {
+	bucket := tx.Bucket(balancesBucket)
+
+	// the accounts which don't have any balance anymore are dropped
+	staleAccounts := make([][]byte, 0)
+	err := bucket.ForEach(func(k, _ []byte) error {
+		if _, ok := balances[Account(k)]; !ok {
+			staleAccounts = append(staleAccounts, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("putBalances: %w", err)
+	}
+	for _, account := range staleAccounts {
+		if err = bucket.Delete(account); err != nil {
+			return fmt.Errorf("putBalances: failed to delete the balance of %s: %w", account, err)
+		}
+	}
+
+	for account, balance := range balances {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(balance))
+		if bytes.Equal(bucket.Get([]byte(account)), value) {
+			continue
+		}
+		if err = bucket.Put([]byte(account), value); err != nil {
+			return fmt.Errorf("putBalances: failed to put the balance of %s: %w", account, err)
+		}
+	}
+	return nil
+}
+
+func getBlock(tx *bolt.Tx, hash Hash) (BlockDB, bool, error) {
+	blockDBJson := tx.Bucket(blocksBucket).Get(hash[:])
+	if blockDBJson == nil {
+		return BlockDB{}, false, nil
+	}
+	var blockDB BlockDB
+	if err := json.Unmarshal(blockDBJson, &blockDB); err != nil {
+		return BlockDB{}, false, fmt.Errorf("getBlock: failed to unmarshal: %w", err)
+	}
+	return blockDB, true, nil
+}
+
+// forEachBlock reads the blocks of the main chain by ascending height from the height until fn returns false
+func forEachBlock(tx *bolt.Tx, height uint64, fn func(BlockDB) bool) error {
+	cursor := tx.Bucket(heightsBucket).Cursor()
+	for k, v := cursor.Seek(heightKey(height)); k != nil; k, v = cursor.Next() {
+		hash, err := hashFromBytes(v)
+		if err != nil {
+			return fmt.Errorf("forEachBlock: height %d: %w", binary.BigEndian.Uint64(k), err)
+		}
+		blockDB, ok, err := getBlock(tx, hash)
+		if err != nil {
+			return fmt.Errorf("forEachBlock: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("forEachBlock: block %s indexed but missing: %w", hash.Hex(), ErrCorruptedStorage)
+		}
+		if !fn(blockDB) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// heightKey big endian keys are iterated by ascending height
+func heightKey(height uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, height)
+	return key
+}
+
+// accountTxKey the account followed by the height of the block and the index of the transaction in the block,
+// the accounts have the same length so the transactions of an account are iterated by ascending height
+func accountTxKey(account Account, height uint64, index uint32) []byte {
+	indexKey := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexKey, index)
+	key := append([]byte(account), heightKey(height)...)
+	return append(key, indexKey...)
+}
+
+// parseAccountTxKey returns the height and the index of the transaction of the key stripped from its account
+func parseAccountTxKey(b []byte) (uint64, uint32, error) {
+	if len(b) != 12 {
+		return 0, 0, ErrCorruptedStorage
+	}
+	return binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint32(b[8:]), nil
+}
+
+func hashFromBytes(b []byte) (Hash, error) {
+	var hash Hash
+	if len(b) != len(hash) {
+		return hash, ErrCorruptedStorage
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
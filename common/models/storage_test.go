@@ -0,0 +1,430 @@
+package models
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStorage(t *testing.T) {
+	// define variables
+	sender := Account("0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf")
+	receiver := Account("0x7b65a12633dbe9a413b17db515732d69e684ebe2")
+	tx := *NewTransaction(sender, receiver, 10, 1, 0, "", 1, test.ChainId)
+	txHash, _ := tx.Hash()
+
+	newBlockDB := func(parent Hash, height uint64, txs ...Transaction) BlockDB {
+		block := NewBlock(parent, height, 0, 0, height, sender, txs)
+		hash, _ := block.Hash()
+		return BlockDB{Hash: hash, Block: block}
+	}
+	block1 := newBlockDB(Hash{}, 1)
+	block2 := newBlockDB(block1.Hash, 2, tx)
+	block3 := newBlockDB(block2.Hash, 3)
+	block2B := newBlockDB(block1.Hash, 2)
+	balances := map[Account]uint{sender: 989, receiver: 10}
+
+	backends := []struct {
+		backend         string
+		path            func(t *testing.T) string
+		storesBalances  bool
+		indexesAccounts bool
+	}{
+		{
+			backend: FILE_STORAGE,
+			path: func(t *testing.T) string {
+				path := filepath.Join(t.TempDir(), "blocks.db")
+				if err := os.WriteFile(path, []byte{}, 0o600); err != nil {
+					t.Fatal(err)
+				}
+				return path
+			},
+		},
+		{
+			backend:         BOLT_STORAGE,
+			path:            func(t *testing.T) string { return filepath.Join(t.TempDir(), "blocks.bolt") },
+			storesBalances:  true,
+			indexesAccounts: true,
+		},
+	}
+
+	for _, b := range backends {
+		t.Run(b.backend, func(t *testing.T) {
+			path := b.path(t)
+			storage, err := NewStorage(b.backend, path)
+			if err != nil {
+				t.Fatalf("NewStorage() error = %v", err)
+			}
+			for _, blockDB := range []BlockDB{block1, block2, block3} {
+				if err = storage.AppendBlock(blockDB, balances); err != nil {
+					t.Fatalf("AppendBlock() error = %v", err)
+				}
+			}
+
+			t.Run("the blocks should be read by ascending height", func(t *testing.T) {
+				got, err := storage.Blocks()
+				if err != nil {
+					t.Fatalf("Blocks() error = %v", err)
+				}
+				if !reflect.DeepEqual(blockDBHashes(got), blockDBHashes([]BlockDB{block1, block2, block3})) {
+					t.Errorf("Blocks() = %v, want the appended blocks", blockDBHashes(got))
+				}
+			})
+
+			t.Run("the blocks following a hash should be returned", func(t *testing.T) {
+				tests := []struct {
+					from Hash
+					want []Hash
+				}{
+					{Hash{}, []Hash{block1.Hash, block2.Hash, block3.Hash}},
+					{block1.Hash, []Hash{block2.Hash, block3.Hash}},
+					{block3.Hash, []Hash{}},
+					{block2B.Hash, []Hash{}},
+				}
+				for _, tt := range tests {
+					blocks, err := storage.GetNextBlocksFromHash(tt.from)
+					if err != nil {
+						t.Fatalf("GetNextBlocksFromHash() error = %v", err)
+					}
+					got := make([]Hash, len(blocks))
+					for i, block := range blocks {
+						got[i], _ = block.Hash()
+					}
+					if !reflect.DeepEqual(got, tt.want) {
+						t.Errorf("GetNextBlocksFromHash(%s) = %v, want %v", tt.from.Hex(), got, tt.want)
+					}
+				}
+			})
+
+			t.Run("the block including a transaction should be found", func(t *testing.T) {
+				got, ok, err := storage.GetBlockByTxHash(txHash)
+				if err != nil || !ok || got.Hash != block2.Hash {
+					t.Errorf("GetBlockByTxHash() = %v, %v, %v, want block 2", got.Hash.Hex(), ok, err)
+				}
+				if _, ok, _ = storage.GetBlockByTxHash(TransactionId{}); ok {
+					t.Errorf("GetBlockByTxHash() found an unknown transaction")
+				}
+			})
+
+			t.Run("the balances should be kept by the backends storing them", func(t *testing.T) {
+				got, ok, err := storage.Balances()
+				if err != nil {
+					t.Fatalf("Balances() error = %v", err)
+				}
+				if ok != b.storesBalances || (ok && !reflect.DeepEqual(got, balances)) {
+					t.Errorf("Balances() = %v, %v, want %v, %v", got, ok, balances, b.storesBalances)
+				}
+			})
+
+			t.Run("the transactions of an account should be indexed by the backends indexing them", func(t *testing.T) {
+				got, ok, err := storage.GetAccountTxs(receiver, AccountTxsFilter{Direction: TX_DIRECTION_IN}, 0, 10)
+				if err != nil {
+					t.Fatalf("GetAccountTxs() error = %v", err)
+				}
+				if ok && len(got) == 1 {
+					if gotTxHash, _ := got[0].Tx.Hash(); gotTxHash != txHash {
+						t.Errorf("GetAccountTxs() transaction = %s, want %s", Hash(gotTxHash).Hex(), Hash(txHash).Hex())
+					}
+				}
+				if ok != b.indexesAccounts || (ok && (len(got) != 1 || got[0].BlockHash != block2.Hash)) {
+					t.Errorf("GetAccountTxs() = %v, %v, want the transaction of block 2, %v", got, ok, b.indexesAccounts)
+				}
+				if got, _, _ = storage.GetAccountTxs(receiver, AccountTxsFilter{FromHeight: 3}, 0, 10); len(got) != 0 {
+					t.Errorf("GetAccountTxs() = %v, want no transaction above the height range", got)
+				}
+			})
+
+			t.Run("the replaced blocks should not be part of the main chain anymore", func(t *testing.T) {
+				if err := storage.ReplaceBlocks([]BlockDB{block1, block2B}, map[Account]uint{sender: 1000}); err != nil {
+					t.Fatalf("ReplaceBlocks() error = %v", err)
+				}
+				got, _ := storage.GetNextBlocksFromHash(block2.Hash)
+				if len(got) != 0 {
+					t.Errorf("GetNextBlocksFromHash() returned %d blocks following a replaced block, want 0", len(got))
+				}
+				if _, ok, _ := storage.GetBlockByTxHash(txHash); ok {
+					t.Errorf("GetBlockByTxHash() found a transaction of a replaced block")
+				}
+				if got, _, _ := storage.GetAccountTxs(sender, AccountTxsFilter{}, 0, 10); len(got) != 0 {
+					t.Errorf("GetAccountTxs() = %v, want the transactions of the replaced block removed from the index", got)
+				}
+				// the changed balances are written and the accounts without any balance anymore are dropped
+				if got, ok, _ := storage.Balances(); ok && !reflect.DeepEqual(got, map[Account]uint{sender: 1000}) {
+					t.Errorf("Balances() = %v, want the balances of the replacing blocks", got)
+				}
+			})
+
+			t.Run("the blocks should be kept once the storage is reopened", func(t *testing.T) {
+				if err := storage.Close(); err != nil {
+					t.Fatalf("Close() error = %v", err)
+				}
+				storage, err = NewStorage(b.backend, path)
+				if err != nil {
+					t.Fatalf("NewStorage() error = %v", err)
+				}
+				defer storage.Close()
+
+				got, err := storage.Blocks()
+				if err != nil {
+					t.Fatalf("Blocks() error = %v", err)
+				}
+				if !reflect.DeepEqual(blockDBHashes(got), blockDBHashes([]BlockDB{block1, block2B})) {
+					t.Errorf("Blocks() = %v, want the replacing blocks", blockDBHashes(got))
+				}
+			})
+		})
+	}
+}
+
+func blockDBHashes(blocks []BlockDB) []Hash {
+	hashes := make([]Hash, len(blocks))
+	for i, blockDB := range blocks {
+		hashes[i] = blockDB.Hash
+	}
+	return hashes
+}
+
+func TestNewStateFromStorage_Bolt(t *testing.T) {
+	// import the test blocks the way the migration command does
+	fileState, err := NewStateFromFile(test.GenesisFilePath, test.BlocksFilePath, DefaultEngine())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileState.Close()
+
+	storage, err := NewBoltStorage(filepath.Join(t.TempDir(), "blocks.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := fileState.GetBlocksFromHeight(1, fileState.GetLatestBlockHeight())
+	if err = storage.ReplaceBlocks(blocks, fileState.Balances()); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromStorage(test.GenesisFilePath, storage, DefaultEngine())
+	if err != nil {
+		t.Fatalf("NewStateFromStorage() error = %v", err)
+	}
+	defer state.Close()
+
+	if state.GetLatestBlockHash() != fileState.GetLatestBlockHash() {
+		t.Errorf("GetLatestBlockHash() = %s, want %s", state.GetLatestBlockHash().Hex(), fileState.GetLatestBlockHash().Hex())
+	}
+	if !reflect.DeepEqual(state.Balances(), fileState.Balances()) {
+		t.Errorf("Balances() = %v, want %v", state.Balances(), fileState.Balances())
+	}
+	// the history served from the account index of the database matches the one indexed in memory
+	for account := range fileState.Balances() {
+		got := state.GetAccountTxs(account, AccountTxsFilter{}, 1, 100)
+		want := fileState.GetAccountTxs(account, AccountTxsFilter{}, 1, 100)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetAccountTxs(%s) = %v, want %v", account, got, want)
+		}
+	}
+}
+
+func TestBoltStorage_AccountIndexMigration(t *testing.T) {
+	// define variables
+	sender := Account("0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf")
+	receiver := Account("0x7b65a12633dbe9a413b17db515732d69e684ebe2")
+	tx := *NewTransaction(sender, receiver, 10, 1, 0, "", 1, test.ChainId)
+	block := NewBlock(Hash{}, 1, 0, 0, 1, sender, []Transaction{tx})
+	hash, _ := block.Hash()
+
+	// a database written before the account index existed
+	path := filepath.Join(t.TempDir(), "blocks.bolt")
+	storage, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.AppendBlock(BlockDB{Hash: hash, Block: block}, map[Account]uint{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket(accountsBucket) }); err != nil {
+		t.Fatal(err)
+	}
+	_ = storage.Close()
+
+	// the blocks are indexed when the database is opened
+	storage, err = NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage() error = %v", err)
+	}
+	defer storage.Close()
+	got, _, err := storage.GetAccountTxs(receiver, AccountTxsFilter{}, 0, 10)
+	if err != nil || len(got) != 1 || got[0].BlockHash != hash {
+		t.Errorf("GetAccountTxs() = %v, %v, want the transaction of the stored block", got, err)
+	}
+}
+
+func TestNewStorage_UnknownBackend(t *testing.T) {
+	if _, err := NewStorage("unknown", "blocks.db"); err == nil {
+		t.Errorf("NewStorage() error = nil, want %v", ErrUnknownStorage)
+	}
+}
+
+func TestFileStorage_TornRecord(t *testing.T) {
+	// the test blocks followed by the beginning of a block a crash has interrupted
+	blocks, err := os.ReadFile(test.BlocksFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	if err = os.WriteFile(path, append(append([]byte{}, blocks...), `{"hash":"16cc4dec406fe2667f`...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromFile(test.GenesisFilePath, path, DefaultEngine())
+	if err != nil {
+		t.Fatalf("NewStateFromFile() error = %v, want the partial block to be dropped", err)
+	}
+	defer state.Close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(blocks) {
+		t.Errorf("NewStateFromFile() left %d bytes in the database, want the %d bytes of the complete blocks", len(got), len(blocks))
+	}
+	if state.GetLatestBlockHeight() != 4 {
+		t.Errorf("GetLatestBlockHeight() = %d, want 4", state.GetLatestBlockHeight())
+	}
+}
+
+func TestReadOnlyFileStorage(t *testing.T) {
+	// the test blocks followed by the beginning of a block a crash has interrupted
+	blocks, err := os.ReadFile(test.BlocksFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	tornBlocks := append(append([]byte{}, blocks...), `{"hash":"16cc4dec406fe2667f`...)
+	if err = os.WriteFile(path, tornBlocks, 0o400); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := NewReadOnlyFileStorage(path)
+	if err != nil {
+		t.Fatalf("NewReadOnlyFileStorage() error = %v", err)
+	}
+	defer storage.Close()
+	if err = storage.AppendBlock(BlockDB{Block: NewBlock(Hash{}, 1, 0, 0, 1, "", nil)}, nil); err == nil {
+		t.Errorf("AppendBlock() error = nil, want the read only database to refuse it")
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(tornBlocks) {
+		t.Errorf("NewReadOnlyFileStorage() left %d bytes in the database, want the %d bytes untouched", len(got), len(tornBlocks))
+	}
+}
+
+func TestFileStorage_MissingNewLine(t *testing.T) {
+	// the test blocks whose last block has been written without its new line
+	blocks, err := os.ReadFile(test.BlocksFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	if err = os.WriteFile(path, bytes.TrimSuffix(blocks, []byte("\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromFile(test.GenesisFilePath, path, DefaultEngine())
+	if err != nil {
+		t.Fatalf("NewStateFromFile() error = %v, want the complete block to be kept", err)
+	}
+	defer state.Close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(blocks) {
+		t.Errorf("NewStateFromFile() left %d bytes in the database, want the %d bytes of the blocks with their new lines", len(got), len(blocks))
+	}
+	if state.GetLatestBlockHeight() != 4 {
+		t.Errorf("GetLatestBlockHeight() = %d, want 4", state.GetLatestBlockHeight())
+	}
+}
+
+func TestFileStorage_LargeBlock(t *testing.T) {
+	// a block whose json line is longer than the default buffer of a line scanner
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	if err := os.WriteFile(path, []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	txs := make([]Transaction, 0, 1000)
+	for i := 0; i < cap(txs); i++ {
+		txs = append(txs, *NewTransaction("0x01fc1af4a56cde68675dc44cabd486e8d3559f07", "0x01fc1af4a56cde68675dc44cabd486e8d3559f07", 1, 0, uint64(i), "", uint64(i), test.ChainId))
+	}
+	block := NewBlock(Hash{}, 1, 0, 0, 1, "", txs)
+	hash, _ := block.Hash()
+	if err = storage.AppendBlock(BlockDB{Hash: hash, Block: block}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Size() <= 64*1024 {
+		t.Fatalf("AppendBlock() wrote %d bytes, want a block larger than 64KB", info.Size())
+	}
+
+	got, err := storage.Blocks()
+	if err != nil {
+		t.Fatalf("Blocks() error = %v", err)
+	}
+	if !reflect.DeepEqual(blockDBHashes(got), []Hash{hash}) {
+		t.Errorf("Blocks() = %v, want %v", blockDBHashes(got), []Hash{hash})
+	}
+}
+
+func TestFileStorage_ReplaceBlocks_Append(t *testing.T) {
+	// the blocks appended after a replacement should follow the replacing blocks
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	if err := os.WriteFile(path, []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	block1 := NewBlock(Hash{}, 1, 0, 0, 1, "", nil)
+	hash1, _ := block1.Hash()
+	block2 := NewBlock(hash1, 2, 0, 0, 2, "", nil)
+	hash2, _ := block2.Hash()
+
+	if err = storage.AppendBlock(BlockDB{Hash: hash2, Block: block2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.ReplaceBlocks([]BlockDB{{Hash: hash1, Block: block1}}, nil); err != nil {
+		t.Fatalf("ReplaceBlocks() error = %v", err)
+	}
+	if err = storage.AppendBlock(BlockDB{Hash: hash2, Block: block2}, nil); err != nil {
+		t.Fatalf("AppendBlock() error = %v", err)
+	}
+
+	got, err := storage.Blocks()
+	if err != nil {
+		t.Fatalf("Blocks() error = %v", err)
+	}
+	if !reflect.DeepEqual(blockDBHashes(got), []Hash{hash1, hash2}) {
+		t.Errorf("Blocks() = %v, want %v", blockDBHashes(got), []Hash{hash1, hash2})
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("ReplaceBlocks() left %d files in the directory, want the database only", len(entries))
+	}
+}
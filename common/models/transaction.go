@@ -1,28 +1,63 @@
 package models
 
 import (
+	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	ErrTxSignatureMissing = errors.New("transaction is not signed")
+	ErrTxSignatureInvalid = errors.New("transaction signature is not valid")
+	ErrTxSignerMismatch   = errors.New("transaction signer doesn't match with the sender")
+	ErrTxChainIdMismatch  = errors.New("transaction chain id doesn't match with the chain")
+	ErrAmountOverflow     = errors.New("amount is too large")
+	ErrTxZeroValue        = errors.New("transaction value must be positive unless it is a signer vote")
 )
 
 // Transaction
 type TransactionId Hash
 
 type Transaction struct {
-	From   Account `json:"from"`
-	To     Account `json:"to"`
-	Value  uint    `json:"value"`
-	Reason string  `json:"reason"`
-	Time   uint64  `json:"time"`
+	From      Account   `json:"from"`
+	To        Account   `json:"to"`
+	Value     uint      `json:"value"`
+	Fee       uint      `json:"fee"`
+	Nonce     uint64    `json:"nonce"`
+	Reason    string    `json:"reason"`
+	Time      uint64    `json:"time"`
+	ChainId   string    `json:"chain_id"`
+	Signature Signature `json:"signature"`
 }
 
-func NewTransaction(from Account, to Account, value uint, reason string, time uint64) *Transaction {
+// transactionPayload is the canonical part of a transaction covered by its signature
+type transactionPayload struct {
+	From    Account `json:"from"`
+	To      Account `json:"to"`
+	Value   uint    `json:"value"`
+	Fee     uint    `json:"fee"`
+	Nonce   uint64  `json:"nonce"`
+	Reason  string  `json:"reason"`
+	Time    uint64  `json:"time"`
+	ChainId string  `json:"chain_id"`
+}
+
+func NewTransaction(from Account, to Account, value uint, fee uint, nonce uint64, reason string, time uint64, chainId string) *Transaction {
 	return &Transaction{
-		From:   from,
-		To:     to,
-		Value:  value,
-		Reason: string(getReason(reason)),
-		Time:   time,
+		From:    from,
+		To:      to,
+		Value:   value,
+		Fee:     fee,
+		Nonce:   nonce,
+		Reason:  string(getReason(reason)),
+		Time:    time,
+		ChainId: chainId,
 	}
 }
 
@@ -35,6 +70,89 @@ func (t Transaction) Hash() (TransactionId, error) {
 	return sha256.Sum256(txJson), nil
 }
 
+// SigningHash returns the hash of the canonical payload the sender has to sign
+func (t Transaction) SigningHash() (Hash, error) {
+	payloadJson, err := json.Marshal(transactionPayload{
+		From:    t.From,
+		To:      t.To,
+		Value:   t.Value,
+		Fee:     t.Fee,
+		Nonce:   t.Nonce,
+		Reason:  t.Reason,
+		Time:    t.Time,
+		ChainId: t.ChainId,
+	})
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(payloadJson), nil
+}
+
+// Sign signs the transaction payload with the sender private key
+func (t *Transaction) Sign(privateKey *ecdsa.PrivateKey) error {
+	hash, err := t.SigningHash()
+	if err != nil {
+		return fmt.Errorf("Sign: failed to get signing hash: %w", err)
+	}
+
+	sig, err := crypto.Sign(hash[:], privateKey)
+	if err != nil {
+		return fmt.Errorf("Sign: failed to sign transaction: %w", err)
+	}
+	t.Signature = sig
+
+	return nil
+}
+
+// Signer recovers the account which has signed the transaction
+func (t Transaction) Signer() (common.Address, error) {
+	if len(t.Signature) == 0 {
+		return common.Address{}, ErrTxSignatureMissing
+	}
+	if len(t.Signature) != crypto.SignatureLength {
+		return common.Address{}, ErrTxSignatureInvalid
+	}
+
+	hash, err := t.SigningHash()
+	if err != nil {
+		return common.Address{}, fmt.Errorf("Signer: failed to get signing hash: %w", err)
+	}
+
+	publicKey, err := crypto.SigToPub(hash[:], t.Signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: %s", ErrTxSignatureInvalid, err.Error())
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// VerifySignature checks that the transaction has been signed by its sender
+func (t Transaction) VerifySignature() error {
+	signer, err := t.Signer()
+	if err != nil {
+		return err
+	}
+	if signer != common.HexToAddress(string(t.From)) {
+		return ErrTxSignerMismatch
+	}
+	return nil
+}
+
+// Cost returns the amount debited from the sender: the value transferred and the fee paid to the miner
+// a cost which doesn't fit in an uint is refused, it would debit less than what is transferred
+func (t Transaction) Cost() (uint, error) {
+	return AddAmounts(t.Value, t.Fee)
+}
+
+// AddAmounts returns the sum of two amounts, ErrAmountOverflow if it doesn't fit in an uint
+func AddAmounts(a uint, b uint) (uint, error) {
+	if a > math.MaxUint-b {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
+
 // Reason transaction reason
 type Reason string
 
@@ -43,6 +161,10 @@ const (
 	SELF_REWARD        = "self-reward"
 	BIRTHDAY           = "birthday"
 	LOAN               = "loan"
+	// SIGNER_ADD vote of a poa signer to authorise the receiver to seal blocks
+	SIGNER_ADD = "signer-add"
+	// SIGNER_REMOVE vote of a poa signer to revoke the receiver from the signers
+	SIGNER_REMOVE = "signer-remove"
 )
 
 func getReason(reason string) Reason {
@@ -53,15 +175,24 @@ func getReason(reason string) Reason {
 		return BIRTHDAY
 	case "loan":
 		return LOAN
+	case "signer-add":
+		return SIGNER_ADD
+	case "signer-remove":
+		return SIGNER_REMOVE
 	}
 	return OTHER
 }
 
 func (s Reason) IsValid() bool {
 	switch s {
-	case OTHER, SELF_REWARD, BIRTHDAY, LOAN:
+	case OTHER, SELF_REWARD, BIRTHDAY, LOAN, SIGNER_ADD, SIGNER_REMOVE:
 		return true
 	}
 
 	return false
 }
+
+// IsVote returns true if the reason is a vote on the poa signers
+func (s Reason) IsVote() bool {
+	return s == SIGNER_ADD || s == SIGNER_REMOVE
+}
@@ -1,151 +1,93 @@
 package services
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"os"
-	"sync"
-
-	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
-	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
 )
 
+var ErrBlockNotFound = errors.New("block cannot be found")
+
 type BlockService interface {
 	GetNextBlocksFromHash(models.Hash) ([]models.Block, error)
+	GetBlockByTxHash(models.TransactionId) (models.BlockDB, error)
 	Mine(context.Context, models.PendingBlock) (*models.Block, error)
 
 	ThisNodeMiningAddress() models.Account
 }
 
-type FileBlockService struct {
-	mu sync.Mutex
-	db *os.File
+type StorageBlockService struct {
+	storage models.Storage
+	engine  models.Engine
 
-	miningComplexity      uint32
 	thisNodeMiningAddress models.Account
 }
 
+// NewFileBlockService block service reading the json lines database
 func NewFileBlockService(
 	transactionFilePath string,
-	miningComplexity uint32,
 	miningAddress models.Account,
-) (*FileBlockService, error) {
-	db, err := os.OpenFile(transactionFilePath, os.O_APPEND|os.O_RDWR, 0o600)
+	engine models.Engine,
+) (*StorageBlockService, error) {
+	storage, err := models.NewFileStorage(transactionFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("NewFileBlockService: cannot open txs database: %w", err)
+		return nil, fmt.Errorf("NewFileBlockService: %w", err)
 	}
-	return &FileBlockService{
-		mu: sync.Mutex{},
-		db: db,
-
-		miningComplexity:      miningComplexity,
-		thisNodeMiningAddress: miningAddress,
-	}, nil
+	return NewStorageBlockService(storage, miningAddress, engine), nil
 }
 
-func (a *FileBlockService) GetNextBlocksFromHash(from models.Hash) ([]models.Block, error) {
-	a.mu.Lock()
-
-	blocks := make([]models.Block, 0)
-	hasFoundHash := false
-
-	// for each block found in database
-	scanner := bufio.NewScanner(a.db)
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return blocks, fmt.Errorf("GetNextBlocksFromHash: error while scanning: %w", err)
-		}
-
-		blockFsJson := scanner.Bytes()
-		var blockDB models.BlockDB
-		err := json.Unmarshal(blockFsJson, &blockDB)
-		if err != nil {
-			return blocks, err
-		}
-
-		if hasFoundHash {
-			blocks = append(blocks, blockDB.Block)
-			continue
-		}
+// NewStorageBlockService block service sharing the storage of the state
+func NewStorageBlockService(
+	storage models.Storage,
+	miningAddress models.Account,
+	engine models.Engine,
+) *StorageBlockService {
+	return &StorageBlockService{
+		storage: storage,
+		engine:  engine,
 
-		if from == blockDB.Hash {
-			hasFoundHash = true
-		}
+		thisNodeMiningAddress: miningAddress,
 	}
+}
 
-	_, err := a.db.Seek(0, io.SeekStart)
+func (a *StorageBlockService) GetNextBlocksFromHash(from models.Hash) ([]models.Block, error) {
+	blocks, err := a.storage.GetNextBlocksFromHash(from)
 	if err != nil {
-		return blocks, fmt.Errorf("GetNextBlocksFromHash: couldn't reset pointer on dbfile: %w", err)
+		return nil, fmt.Errorf("GetNextBlocksFromHash: %w", err)
 	}
-
-	a.mu.Unlock()
-
 	return blocks, nil
 }
 
-// Mine mines a pending block meaning that it'll try to find a valid nonce
+// GetBlockByTxHash returns the block including the transaction
+func (a *StorageBlockService) GetBlockByTxHash(txHash models.TransactionId) (models.BlockDB, error) {
+	blockDB, ok, err := a.storage.GetBlockByTxHash(txHash)
+	if err != nil {
+		return models.BlockDB{}, fmt.Errorf("GetBlockByTxHash: %w", err)
+	}
+	if !ok {
+		return models.BlockDB{}, fmt.Errorf("GetBlockByTxHash: %w", ErrBlockNotFound)
+	}
+	return blockDB, nil
+}
+
+// Mine seals a pending block with the consensus engine (eg. finds a valid nonce with the proof of work)
 // so it can create a block in the blockchain
-func (a *FileBlockService) Mine(ctx context.Context, pb models.PendingBlock) (*models.Block, error) {
-	var block *models.Block
+func (a *StorageBlockService) Mine(ctx context.Context, pb models.PendingBlock) (*models.Block, error) {
 	if len(pb.Txs) == 0 {
 		return nil, errors.New("Mine: cannot mine block with empty transaction")
 	}
 
-	count := uint32(0)
-	for {
-		select {
-		case <-ctx.Done():
-			return block, fmt.Errorf("Mine: mining task has been shutdown")
-		default:
-		}
-
-		nonce := utils.GenerateNonce()
-		block = &models.Block{
-			Header: models.BlockHeader{
-				Parent: pb.Parent,
-				Height: pb.Height,
-				Nonce:  nonce,
-				Time:   pb.Time,
-			},
-			Txs: pb.Txs,
-		}
-
-		blockHash, err := block.Hash()
-		if err != nil {
-			// notest
-			return block, fmt.Errorf("Mine: failed to get block hash: %w", err)
-		}
-
-		var i uint32
-		isValid := true
-		for i = 0; i < a.miningComplexity; i++ {
-			if fmt.Sprintf("%x", blockHash[i]) != "0" {
-				isValid = false
-				break
-			}
-		}
-		printAttempts(count)
-		count++
-
-		if isValid {
-			Logger.Infof("Mine: attempt %d found a nonce=%d, block hash=%s", count, nonce, blockHash.Hex())
-			return block, nil
-		}
+	// the transactions are part of the sealed header through their merkle root
+	block := models.NewBlock(pb.Parent, pb.Height, pb.Bits, 0, pb.Time, pb.MinerAddress, pb.Txs)
+	block, err := a.engine.Seal(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("Mine: %w", err)
 	}
+	return &block, nil
 }
 
-func (a *FileBlockService) ThisNodeMiningAddress() models.Account {
+func (a *StorageBlockService) ThisNodeMiningAddress() models.Account {
 	return a.thisNodeMiningAddress
 }
-
-func printAttempts(i uint32) {
-	if i%1000000 == 0 {
-		Logger.Debugf("attempt: %d", i+1)
-	}
-}
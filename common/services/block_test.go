@@ -3,7 +3,6 @@ package services
 import (
 	"context"
 	"errors"
-	"os"
 	"testing"
 	"time"
 
@@ -22,10 +21,10 @@ var (
 	ctx, _ = context.WithTimeout(context.Background(), 1*time.Millisecond)
 )
 
-func TestFileBlockService_Mine(t *testing.T) {
+func TestStorageBlockService_Mine(t *testing.T) {
 	type fields struct {
-		db               *os.File
-		miningComplexity uint32
+		storage models.Storage
+		engine  models.Engine
 	}
 	type args struct {
 		ctx context.Context
@@ -39,37 +38,35 @@ func TestFileBlockService_Mine(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "mining a block should return a block with a nonce",
-			fields: fields{
-				miningComplexity: 1,
-			},
+			name:   "mining a block should return a block with a nonce",
+			fields: fields{engine: models.DefaultEngine()},
 			args: args{
 				ctx: context.Background(),
 				pb: models.NewPendingBlock(
 					models.Hash{},
 					1,
+					models.ComplexityToBits(1),
 					acc,
 					utils.DefaultTimeService.UnixUint64(),
-					[]models.Transaction{*models.NewTransaction(acc, acc, 10, models.SELF_REWARD, utils.DefaultTimeService.UnixUint64())}),
+					[]models.Transaction{*models.NewTransaction(acc, acc, 10, 1, 0, "", utils.DefaultTimeService.UnixUint64(), "")}),
 			},
 			wantErr: false,
 		},
 		{
-			name: "mining a block with context error should return error",
-			fields: fields{
-				miningComplexity: 10,
-			},
+			name:   "mining a block with context error should return error",
+			fields: fields{engine: models.DefaultEngine()},
 			args: args{
 				ctx: ctx,
 				pb: models.NewPendingBlock(
 					models.Hash{},
 					1,
+					models.ComplexityToBits(10),
 					acc,
 					utils.DefaultTimeService.UnixUint64(),
-					[]models.Transaction{*models.NewTransaction(acc, acc, 10, models.SELF_REWARD, utils.DefaultTimeService.UnixUint64())}),
+					[]models.Transaction{*models.NewTransaction(acc, acc, 10, 1, 0, "", utils.DefaultTimeService.UnixUint64(), "")}),
 			},
 			wantErr: true,
-			want:    errors.New("Mine: mining task has been shutdown"),
+			want:    errors.New("Mine: Seal: mining task has been shutdown"),
 		},
 	}
 
@@ -81,9 +78,9 @@ func TestFileBlockService_Mine(t *testing.T) {
 	// run tests
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			a := &FileBlockService{
-				db:               tt.fields.db,
-				miningComplexity: tt.fields.miningComplexity,
+			a := &StorageBlockService{
+				storage: tt.fields.storage,
+				engine:  tt.fields.engine,
 			}
 			_, err := a.Mine(tt.args.ctx, tt.args.pb)
 			if (err != nil) != tt.wantErr {
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
 )
 
 // fine to leave eth object as we are not planning on implementing another keystore
@@ -49,3 +51,46 @@ func (k *EthKeystoreService) NewKeystoreAccount(password string) (common.Address
 
 	return acc.Address, nil
 }
+
+// SignTransaction signs the transaction with the keystore account of its sender
+func (k *EthKeystoreService) SignTransaction(tx *models.Transaction, password string) error {
+	acc, err := k.keystore.Find(accounts.Account{Address: common.HexToAddress(string(tx.From))})
+	if err != nil {
+		return fmt.Errorf("SignTransaction: account %s cannot be found in keystore: %w", tx.From, err)
+	}
+
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return fmt.Errorf("SignTransaction: failed to get signing hash: %w", err)
+	}
+
+	sig, err := k.keystore.SignHashWithPassphrase(acc, password, hash[:])
+	if err != nil {
+		return fmt.Errorf("SignTransaction: failed to sign transaction: %w", err)
+	}
+	tx.Signature = sig
+
+	return nil
+}
+
+// Unlock unlocks the keystore account until the node stops, so it can sign without its password
+func (k *EthKeystoreService) Unlock(account models.Account, password string) error {
+	acc, err := k.keystore.Find(accounts.Account{Address: common.HexToAddress(string(account))})
+	if err != nil {
+		return fmt.Errorf("Unlock: account %s cannot be found in keystore: %w", account, err)
+	}
+
+	if err = k.keystore.Unlock(acc, password); err != nil {
+		return fmt.Errorf("Unlock: failed to unlock account %s: %w", account, err)
+	}
+	return nil
+}
+
+// SignHash signs the hash with the unlocked keystore account
+func (k *EthKeystoreService) SignHash(account models.Account, hash models.Hash) (models.Signature, error) {
+	sig, err := k.keystore.SignHash(accounts.Account{Address: common.HexToAddress(string(account))}, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("SignHash: failed to sign hash: %w", err)
+	}
+	return sig, nil
+}
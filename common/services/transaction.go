@@ -1,35 +1,178 @@
 package services
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 )
 
 var (
-	ErrMarshalTx       = errors.New("marshal error")
-	ErrTxAlreadyInPool = errors.New("transaction is already in pool")
+	ErrMarshalTx            = errors.New("marshal error")
+	ErrTxAlreadyInPool      = errors.New("transaction is already in pool")
+	ErrTxNotSigned          = errors.New("transaction is not signed by its sender")
+	ErrTxDroppedByOperator  = errors.New("transaction has been dropped from the pool by an operator")
+	ErrTxNonceAlreadyInPool = errors.New("transaction nonce is already used by a pending transaction of the account")
+	ErrTxSenderLimitReached = errors.New("the account has reached the maximum number of pending transactions")
+	ErrMempoolFull          = errors.New("pool is full and no pending transaction can be evicted for this one")
+	ErrTxEvicted            = errors.New("transaction has been evicted from the full pool")
+	ErrTxExpired            = errors.New("transaction has expired before being mined")
+	ErrTxVoteNotSigner      = errors.New("transaction is a vote but its sender is not a signer")
 )
 
+const (
+	// MaxDroppedTxs number of dropped transactions remembered so their sender can find out why
+	MaxDroppedTxs = 1000
+	// MaxRejectedTxs number of transactions refused by the pool remembered so their sender can find out why
+	MaxRejectedTxs = 1000
+	// PendingTxsSubscriptionSize number of new pending transactions a subscriber can lag behind before missing some
+	PendingTxsSubscriptionSize = 100
+
+	// EVICT_LOWEST_FEE a full pool evicts the pending transaction paying the lowest fee, if the new one pays more
+	EVICT_LOWEST_FEE = "lowest_fee"
+	// EVICT_OLDEST a full pool evicts the pending transaction which has been waiting the longest
+	EVICT_OLDEST = "oldest"
+)
+
+type MempoolConf struct {
+	maxSize         uint
+	maxTxsPerSender uint
+	txTtlInSeconds  uint64
+	evictionPolicy  string
+}
+
+func NewMempoolConf(maxSize uint, maxTxsPerSender uint, txTtlInSeconds uint64, evictionPolicy string) MempoolConf {
+	return MempoolConf{maxSize: maxSize, maxTxsPerSender: maxTxsPerSender, txTtlInSeconds: txTtlInSeconds, evictionPolicy: evictionPolicy}
+}
+
+// DefaultMempoolConf keeps up to 5000 transactions, 64 per sender, for an hour
+func DefaultMempoolConf() MempoolConf {
+	return NewMempoolConf(5000, 64, 60*60, EVICT_LOWEST_FEE)
+}
+
+func checkMempoolConf(conf MempoolConf) error {
+	if conf.maxSize == 0 {
+		return errors.New("checkMempoolConf: max size cannot be equal to 0")
+	}
+	if conf.maxTxsPerSender == 0 {
+		return errors.New("checkMempoolConf: max transactions per sender cannot be equal to 0")
+	}
+	if conf.txTtlInSeconds == 0 {
+		return errors.New("checkMempoolConf: transaction time-to-live cannot be equal to 0")
+	}
+	if conf.evictionPolicy != EVICT_LOWEST_FEE && conf.evictionPolicy != EVICT_OLDEST {
+		return fmt.Errorf("checkMempoolConf: eviction policy %s is unknown, use %s or %s", conf.evictionPolicy, EVICT_LOWEST_FEE, EVICT_OLDEST)
+	}
+	return nil
+}
+
 type TransactionService interface {
 	AddPendingTx(models.Transaction) error
 	GetPendingTxs() map[models.TransactionId]models.Transaction
+	// ListPendingTxs returns the transactions of the pool, the oldest first
+	ListPendingTxs() []PendingTx
 	RemovePendingTx(models.TransactionId)
 	RemovePendingTxs([]models.TransactionId)
+	// GetPendingTx returns the transaction if it's waiting in the pool
+	GetPendingTx(models.TransactionId) (models.Transaction, bool)
+	// DropPendingTx removes a transaction which can't be mined anymore and keeps the reason
+	DropPendingTx(models.TransactionId, error)
+	// GetDroppedTxReason returns the reason a transaction has been dropped from the pool
+	GetDroppedTxReason(models.TransactionId) (string, bool)
+	// GetRejectedTxReason returns the reason a transaction has been refused by the pool
+	GetRejectedTxReason(models.TransactionId) (string, bool)
+	// DropExpiredTxs drops the transactions which have been waiting in the pool for longer than their time-to-live
+	DropExpiredTxs()
+	// SubscribePendingTxs returns a channel receiving the transactions added to the pool
+	SubscribePendingTxs() <-chan models.Transaction
+}
+
+// PendingTx transaction waiting in the pool
+type PendingTx struct {
+	Hash models.TransactionId
+	Tx   models.Transaction
+	// AddedAt unix time the transaction has been added to the pool
+	AddedAt uint64
 }
 
 type FileTransactionService struct {
 	mu sync.Mutex
 
-	pendingTxPool map[models.TransactionId]models.Transaction
+	// state the pending transactions are checked against
+	state models.StateReader
+	conf  MempoolConf
+
+	pendingTxPool  map[models.TransactionId]models.Transaction
+	pendingTxTimes map[models.TransactionId]uint64
+	// reasons of the latest dropped and refused transactions
+	droppedTxs  *txReasons
+	rejectedTxs *txReasons
+
+	subscribers []chan models.Transaction
 }
 
 // NewFileTransactionService default constructor
-func NewFileTransactionService() *FileTransactionService {
+func NewFileTransactionService(state models.StateReader, conf MempoolConf) (*FileTransactionService, error) {
+	if err := checkMempoolConf(conf); err != nil {
+		return nil, fmt.Errorf("NewFileTransactionService: %w", err)
+	}
+
 	return &FileTransactionService{
-		pendingTxPool: make(map[models.TransactionId]models.Transaction),
+		state:          state,
+		conf:           conf,
+		pendingTxPool:  make(map[models.TransactionId]models.Transaction),
+		pendingTxTimes: make(map[models.TransactionId]uint64),
+		droppedTxs:     newTxReasons(MaxDroppedTxs),
+		rejectedTxs:    newTxReasons(MaxRejectedTxs),
+	}, nil
+}
+
+// txReasons remembers why the latest transactions have left the pool or have been refused, the oldest one
+// is forgotten first
+type txReasons struct {
+	size    int
+	reasons map[models.TransactionId]string
+	ids     []models.TransactionId
+}
+
+func newTxReasons(size int) *txReasons {
+	return &txReasons{
+		size:    size,
+		reasons: make(map[models.TransactionId]string, size),
+	}
+}
+
+func (r *txReasons) add(id models.TransactionId, reason error) {
+	if _, ok := r.reasons[id]; !ok {
+		if len(r.ids) == r.size {
+			delete(r.reasons, r.ids[0])
+			r.ids = r.ids[1:]
+		}
+		r.ids = append(r.ids, id)
+	}
+	r.reasons[id] = reason.Error()
+}
+
+func (r *txReasons) get(id models.TransactionId) (string, bool) {
+	reason, ok := r.reasons[id]
+	return reason, ok
+}
+
+func (r *txReasons) remove(id models.TransactionId) {
+	if _, ok := r.reasons[id]; !ok {
+		return
+	}
+	delete(r.reasons, id)
+	for i, reasonId := range r.ids {
+		if reasonId == id {
+			r.ids = append(r.ids[:i:i], r.ids[i+1:]...)
+			break
+		}
 	}
 }
 
@@ -51,8 +194,15 @@ func (a *FileTransactionService) addPendingTxToPool(tx models.Transaction) error
 		return fmt.Errorf("addPendingTxToPool: %w: %s", ErrMarshalTx, err.Error())
 	}
 
-	// TODO: Implement verifyTx(tx models.Transaction).
-	// Needs models.state refacto
+	// miners are rewarded by the protocol when a block is added, nobody can mint through the mempool
+	if tx.Reason == models.SELF_REWARD {
+		return fmt.Errorf("addPendingTxToPool: %w", models.ErrTxSelfReward)
+	}
+
+	// refuse any transaction which hasn't been signed by the account spending the funds
+	if err = tx.VerifySignature(); err != nil {
+		return fmt.Errorf("addPendingTxToPool: %w: %s", ErrTxNotSigned, err.Error())
+	}
 
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -61,17 +211,189 @@ func (a *FileTransactionService) addPendingTxToPool(tx models.Transaction) error
 		return fmt.Errorf("addPendingTxToPool: %w", ErrTxAlreadyInPool)
 	}
 
+	now := utils.DefaultTimeService.UnixUint64()
+	a.dropExpiredTxs(now)
+
+	// the sender can look up why a signed transaction has been refused
+	if err = a.verifyTx(tx); err != nil {
+		a.rejectedTxs.add(hash, rejectionReason(err))
+		return fmt.Errorf("addPendingTxToPool: %w", err)
+	}
+
+	// make room for the transaction
+	if uint(len(a.pendingTxPool)) >= a.conf.maxSize {
+		if err = a.evictPendingTx(tx, now); err != nil {
+			a.rejectedTxs.add(hash, rejectionReason(err))
+			return fmt.Errorf("addPendingTxToPool: %w", err)
+		}
+	}
+
 	a.pendingTxPool[hash] = tx
+	a.pendingTxTimes[hash] = now
+	// a transaction refused before may have been accepted since
+	a.rejectedTxs.remove(hash)
+
+	// a slow subscriber must not block the pool
+	for _, subscriber := range a.subscribers {
+		select {
+		case subscriber <- tx:
+		default:
+			Logger.Warnf("addPendingTxToPool: subscriber is full, transaction %s not notified", models.Hash(hash).Hex())
+		}
+	}
+
+	return nil
+}
+
+// verifyTx checks the transaction can be applied on top of the main chain after the other pending
+// transactions of its sender, so an overdraft is refused before being mined
+func (a *FileTransactionService) verifyTx(tx models.Transaction) error {
+	if tx.ChainId != a.state.ChainId() {
+		return fmt.Errorf("verifyTx: %w", models.ErrTxChainIdMismatch)
+	}
+
+	// a vote of an account which isn't a signer would be ignored once mined
+	isVote := models.Reason(tx.Reason).IsVote()
+	if isVote && !a.state.CanVote(tx.From) {
+		return fmt.Errorf("verifyTx: %w", ErrTxVoteNotSigner)
+	}
+	// only the votes carry no value, they are cast for their reason
+	if tx.Value == 0 && !isVote {
+		return fmt.Errorf("verifyTx: %w", models.ErrTxZeroValue)
+	}
+
+	nextNonce := a.state.GetNextNonce(tx.From)
+	if tx.Nonce < nextNonce {
+		return fmt.Errorf("verifyTx: %w", models.ErrTxNonceAlreadyUsed)
+	}
+
+	// the pending transactions of the sender which haven't been mined yet
+	nextPendingNonce := nextNonce
+	cost, err := tx.Cost()
+	if err != nil {
+		return fmt.Errorf("verifyTx: %w", err)
+	}
+	var pendingCount uint
+	for _, pendingTx := range a.pendingTxPool {
+		if pendingTx.From != tx.From || pendingTx.Nonce < nextNonce {
+			continue
+		}
+		if pendingTx.Nonce == tx.Nonce {
+			return fmt.Errorf("verifyTx: %w", ErrTxNonceAlreadyInPool)
+		}
+		if pendingTx.Nonce >= nextPendingNonce {
+			nextPendingNonce = pendingTx.Nonce + 1
+		}
+		pendingCost, err := pendingTx.Cost()
+		if err == nil {
+			cost, err = models.AddAmounts(cost, pendingCost)
+		}
+		if err != nil {
+			return fmt.Errorf("verifyTx: %w", err)
+		}
+		pendingCount++
+	}
+
+	if pendingCount >= a.conf.maxTxsPerSender {
+		return fmt.Errorf("verifyTx: %w", ErrTxSenderLimitReached)
+	}
 
+	// a gap in the nonces would keep the transaction out of any block
+	if tx.Nonce > nextPendingNonce {
+		return fmt.Errorf("verifyTx: %w", models.ErrTxNonceTooHigh)
+	}
+	if cost > a.state.GetBalance(tx.From) {
+		return fmt.Errorf("verifyTx: %w", models.ErrInsufficientBalance)
+	}
+	return nil
+}
+
+// evictPendingTx drops a pending transaction, chosen by the eviction policy, to make room for the transaction
+// only the latest transaction of the other senders can be evicted, so no gap is left in their nonces
+func (a *FileTransactionService) evictPendingTx(tx models.Transaction, now uint64) error {
+	latestTxs := make(map[models.Account]models.TransactionId)
+	for hash, pendingTx := range a.pendingTxPool {
+		if pendingTx.From == tx.From {
+			continue
+		}
+		if latestHash, ok := latestTxs[pendingTx.From]; !ok || pendingTx.Nonce > a.pendingTxPool[latestHash].Nonce {
+			latestTxs[pendingTx.From] = hash
+		}
+	}
+
+	var evictedHash models.TransactionId
+	found := false
+	for _, hash := range latestTxs {
+		if !found || a.isEvictedBefore(hash, evictedHash) {
+			evictedHash = hash
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("evictPendingTx: %w", ErrMempoolFull)
+	}
+	// a transaction can't be evicted by a transaction paying a fee which is not higher
+	if a.conf.evictionPolicy == EVICT_LOWEST_FEE && a.pendingTxPool[evictedHash].Fee >= tx.Fee {
+		return fmt.Errorf("evictPendingTx: %w", ErrMempoolFull)
+	}
+
+	Logger.Infof("evictPendingTx: transaction %s evicted from the pool policy=%s waited=%ds",
+		models.Hash(evictedHash).Hex(), a.conf.evictionPolicy, now-a.pendingTxTimes[evictedHash])
+	a.dropPendingTx(evictedHash, ErrTxEvicted)
 	return nil
 }
 
-// GetPendingTxs get pending transactions
+// isEvictedBefore returns whether the eviction policy picks the first transaction before the second one
+func (a *FileTransactionService) isEvictedBefore(first models.TransactionId, second models.TransactionId) bool {
+	if a.conf.evictionPolicy == EVICT_LOWEST_FEE {
+		firstFee, secondFee := a.pendingTxPool[first].Fee, a.pendingTxPool[second].Fee
+		if firstFee != secondFee {
+			return firstFee < secondFee
+		}
+	}
+	if a.pendingTxTimes[first] != a.pendingTxTimes[second] {
+		return a.pendingTxTimes[first] < a.pendingTxTimes[second]
+	}
+	return bytes.Compare(first[:], second[:]) < 0
+}
+
+// DropExpiredTxs drop the transactions which have been waiting for too long
+func (a *FileTransactionService) DropExpiredTxs() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.dropExpiredTxs(utils.DefaultTimeService.UnixUint64())
+}
+
+func (a *FileTransactionService) dropExpiredTxs(now uint64) {
+	for hash, addedAt := range a.pendingTxTimes {
+		if now >= addedAt+a.conf.txTtlInSeconds {
+			Logger.Infof("dropExpiredTxs: transaction %s expired after %ds in the pool", models.Hash(hash).Hex(), now-addedAt)
+			a.dropPendingTx(hash, ErrTxExpired)
+		}
+	}
+}
+
+// SubscribePendingTxs subscribe to the transactions added to the pool
+func (a *FileTransactionService) SubscribePendingTxs() <-chan models.Transaction {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	subscriber := make(chan models.Transaction, PendingTxsSubscriptionSize)
+	a.subscribers = append(a.subscribers, subscriber)
+	return subscriber
+}
+
+// GetPendingTxs get a copy of the pending transactions, the pool can change while the caller goes through them
 func (a *FileTransactionService) GetPendingTxs() map[models.TransactionId]models.Transaction {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	return a.pendingTxPool
+	pendingTxs := make(map[models.TransactionId]models.Transaction, len(a.pendingTxPool))
+	for hash, tx := range a.pendingTxPool {
+		pendingTxs[hash] = tx
+	}
+	return pendingTxs
 }
 
 // RemovePendingTx remove transaction from pool
@@ -80,6 +402,7 @@ func (a *FileTransactionService) RemovePendingTx(id models.TransactionId) {
 	defer a.mu.Unlock()
 
 	delete(a.pendingTxPool, id)
+	delete(a.pendingTxTimes, id)
 }
 
 // RemovePendingTxs remove transactions from pool
@@ -89,5 +412,78 @@ func (a *FileTransactionService) RemovePendingTxs(ids []models.TransactionId) {
 
 	for _, id := range ids {
 		delete(a.pendingTxPool, id)
+		delete(a.pendingTxTimes, id)
+	}
+}
+
+// ListPendingTxs list pending transactions by the time they have been added to the pool
+func (a *FileTransactionService) ListPendingTxs() []PendingTx {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pendingTxs := make([]PendingTx, 0, len(a.pendingTxPool))
+	for hash, tx := range a.pendingTxPool {
+		pendingTxs = append(pendingTxs, PendingTx{
+			Hash:    hash,
+			Tx:      tx,
+			AddedAt: a.pendingTxTimes[hash],
+		})
+	}
+	sort.Slice(pendingTxs, func(i, j int) bool {
+		if pendingTxs[i].AddedAt != pendingTxs[j].AddedAt {
+			return pendingTxs[i].AddedAt < pendingTxs[j].AddedAt
+		}
+		return bytes.Compare(pendingTxs[i].Hash[:], pendingTxs[j].Hash[:]) < 0
+	})
+	return pendingTxs
+}
+
+// GetPendingTx get a pending transaction
+func (a *FileTransactionService) GetPendingTx(id models.TransactionId) (models.Transaction, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, ok := a.pendingTxPool[id]
+	return tx, ok
+}
+
+// DropPendingTx remove transaction from pool and remember why
+func (a *FileTransactionService) DropPendingTx(id models.TransactionId, reason error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.dropPendingTx(id, reason)
+}
+
+func (a *FileTransactionService) dropPendingTx(id models.TransactionId, reason error) {
+	delete(a.pendingTxPool, id)
+	delete(a.pendingTxTimes, id)
+	a.droppedTxs.add(id, reason)
+}
+
+// GetDroppedTxReason get the reason a transaction has been dropped from the pool
+func (a *FileTransactionService) GetDroppedTxReason(id models.TransactionId) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.droppedTxs.get(id)
+}
+
+// GetRejectedTxReason get the reason a transaction has been refused by the pool
+func (a *FileTransactionService) GetRejectedTxReason(id models.TransactionId) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.rejectedTxs.get(id)
+}
+
+// rejectionReason strips the function names wrapping the reason a transaction has been refused
+func rejectionReason(err error) error {
+	for {
+		wrappedErr := errors.Unwrap(err)
+		if wrappedErr == nil {
+			return err
+		}
+		err = wrappedErr
 	}
 }
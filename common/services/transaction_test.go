@@ -0,0 +1,434 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+// testStateReader state of the chain the pending transactions are checked against
+type testStateReader struct {
+	balances map[models.Account]uint
+	nonces   map[models.Account]uint64
+	// signers accounts allowed to vote, every account can vote if nil
+	signers map[models.Account]bool
+}
+
+func (s testStateReader) ChainId() string {
+	return test.ChainId
+}
+
+func (s testStateReader) GetNextNonce(account models.Account) uint64 {
+	return s.nonces[account]
+}
+
+func (s testStateReader) GetBalance(account models.Account) uint {
+	return s.balances[account]
+}
+
+func (s testStateReader) CanVote(account models.Account) bool {
+	return s.signers == nil || s.signers[account]
+}
+
+func TestFileTransactionService_AddPendingTx(t *testing.T) {
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := models.Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+	otherKey, _ := crypto.GenerateKey()
+	receiver := models.Account(crypto.PubkeyToAddress(otherKey.PublicKey).Hex())
+
+	// the sender can afford 3 transactions costing 11 and has already sent 1 transaction, only the receiver is a signer
+	state := testStateReader{
+		balances: map[models.Account]uint{sender: 33},
+		nonces:   map[models.Account]uint64{sender: 1},
+		signers:  map[models.Account]bool{receiver: true},
+	}
+
+	newSignedTx := func(key *ecdsa.PrivateKey, nonce uint64, reason string, chainId string) models.Transaction {
+		tx := models.NewTransaction(sender, receiver, 10, 1, nonce, reason, utils.DefaultTimeService.UnixUint64(), chainId)
+		if key != nil {
+			_ = tx.Sign(key)
+		}
+		return *tx
+	}
+	newTx := func(key *ecdsa.PrivateKey, reason string) models.Transaction {
+		return newSignedTx(key, 1, reason, test.ChainId)
+	}
+
+	tests := []struct {
+		name       string
+		pendingTxs []models.Transaction
+		tx         models.Transaction
+		wantErr    error
+	}{
+		{
+			name:    "adding a transaction signed by its sender should be accepted",
+			tx:      newTx(senderKey, ""),
+			wantErr: nil,
+		},
+		{
+			name:    "adding a transaction without signature should return error",
+			tx:      newTx(nil, ""),
+			wantErr: ErrTxNotSigned,
+		},
+		{
+			name:    "adding a transaction signed by another account should return error",
+			tx:      newTx(otherKey, ""),
+			wantErr: ErrTxNotSigned,
+		},
+		{
+			name:    "adding a self-reward transaction should return error",
+			tx:      newTx(senderKey, models.SELF_REWARD),
+			wantErr: models.ErrTxSelfReward,
+		},
+		{
+			name:    "adding a transaction signed for another chain should return error",
+			tx:      newSignedTx(senderKey, 1, "", "another-chain"),
+			wantErr: models.ErrTxChainIdMismatch,
+		},
+		{
+			name:    "adding a transaction with a nonce already used in a block should return error",
+			tx:      newSignedTx(senderKey, 0, "", test.ChainId),
+			wantErr: models.ErrTxNonceAlreadyUsed,
+		},
+		{
+			name:       "adding a transaction following the pending transactions of the sender should be accepted",
+			pendingTxs: []models.Transaction{newSignedTx(senderKey, 1, "", test.ChainId)},
+			tx:         newSignedTx(senderKey, 2, "", test.ChainId),
+			wantErr:    nil,
+		},
+		{
+			name:       "adding a transaction with the nonce of a pending transaction should return error",
+			pendingTxs: []models.Transaction{newSignedTx(senderKey, 1, "", test.ChainId)},
+			tx:         newSignedTx(senderKey, 1, "birthday", test.ChainId),
+			wantErr:    ErrTxNonceAlreadyInPool,
+		},
+		{
+			name:    "adding a transaction leaving a gap in the nonces of the sender should return error",
+			tx:      newSignedTx(senderKey, 2, "", test.ChainId),
+			wantErr: models.ErrTxNonceTooHigh,
+		},
+		{
+			name: "adding a transaction the sender can't afford after its pending transactions should return error",
+			pendingTxs: []models.Transaction{
+				newSignedTx(senderKey, 1, "", test.ChainId),
+				newSignedTx(senderKey, 2, "", test.ChainId),
+				newSignedTx(senderKey, 3, "", test.ChainId),
+			},
+			tx:      newSignedTx(senderKey, 4, "", test.ChainId),
+			wantErr: models.ErrInsufficientBalance,
+		},
+		{
+			name: "adding a transaction whose fee wraps its cost around should return error",
+			tx: func() models.Transaction {
+				tx := models.NewTransaction(sender, receiver, 10, math.MaxUint-9, 1, "", utils.DefaultTimeService.UnixUint64(), test.ChainId)
+				_ = tx.Sign(senderKey)
+				return *tx
+			}(),
+			wantErr: models.ErrAmountOverflow,
+		},
+		{
+			name: "adding a vote of a signer without value nor fee should be accepted",
+			tx: func() models.Transaction {
+				tx := models.NewTransaction(receiver, sender, 0, 0, 0, models.SIGNER_ADD, utils.DefaultTimeService.UnixUint64(), test.ChainId)
+				_ = tx.Sign(otherKey)
+				return *tx
+			}(),
+			wantErr: nil,
+		},
+		{
+			name: "adding a transaction without value which is not a vote should return error",
+			tx: func() models.Transaction {
+				tx := models.NewTransaction(sender, receiver, 0, 1, 1, "", utils.DefaultTimeService.UnixUint64(), test.ChainId)
+				_ = tx.Sign(senderKey)
+				return *tx
+			}(),
+			wantErr: models.ErrTxZeroValue,
+		},
+		{
+			name:    "adding a vote of an account which is not a signer should return error",
+			tx:      newTx(senderKey, models.SIGNER_REMOVE),
+			wantErr: ErrTxVoteNotSigner,
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := NewFileTransactionService(state, DefaultMempoolConf())
+			for _, pendingTx := range tt.pendingTxs {
+				if err := a.AddPendingTx(pendingTx); err != nil {
+					t.Fatalf("AddPendingTx() pending transaction error = %v", err)
+				}
+			}
+			err := a.AddPendingTx(tt.tx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("AddPendingTx() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileTransactionService_DropPendingTx(t *testing.T) {
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := models.Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+
+	newTx := func(nonce uint64) (models.Transaction, models.TransactionId) {
+		tx := models.NewTransaction(sender, sender, 10, 1, nonce, "", utils.DefaultTimeService.UnixUint64(), test.ChainId)
+		_ = tx.Sign(senderKey)
+		txHash, _ := tx.Hash()
+		return *tx, txHash
+	}
+
+	a, _ := NewFileTransactionService(testStateReader{
+		balances: map[models.Account]uint{sender: 11},
+	}, DefaultMempoolConf())
+	tx, txHash := newTx(0)
+	if err := a.AddPendingTx(tx); err != nil {
+		t.Fatalf("AddPendingTx() error = %v", err)
+	}
+
+	// the pending transactions handed out are a copy the pool doesn't change anymore
+	pendingTxs := a.GetPendingTxs()
+
+	// a dropped transaction leaves the pool and its reason is kept
+	a.DropPendingTx(txHash, models.ErrTxNonceAlreadyUsed)
+	if _, ok := pendingTxs[txHash]; !ok {
+		t.Errorf("GetPendingTxs() returned the pool itself instead of a copy")
+	}
+	if _, ok := a.GetPendingTx(txHash); ok {
+		t.Errorf("GetPendingTx() found a dropped transaction")
+	}
+	if reason, ok := a.GetDroppedTxReason(txHash); !ok || reason != models.ErrTxNonceAlreadyUsed.Error() {
+		t.Errorf("GetDroppedTxReason() = %s, %t, want %s", reason, ok, models.ErrTxNonceAlreadyUsed)
+	}
+
+	// the oldest dropped transactions are forgotten first
+	for nonce := uint64(1); nonce <= MaxDroppedTxs; nonce++ {
+		_, otherTxHash := newTx(nonce)
+		a.DropPendingTx(otherTxHash, models.ErrTxNonceAlreadyUsed)
+	}
+	if _, ok := a.GetDroppedTxReason(txHash); ok {
+		t.Errorf("GetDroppedTxReason() found a transaction dropped more than %d transactions ago", MaxDroppedTxs)
+	}
+}
+
+func TestFileTransactionService_RejectedTxs(t *testing.T) {
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := models.Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+
+	newTx := func(value uint, nonce uint64, key *ecdsa.PrivateKey) models.Transaction {
+		tx := models.NewTransaction(sender, sender, value, 1, nonce, "", utils.DefaultTimeService.UnixUint64(), test.ChainId)
+		if key != nil {
+			_ = tx.Sign(key)
+		}
+		return *tx
+	}
+	gapTx := newTx(10, 1, senderKey)
+
+	a, _ := NewFileTransactionService(testStateReader{
+		balances: map[models.Account]uint{sender: 100},
+	}, DefaultMempoolConf())
+
+	// the transactions refused by the pool are kept with their reason
+	tests := []struct {
+		name    string
+		tx      models.Transaction
+		wantErr error
+	}{
+		{
+			name:    "a transaction following a nonce gap should be rejected",
+			tx:      gapTx,
+			wantErr: models.ErrTxNonceTooHigh,
+		},
+		{
+			name:    "a transaction the sender can't afford should be rejected",
+			tx:      newTx(1000, 0, senderKey),
+			wantErr: models.ErrInsufficientBalance,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txHash, _ := tt.tx.Hash()
+			if err := a.AddPendingTx(tt.tx); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddPendingTx() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if reason, ok := a.GetRejectedTxReason(txHash); !ok || reason != tt.wantErr.Error() {
+				t.Errorf("GetRejectedTxReason() = %s, %t, want %s", reason, ok, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("a transaction which isn't signed by its sender should not be kept", func(t *testing.T) {
+		tx := newTx(10, 0, nil)
+		txHash, _ := tx.Hash()
+		if err := a.AddPendingTx(tx); !errors.Is(err, ErrTxNotSigned) {
+			t.Fatalf("AddPendingTx() error = %v, wantErr %v", err, ErrTxNotSigned)
+		}
+		if _, ok := a.GetRejectedTxReason(txHash); ok {
+			t.Errorf("GetRejectedTxReason() found a transaction which isn't signed by its sender")
+		}
+	})
+
+	t.Run("a rejected transaction accepted later should not be reported as rejected anymore", func(t *testing.T) {
+		if err := a.AddPendingTx(newTx(10, 0, senderKey)); err != nil {
+			t.Fatalf("AddPendingTx() error = %v", err)
+		}
+		if err := a.AddPendingTx(gapTx); err != nil {
+			t.Fatalf("AddPendingTx() error = %v", err)
+		}
+		gapTxHash, _ := gapTx.Hash()
+		if _, ok := a.GetRejectedTxReason(gapTxHash); ok {
+			t.Errorf("GetRejectedTxReason() found a transaction which is pending")
+		}
+	})
+}
+
+func TestFileTransactionService_BoundedPool(t *testing.T) {
+	// define variables
+	keys := make([]*ecdsa.PrivateKey, 3)
+	accounts := make([]models.Account, 3)
+	state := testStateReader{balances: make(map[models.Account]uint)}
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		accounts[i] = models.Account(crypto.PubkeyToAddress(keys[i].PublicKey).Hex())
+		state.balances[accounts[i]] = 1000
+	}
+
+	newTx := func(sender int, nonce uint64, fee uint) (models.Transaction, models.TransactionId) {
+		tx := models.NewTransaction(accounts[sender], accounts[sender], 10, fee, nonce, "", utils.DefaultTimeService.UnixUint64(), test.ChainId)
+		_ = tx.Sign(keys[sender])
+		txHash, _ := tx.Hash()
+		return *tx, txHash
+	}
+	newPool := func(maxSize uint, maxTxsPerSender uint, evictionPolicy string) *FileTransactionService {
+		a, err := NewFileTransactionService(state, NewMempoolConf(maxSize, maxTxsPerSender, 60, evictionPolicy))
+		if err != nil {
+			t.Fatalf("NewFileTransactionService() error = %v", err)
+		}
+		return a
+	}
+	wantDropped := func(a *FileTransactionService, txHash models.TransactionId, reason error) {
+		if _, ok := a.GetPendingTx(txHash); ok {
+			t.Errorf("GetPendingTx() found a transaction which should have been dropped")
+		}
+		if got, _ := a.GetDroppedTxReason(txHash); got != reason.Error() {
+			t.Errorf("GetDroppedTxReason() = %s, want %s", got, reason)
+		}
+	}
+
+	t.Run("creating a pool with an unknown eviction policy should return error", func(t *testing.T) {
+		if _, err := NewFileTransactionService(state, NewMempoolConf(1, 1, 60, "random")); err == nil {
+			t.Errorf("NewFileTransactionService() error = nil, want error")
+		}
+	})
+
+	t.Run("adding more transactions than a sender is allowed should return error", func(t *testing.T) {
+		a := newPool(10, 2, EVICT_LOWEST_FEE)
+		for nonce := uint64(0); nonce < 2; nonce++ {
+			tx, _ := newTx(0, nonce, 1)
+			if err := a.AddPendingTx(tx); err != nil {
+				t.Fatalf("AddPendingTx() error = %v", err)
+			}
+		}
+		tx, _ := newTx(0, 2, 1)
+		if err := a.AddPendingTx(tx); !errors.Is(err, ErrTxSenderLimitReached) {
+			t.Errorf("AddPendingTx() error = %v, wantErr %v", err, ErrTxSenderLimitReached)
+		}
+	})
+
+	t.Run("adding a transaction to a full pool should evict the lowest fee if the new one pays more", func(t *testing.T) {
+		a := newPool(2, 10, EVICT_LOWEST_FEE)
+		lowFeeTx, lowFeeTxHash := newTx(0, 0, 1)
+		highFeeTx, _ := newTx(1, 0, 5)
+		_ = a.AddPendingTx(lowFeeTx)
+		_ = a.AddPendingTx(highFeeTx)
+
+		tx, _ := newTx(2, 0, 1)
+		if err := a.AddPendingTx(tx); !errors.Is(err, ErrMempoolFull) {
+			t.Errorf("AddPendingTx() error = %v, wantErr %v", err, ErrMempoolFull)
+		}
+		tx, _ = newTx(2, 0, 2)
+		if err := a.AddPendingTx(tx); err != nil {
+			t.Fatalf("AddPendingTx() error = %v", err)
+		}
+		wantDropped(a, lowFeeTxHash, ErrTxEvicted)
+	})
+
+	t.Run("adding a transaction to a full pool should evict the oldest latest transaction of another sender", func(t *testing.T) {
+		a := newPool(3, 10, EVICT_OLDEST)
+		firstTx, firstTxHash := newTx(0, 0, 1)
+		secondTx, secondTxHash := newTx(0, 1, 1)
+		otherTx, _ := newTx(1, 0, 1)
+		_ = a.AddPendingTx(firstTx)
+		_ = a.AddPendingTx(secondTx)
+		_ = a.AddPendingTx(otherTx)
+		// the first transaction of the sender is the oldest, but evicting it would leave a gap
+		a.pendingTxTimes[firstTxHash] -= 2
+		a.pendingTxTimes[secondTxHash] -= 1
+
+		tx, _ := newTx(2, 0, 1)
+		if err := a.AddPendingTx(tx); err != nil {
+			t.Fatalf("AddPendingTx() error = %v", err)
+		}
+		wantDropped(a, secondTxHash, ErrTxEvicted)
+		if _, ok := a.GetPendingTx(firstTxHash); !ok {
+			t.Errorf("GetPendingTx() should have kept the first transaction of the sender")
+		}
+	})
+
+	t.Run("transactions waiting for longer than their time-to-live should be dropped", func(t *testing.T) {
+		a := newPool(10, 10, EVICT_LOWEST_FEE)
+		expiredTx, expiredTxHash := newTx(0, 0, 1)
+		freshTx, freshTxHash := newTx(1, 0, 1)
+		_ = a.AddPendingTx(expiredTx)
+		_ = a.AddPendingTx(freshTx)
+		a.pendingTxTimes[expiredTxHash] -= 60
+
+		a.DropExpiredTxs()
+		wantDropped(a, expiredTxHash, ErrTxExpired)
+		if _, ok := a.GetPendingTx(freshTxHash); !ok {
+			t.Errorf("GetPendingTx() should have kept the transaction which hasn't expired")
+		}
+	})
+}
+
+func TestFileTransactionService_SubscribePendingTxs(t *testing.T) {
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := models.Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+	a, _ := NewFileTransactionService(testStateReader{
+		balances: map[models.Account]uint{sender: 11},
+	}, DefaultMempoolConf())
+	pendingTxs := a.SubscribePendingTxs()
+
+	// only the transactions accepted in the pool are notified
+	tx := models.NewTransaction(sender, sender, 10, 1, 0, "", utils.DefaultTimeService.UnixUint64(), test.ChainId)
+	_ = a.AddPendingTx(*tx)
+	_ = tx.Sign(senderKey)
+	if err := a.AddPendingTx(*tx); err != nil {
+		t.Fatalf("AddPendingTx() error = %v", err)
+	}
+
+	select {
+	case got := <-pendingTxs:
+		gotHash, _ := got.Hash()
+		wantHash, _ := tx.Hash()
+		if gotHash != wantHash {
+			t.Errorf("SubscribePendingTxs() = %v, want %v", got, tx)
+		}
+	default:
+		t.Fatalf("SubscribePendingTxs() no transaction notified")
+	}
+	if len(pendingTxs) != 0 {
+		t.Errorf("SubscribePendingTxs() notified %d more transactions, want 0", len(pendingTxs))
+	}
+}
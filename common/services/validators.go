@@ -1,9 +1,11 @@
 package services
 
 import (
+	"encoding/hex"
 	"unicode"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
@@ -74,6 +76,19 @@ func ValidateHash(fl validator.FieldLevel) bool {
 	return false
 }
 
+func ValidateSignature(fl validator.FieldLevel) bool {
+	if signature, ok := fl.Field().Interface().(string); ok {
+		// [R || S || V] secp256k1 signature encoded in hex
+		if len(signature) != 2*crypto.SignatureLength {
+			return false
+		}
+		if _, err := hex.DecodeString(signature); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (v ValidatorService) AddValidators() {
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		err := v.RegisterValidation("enum", ValidateEnum)
@@ -92,5 +107,9 @@ func (v ValidatorService) AddValidators() {
 		if err != nil {
 			Logger.Fatalf("AddValidators: custom validator hash cannot be registered: %w", err)
 		}
+		err = v.RegisterValidation("signature", ValidateSignature)
+		if err != nil {
+			Logger.Fatalf("AddValidators: custom validator signature cannot be registered: %w", err)
+		}
 	}
 }
@@ -0,0 +1,21 @@
+package accounts
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+)
+
+const ACCOUNTS_DOMAIN_URL = "/api/accounts"
+
+func RunDomain(r *gin.Engine, state models.State, transactionService services.TransactionService, middlewares ...gin.HandlerFunc) {
+	v1 := r.Group(ACCOUNTS_DOMAIN_URL)
+	for _, middleware := range middlewares {
+		v1.Use(middleware)
+	}
+
+	AccountsRegister(v1.Group("/"), &AccountsEnv{
+		state:              state,
+		transactionService: transactionService,
+	})
+}
@@ -0,0 +1,106 @@
+package accounts
+
+import (
+	"net/http"
+
+	. "github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	. "github.com/v4lproik/simple-blockchain-quickstart/domains"
+)
+
+const (
+	NONCE_ACCOUNT_ENDPOINT        = "/:address/nonce"
+	TRANSACTIONS_ACCOUNT_ENDPOINT = "/:address/transactions"
+	DEFAULT_ACCOUNT_TXS_LIMIT     = 10
+)
+
+type AccountsEnv struct {
+	state              models.State
+	transactionService services.TransactionService
+}
+
+func AccountsRegister(router *gin.RouterGroup, env *AccountsEnv) {
+	router.GET(NONCE_ACCOUNT_ENDPOINT, env.AccountNonce)
+	router.GET(TRANSACTIONS_ACCOUNT_ENDPOINT, env.AccountTransactions)
+}
+
+type AccountParams struct {
+	Address string `uri:"address" binding:"required,account"`
+}
+
+// AccountNonce Get the nonce the next transaction of an account has to be signed with
+func (env AccountsEnv) AccountNonce(c *gin.Context) {
+	params := &AccountParams{}
+	// check params
+	if err := ShouldBindUri(c, "nonce cannot be retrieved", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// verified in parameter above
+	account, _ := models.NewAccount(params.Address)
+
+	// the transactions waiting in the mempool already hold the next nonces of the account
+	nextNonce := env.state.GetNextNonce(account)
+	nextPendingNonce := nextNonce
+	for _, tx := range env.transactionService.GetPendingTxs() {
+		if tx.From == account && tx.Nonce >= nextPendingNonce {
+			nextPendingNonce = tx.Nonce + 1
+		}
+	}
+
+	// render
+	serializer := NonceSerializer{
+		account:          account,
+		nextNonce:        nextNonce,
+		nextPendingNonce: nextPendingNonce,
+	}
+	c.JSON(http.StatusOK, gin.H{"nonce": serializer.Response()})
+}
+
+type AccountTxsParams struct {
+	Direction  models.TxDirection `form:"direction" binding:"omitempty,enum"`
+	Reason     models.Reason      `form:"reason" binding:"omitempty,enum"`
+	FromHeight uint64             `form:"from_height"`
+	ToHeight   uint64             `form:"to_height" binding:"omitempty,gtefield=FromHeight"`
+	Offset     uint64             `form:"offset"`
+	Limit      uint64             `form:"limit" binding:"omitempty,gte=1,lte=100"`
+}
+
+// AccountTransactions Get the transactions of the main chain sent or received by an account, a page at a time
+func (env AccountsEnv) AccountTransactions(c *gin.Context) {
+	params := &AccountParams{}
+	filterParams := &AccountTxsParams{}
+	// check params
+	if err := ShouldBindUri(c, "transactions cannot be listed", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	if err := ShouldBindQuery(c, "transactions cannot be listed", filterParams); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	if filterParams.Limit == 0 {
+		filterParams.Limit = DEFAULT_ACCOUNT_TXS_LIMIT
+	}
+
+	// verified in parameter above
+	account, _ := models.NewAccount(params.Address)
+
+	accountTxs := env.state.GetAccountTxs(account, models.AccountTxsFilter{
+		Direction:  filterParams.Direction,
+		Reason:     filterParams.Reason,
+		FromHeight: filterParams.FromHeight,
+		ToHeight:   filterParams.ToHeight,
+	}, filterParams.Offset, filterParams.Limit)
+
+	// render
+	serializer := AccountTxsSerializer{
+		account:    account,
+		accountTxs: accountTxs,
+	}
+	c.JSON(http.StatusOK, serializer.Response())
+}
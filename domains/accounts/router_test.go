@@ -0,0 +1,205 @@
+package accounts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+var (
+	state, _              = models.NewStateFromFile(test.GenesisFilePath, test.BlocksFilePath, models.DefaultEngine())
+	transactionService, _ = services.NewFileTransactionService(state, services.DefaultMempoolConf())
+)
+
+var AccountNonceDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for account nonce endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf/nonce",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"nonce":{"account":"0xA6aA1C9106F0c0d0895bb72F40cFC830180EbeAF","next_nonce":4,"next_pending_nonce":4}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request nonce of an account with transactions in blocks should return its next nonce",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0x7b65a12633dbe9a413b17db515732d69e684ebe2/nonce",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"nonce":{"account":"0x7B65a12633DbE9a413B17DB515732d69e684ebE2","next_nonce":0,"next_pending_nonce":0}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request nonce of an account without any transaction should return 0",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xnotanaccount/nonce",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"nonce cannot be retrieved","context":[[{"field":"Address","message":"The account is not an Ethereum style account (eg. 0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf)"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request nonce of an invalid account should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+var AccountTransactionsDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for account transactions endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0x7b65a12633dbe9a413b17db515732d69e684ebe2/transactions",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"account":"0x7B65a12633DbE9a413B17DB515732d69e684ebE2","transactions":\[{"hash":"[0-9a-f]{64}","block_hash":"[0-9a-f]{64}","block_height":3,"direction":"in","from":"0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf","to":"0x7b65a12633dbe9a413b17db515732d69e684ebe2","value":1000,[^}]*},{[^}]*"block_height":4,"direction":"in",[^}]*"value":77,[^}]*}\]}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request transactions of an account should return the transactions it has received by ascending height",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf/transactions?direction=in",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"account":"0xA6aA1C9106F0c0d0895bb72F40cFC830180EbeAF","transactions":\[{[^}]*"block_height":1,[^}]*},{[^}]*"block_height":2,[^}]*}\]}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request transactions received by an account should only return the transactions sent to it",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf/transactions?from_height=2&to_height=3",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"account":"0xA6aA1C9106F0c0d0895bb72F40cFC830180EbeAF","transactions":\[{[^}]*"block_height":2,[^}]*},{[^}]*"block_height":3,[^}]*}\]}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request transactions of an account in a height range should only return the transactions of these blocks",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf/transactions?direction=out&offset=3&limit=2",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"account":"0xA6aA1C9106F0c0d0895bb72F40cFC830180EbeAF","transactions":\[{[^}]*"block_height":4,"direction":"out",[^}]*}\]}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request a page of transactions of an account should skip the previous pages",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf/transactions?reason=loan",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"account":"0xA6aA1C9106F0c0d0895bb72F40cFC830180EbeAF","transactions":[]}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request transactions of an account with a reason it has never used should return no transaction",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf/transactions?direction=sideways",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"transactions cannot be listed","context":[[{"field":"Direction","message":"The value cannot be submitted"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request transactions of an account with an invalid direction should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf/transactions?from_height=3&to_height=2",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"transactions cannot be listed","context":[[{"field":"ToHeight","message":"Should be greater than FromHeight"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request transactions of an account with an inverted height range should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            ACCOUNTS_DOMAIN_URL + "/0xnotanaccount/transactions",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"transactions cannot be listed","context":[[{"field":"Address","message":"The account is not an Ethereum style account (eg. 0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf)"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request transactions of an invalid account should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+func TestAccountsEnv_AccountNonce(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	r := gin.New()
+	initServer(r)
+
+	for _, testData := range AccountNonceDomainTests {
+		req, err := http.NewRequest(testData.method, testData.url, nil)
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+}
+
+func TestAccountsEnv_AccountTransactions(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	r := gin.New()
+	initServer(r)
+
+	for _, testData := range AccountTransactionsDomainTests {
+		req, err := http.NewRequest(testData.method, testData.url, nil)
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+}
+
+func initServer(r *gin.Engine) {
+	services.ValidatorService{}.AddValidators()
+	RunDomain(r, state, transactionService)
+}
@@ -0,0 +1,79 @@
+package accounts
+
+import (
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+)
+
+type NonceSerializer struct {
+	account          models.Account
+	nextNonce        uint64
+	nextPendingNonce uint64
+}
+
+type NonceResponse struct {
+	Account          models.Account `json:"account"`
+	NextNonce        uint64         `json:"next_nonce"`
+	NextPendingNonce uint64         `json:"next_pending_nonce"`
+}
+
+func (n NonceSerializer) Response() NonceResponse {
+	return NonceResponse{
+		Account:          n.account,
+		NextNonce:        n.nextNonce,
+		NextPendingNonce: n.nextPendingNonce,
+	}
+}
+
+type AccountTxsSerializer struct {
+	account    models.Account
+	accountTxs []models.AccountTx
+}
+
+type AccountTxResponse struct {
+	Hash        models.Hash        `json:"hash"`
+	BlockHash   models.Hash        `json:"block_hash"`
+	BlockHeight uint64             `json:"block_height"`
+	Direction   models.TxDirection `json:"direction"`
+	From        models.Account     `json:"from"`
+	To          models.Account     `json:"to"`
+	Value       uint               `json:"value"`
+	Fee         uint               `json:"fee"`
+	Nonce       uint64             `json:"nonce"`
+	Reason      string             `json:"reason"`
+	Time        uint64             `json:"time"`
+}
+
+type AccountTxsResponse struct {
+	Account      models.Account      `json:"account"`
+	Transactions []AccountTxResponse `json:"transactions"`
+}
+
+func (a AccountTxsSerializer) Response() AccountTxsResponse {
+	transactions := make([]AccountTxResponse, len(a.accountTxs))
+	for i, accountTx := range a.accountTxs {
+		tx := accountTx.Tx
+		txHash, _ := tx.Hash()
+		// a transaction sent to itself is reported as sent, the sender is compared whatever its case
+		direction := models.TX_DIRECTION_OUT
+		if from, _ := models.NewAccount(string(tx.From)); from != a.account {
+			direction = models.TX_DIRECTION_IN
+		}
+		transactions[i] = AccountTxResponse{
+			Hash:        models.Hash(txHash),
+			BlockHash:   accountTx.BlockHash,
+			BlockHeight: accountTx.BlockHeight,
+			Direction:   direction,
+			From:        tx.From,
+			To:          tx.To,
+			Value:       tx.Value,
+			Fee:         tx.Fee,
+			Nonce:       tx.Nonce,
+			Reason:      tx.Reason,
+			Time:        tx.Time,
+		}
+	}
+	return AccountTxsResponse{
+		Account:      a.account,
+		Transactions: transactions,
+	}
+}
@@ -2,6 +2,7 @@ package balances
 
 import (
 	"bytes"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,7 +14,7 @@ import (
 )
 
 var (
-	state, _   = models.NewStateFromFile(test.GenesisFilePath, test.BlocksFilePath)
+	state, _   = models.NewStateFromFile(test.GenesisFilePath, test.BlocksFilePath, models.DefaultEngine())
 	tState     = &testState{}
 	balanceEnv *BalancesEnv
 )
@@ -126,12 +127,12 @@ func (t testState) Add(transaction models.Transaction) error {
 	panic("implement me")
 }
 
-func (t testState) AddBlock(block models.Block) error {
+func (t testState) AddBlock(block models.Block) ([]models.Transaction, error) {
 	// TODO implement me
 	panic("implement me")
 }
 
-func (t testState) AddBlocks(blocks []models.Block) error {
+func (t testState) AddBlocks(blocks []models.Block) ([]models.Transaction, error) {
 	// TODO implement me
 	panic("implement me")
 }
@@ -140,7 +141,37 @@ func (t testState) Balances() map[models.Account]uint {
 	return make(map[models.Account]uint, 0)
 }
 
-func (t testState) Persist() (models.Hash, error) {
+func (t testState) ChainId() string {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GenesisHash() models.Hash {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GetNextNonce(account models.Account) uint64 {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) PrepareHeader(header *models.BlockHeader) error {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) Engine() models.Engine {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GetTotalWork() *big.Int {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GetBlockLocator() []models.Hash {
 	// TODO implement me
 	panic("implement me")
 }
@@ -160,6 +191,46 @@ func (t testState) GetLatestBlockHeight() uint64 {
 	panic("implement me")
 }
 
+func (t testState) GetBlockByHash(hash models.Hash) (models.BlockDB, bool) {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GetBlockByHeight(height uint64) (models.BlockDB, bool) {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GetBlocksFromHeight(height uint64, limit uint64) []models.BlockDB {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GetBalance(account models.Account) uint {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) CanVote(account models.Account) bool {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GetBlockByTxHash(txHash models.TransactionId) (models.BlockDB, bool) {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) GetAccountTxs(account models.Account, filter models.AccountTxsFilter, offset uint64, limit uint64) []models.AccountTx {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (t testState) SubscribeNewHeads() <-chan models.NewHeadEvent {
+	// TODO implement me
+	panic("implement me")
+}
+
 func (t testState) Print() {
 	// TODO implement me
 	panic("implement me")
@@ -7,6 +7,7 @@ import (
 	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -25,6 +26,12 @@ func getErrorMsg(fe validator.FieldError) string {
 		return "Should be less than " + fe.Param()
 	case "gte":
 		return "Should be greater than " + fe.Param()
+	case "gtefield":
+		return "Should be greater than " + fe.Param()
+	case "max":
+		return "Should not exceed " + fe.Param()
+	case "oneof":
+		return "Should be one of " + fe.Param()
 	case "enum":
 		return "The value cannot be submitted"
 	case "password":
@@ -33,12 +40,33 @@ func getErrorMsg(fe validator.FieldError) string {
 		return "The account is not an Ethereum style account (eg. 0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf)"
 	case "hash":
 		return "The hash should be a 32 byte array"
+	case "signature":
+		return "The signature should be a 65 byte [R || S || V] array encoded in hex"
 	}
 	return "Unknown error"
 }
 
 func ShouldBind(c *gin.Context, errMsg string, params interface{}) *utils.Error {
-	if err := c.ShouldBind(params); err != nil {
+	return formatBindingError(c.ShouldBind(params), errMsg)
+}
+
+// ShouldBindUri binds the path parameters of the request (eg. /api/accounts/:address)
+func ShouldBindUri(c *gin.Context, errMsg string, params interface{}) *utils.Error {
+	return formatBindingError(c.ShouldBindUri(params), errMsg)
+}
+
+// ShouldBindQuery binds the query string parameters of the request (eg. /api/blocks/?from=1)
+func ShouldBindQuery(c *gin.Context, errMsg string, params interface{}) *utils.Error {
+	return formatBindingError(c.ShouldBindQuery(params), errMsg)
+}
+
+// ShouldBindMessage binds a json message received outside of a request (eg. over a websocket)
+func ShouldBindMessage(message []byte, errMsg string, params interface{}) *utils.Error {
+	return formatBindingError(binding.JSON.BindBody(message, params), errMsg)
+}
+
+func formatBindingError(err error, errMsg string) *utils.Error {
+	if err != nil {
 		var ve validator.ValidationErrors
 		if errors.As(err, &ve) {
 			out := make([]ErrorMsg, len(ve))
@@ -0,0 +1,19 @@
+package blocks
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+)
+
+const BLOCKS_DOMAIN_URL = "/api/blocks"
+
+func RunDomain(r *gin.Engine, state models.State, middlewares ...gin.HandlerFunc) {
+	v1 := r.Group(BLOCKS_DOMAIN_URL)
+	for _, middleware := range middlewares {
+		v1.Use(middleware)
+	}
+
+	BlocksRegister(v1.Group("/"), &BlocksEnv{
+		state: state,
+	})
+}
@@ -0,0 +1,123 @@
+package blocks
+
+import (
+	"net/http"
+
+	. "github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	. "github.com/v4lproik/simple-blockchain-quickstart/domains"
+)
+
+const (
+	LIST_BLOCKS_ENDPOINT         = "/"
+	GET_LATEST_BLOCK_ENDPOINT    = "/latest"
+	GET_BLOCK_BY_HEIGHT_ENDPOINT = "/height/:height"
+	GET_BLOCK_BY_HASH_ENDPOINT   = "/:hash"
+	DEFAULT_LIST_BLOCKS_LIMIT    = 10
+)
+
+type BlocksEnv struct {
+	state models.State
+}
+
+func BlocksRegister(router *gin.RouterGroup, env *BlocksEnv) {
+	router.GET(LIST_BLOCKS_ENDPOINT, env.ListBlocks)
+	router.GET(GET_LATEST_BLOCK_ENDPOINT, env.GetLatestBlock)
+	router.GET(GET_BLOCK_BY_HEIGHT_ENDPOINT, env.GetBlockByHeight)
+	router.GET(GET_BLOCK_BY_HASH_ENDPOINT, env.GetBlockByHash)
+}
+
+type ListBlocksParams struct {
+	From  uint64 `form:"from" binding:"omitempty,gte=1"`
+	Limit uint64 `form:"limit" binding:"omitempty,gte=1,lte=100"`
+}
+
+// ListBlocks Get the blocks of the main chain by ascending height, a page at a time
+func (env BlocksEnv) ListBlocks(c *gin.Context) {
+	params := &ListBlocksParams{}
+	// check params
+	if err := ShouldBindQuery(c, "blocks cannot be listed", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	if params.From == 0 {
+		params.From = 1
+	}
+	if params.Limit == 0 {
+		params.Limit = DEFAULT_LIST_BLOCKS_LIMIT
+	}
+
+	// render
+	serializer := NewBlocksSerializer(env.state.GetBlocksFromHeight(params.From, params.Limit))
+	c.JSON(http.StatusOK, serializer.Response())
+}
+
+// GetLatestBlock Get the latest block of the main chain
+func (env BlocksEnv) GetLatestBlock(c *gin.Context) {
+	blockDB, ok := env.state.GetBlockByHeight(env.state.GetLatestBlockHeight())
+	if !ok {
+		AbortWithError(c, NewError(http.StatusNotFound, "block cannot be found"))
+		return
+	}
+
+	// render
+	serializer := NewBlockSerializer(blockDB)
+	c.JSON(http.StatusOK, gin.H{"block": serializer.Response()})
+}
+
+type BlockHeightParams struct {
+	Height uint64 `uri:"height" binding:"required,gte=1"`
+}
+
+// GetBlockByHeight Get the block of the main chain at a specific height
+func (env BlocksEnv) GetBlockByHeight(c *gin.Context) {
+	params := &BlockHeightParams{}
+	// check params
+	if err := ShouldBindUri(c, "block cannot be retrieved", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	blockDB, ok := env.state.GetBlockByHeight(params.Height)
+	if !ok {
+		AbortWithError(c, NewError(http.StatusNotFound, "block cannot be found"))
+		return
+	}
+
+	// render
+	serializer := NewBlockSerializer(blockDB)
+	c.JSON(http.StatusOK, gin.H{"block": serializer.Response()})
+}
+
+type BlockHashParams struct {
+	Hash string `uri:"hash" binding:"required,hash"`
+}
+
+// GetBlockByHash Get the block of the main chain with a specific hash
+func (env BlocksEnv) GetBlockByHash(c *gin.Context) {
+	params := &BlockHashParams{}
+	// check params
+	if err := ShouldBindUri(c, "block cannot be retrieved", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// verified in parameter above
+	hash := models.Hash{}
+	if err := hash.UnmarshalText([]byte(params.Hash)); err != nil {
+		AbortWithError(c, NewError(http.StatusBadRequest, "block cannot be retrieved"))
+		return
+	}
+
+	blockDB, ok := env.state.GetBlockByHash(hash)
+	if !ok {
+		AbortWithError(c, NewError(http.StatusNotFound, "block cannot be found"))
+		return
+	}
+
+	// render
+	serializer := NewBlockSerializer(blockDB)
+	c.JSON(http.StatusOK, gin.H{"block": serializer.Response()})
+}
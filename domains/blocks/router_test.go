@@ -0,0 +1,168 @@
+package blocks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+const (
+	firstBlockHash  = "73ba99a7ca2161f22f12ea6e34c6e3002cc721e7c0120ed151ddc06d34e3ff15"
+	secondBlockHash = "1b715bd5b47d223f10338b032c2ef526d487ba0f591e44d4e04cfa4294b53d1c"
+	thirdBlockHash  = "96f15b30e59d4016619e28fa965b0a3bc3a79f836a4415cd2edd604611198ebb"
+	latestBlockHash = "16cc4dec406fe2667f199d86305783726712d55e1f8f0c7879a457ad73d039a6"
+)
+
+var BlocksDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for latest block endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/latest",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"block":{"hash":"` + latestBlockHash + `","header":{"parent":"` + thirdBlockHash + `",.*"height":4,.*},"transactions":\[.*\]}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request latest block should return the tip of the chain",
+		after:          func(req *http.Request) {},
+	},
+	//---------------------   Test suit for block by height endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/height/2",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"block":{"hash":"` + secondBlockHash + `","header":{"parent":"` + firstBlockHash + `",.*"height":2,.*},"transactions":\[{"hash":"[0-9a-f]{64}",.*\]}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request block by height should return the block with its transactions hashes",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/height/42",
+		method:         "GET",
+		expectedCode:   http.StatusNotFound,
+		jsonResponse:   `{"error":{"code":404,"status":"Not Found","message":"block cannot be found","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request block above the tip should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/height/0",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"block cannot be retrieved",.*}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request block at height 0 should return error",
+		after:          func(req *http.Request) {},
+	},
+	//---------------------   Test suit for block by hash endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/" + thirdBlockHash,
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"block":{"hash":"` + thirdBlockHash + `","header":{"parent":"` + secondBlockHash + `",.*"height":3,.*}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request block by hash should return the block",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/" + models.Hash{}.Hex(),
+		method:         "GET",
+		expectedCode:   http.StatusNotFound,
+		jsonResponse:   `{"error":{"code":404,"status":"Not Found","message":"block cannot be found","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request unknown block should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/nothash",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"block cannot be retrieved","context":[[{"field":"Hash","message":"The hash should be a 32 byte array"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request block with an invalid hash should return error",
+		after:          func(req *http.Request) {},
+	},
+	//---------------------   Test suit for list blocks endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/?from=2&limit=2",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"blocks":\[{"hash":"` + secondBlockHash + `",.*},{"hash":"` + thirdBlockHash + `",.*}\]}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request a page of blocks should return the blocks by ascending height",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/?from=5",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"blocks":[]}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request a page of blocks above the tip should return no block",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            BLOCKS_DOMAIN_URL + "/?limit=101",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"blocks cannot be listed",.*}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request a page of blocks too large should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+func TestBlocksEnv(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	r := gin.New()
+	initServer(t, r)
+
+	for _, testData := range BlocksDomainTests {
+		req, err := http.NewRequest(testData.method, testData.url, nil)
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+}
+
+func initServer(t *testing.T, r *gin.Engine) {
+	state, err := models.NewStateFromFile(test.GenesisFilePath, test.BlocksFilePath, models.DefaultEngine())
+	if err != nil {
+		t.Fatalf("cannot load the state: %v", err)
+	}
+	services.ValidatorService{}.AddValidators()
+	BlocksRegister(r.Group(BLOCKS_DOMAIN_URL), &BlocksEnv{state})
+}
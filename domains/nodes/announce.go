@@ -0,0 +1,95 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+const (
+	// MaxPendingAnnouncements number of announced blocks waiting to be fetched, the next ones are ignored
+	// until the synchronisation catches up
+	MaxPendingAnnouncements = 100
+	// ANNOUNCE_BLOCK_TIMEOUT_IN_SECONDS time given to a peer to accept a block announcement
+	ANNOUNCE_BLOCK_TIMEOUT_IN_SECONDS = 5
+)
+
+var (
+	ErrTooManyAnnouncements  = errors.New("too many block announcements pending")
+	ErrUntrustedAnnouncement = errors.New("block announced by a node which is not a verified peer")
+)
+
+// BlockAnnouncement a new block a node has added to its main chain, the block has to be fetched from the node
+type BlockAnnouncement struct {
+	Hash   models.Hash
+	Height uint64
+	Node   NetworkNodeAddress
+}
+
+// announceBlock lets the active peers know about a block mined by this node
+func (n *NodeTaskManager) announceBlock(block models.Block) {
+	blockHash, err := block.Hash()
+	if err != nil {
+		Logger.Errorf("announceBlock: failed to hash block: %s", err)
+		return
+	}
+
+	nodes, err := n.nodeService.List()
+	if err != nil {
+		Logger.Errorf("announceBlock: failed to list nodes: %s", err)
+		return
+	}
+
+	announcement := BlockAnnouncement{
+		Hash:   blockHash,
+		Height: block.Header.Height,
+		Node:   n.thisNodeAddress,
+	}
+	for nodeAddress, node := range nodes {
+		// no need to announce the block to ourselves
+		if !node.IsActive || nodeAddress == n.thisNodeAddress || n.nodeService.IsBanned(nodeAddress) {
+			continue
+		}
+		go func(nodeAddress NetworkNodeAddress) {
+			if err := n.client.AnnounceBlock(nodeAddress, announcement); err != nil {
+				Logger.Debugf("announceBlock: block %s not announced to %s: %s", blockHash.Hex(), nodeAddress.String(), err)
+			}
+		}(nodeAddress)
+	}
+}
+
+func announceBlockToNode(nodeAddress NetworkNodeAddress, announcement BlockAnnouncement) error {
+	// generate url
+	url := fmt.Sprintf("http://%s%s%s", nodeAddress.String(), NODES_DOMAIN_URL, ANNOUNCE_BLOCK_NODE_ENDPOINT)
+
+	// generate payload
+	body, _ := json.Marshal(AnnounceBlockParams{
+		Hash:   announcement.Hash.Hex(),
+		Height: announcement.Height,
+		Ip:     announcement.Node.ip,
+		Port:   announcement.Node.port,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), ANNOUNCE_BLOCK_TIMEOUT_IN_SECONDS*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := peerHttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("announceBlockToNode: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("announceBlockToNode: announcement refused with status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+	"github.com/v4lproik/simple-blockchain-quickstart/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// HTTP_TRANSPORT peers are contacted through their json endpoints
+	HTTP_TRANSPORT = "http"
+	// GRPC_TRANSPORT peers are contacted through their grpc server, the ones without a grpc port through http
+	GRPC_TRANSPORT = "grpc"
+	// GRPC_SYNC_TIMEOUT_IN_SECONDS time given to a peer to send its status or its blocks over grpc
+	GRPC_SYNC_TIMEOUT_IN_SECONDS = 60
+	// GRPC_PEERS_REFRESH_INTERVAL_IN_SECONDS time the grpc client keeps the grpc ports of the peers before reading
+	// the node database again
+	GRPC_PEERS_REFRESH_INTERVAL_IN_SECONDS = 30
+)
+
+// NodeClient protocol spoken by this node to its peers
+type NodeClient interface {
+	// GetStatus returns the status of the node as signed by the node with the nonce
+	GetStatus(nodeAddress NetworkNodeAddress, nonce models.Hash) (NetworkNodeStatus, error)
+	// GetNextBlocksFromHash returns the blocks of the node's main chain following the block with the hash
+	GetNextBlocksFromHash(nodeAddress NetworkNodeAddress, hash models.Hash) ([]models.Block, error)
+	// RelayTx sends a pending transaction to the node
+	RelayTx(nodeAddress NetworkNodeAddress, tx models.Transaction) error
+	// AnnounceBlock lets the node know about a new block
+	AnnounceBlock(nodeAddress NetworkNodeAddress, announcement BlockAnnouncement) error
+}
+
+// TransportConf how this node talks to its peers, and the port its grpc server listens to
+type TransportConf struct {
+	transport string
+	// 0 if the grpc server is not started
+	grpcPort uint64
+}
+
+func NewTransportConf(transport string, grpcPort uint64) TransportConf {
+	return TransportConf{transport: transport, grpcPort: grpcPort}
+}
+
+// DefaultTransportConf talks to the peers through http and doesn't start the grpc server
+func DefaultTransportConf() TransportConf {
+	return NewTransportConf(HTTP_TRANSPORT, 0)
+}
+
+// NewNodeClient returns the client of the transport set in the conf
+func NewNodeClient(conf TransportConf, nodeService *NodeService) (NodeClient, error) {
+	switch conf.transport {
+	case HTTP_TRANSPORT:
+		return httpNodeClient{}, nil
+	case GRPC_TRANSPORT:
+		if nodeService == nil {
+			return nil, errors.New("NewNodeClient: node service cannot be nil")
+		}
+		return &grpcNodeClient{
+			nodeService: nodeService,
+			httpClient:  httpNodeClient{},
+			conns:       make(map[NetworkNodeAddress]grpcConn),
+		}, nil
+	default:
+		return nil, fmt.Errorf("NewNodeClient: transport %s is unknown", conf.transport)
+	}
+}
+
+// peerHttpClient is shared by the requests to the peers, so the connections to a peer are reused
+var peerHttpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: MaxRelayWorkers,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// httpNodeClient talks to the json endpoints of the peers
+type httpNodeClient struct{}
+
+func (h httpNodeClient) GetStatus(nodeAddress NetworkNodeAddress, nonce models.Hash) (NetworkNodeStatus, error) {
+	return getNodeStatus(nodeAddress, nonce)
+}
+
+func (h httpNodeClient) GetNextBlocksFromHash(nodeAddress NetworkNodeAddress, hash models.Hash) ([]models.Block, error) {
+	return getNextNodeBlocksFromHash(nodeAddress, hash)
+}
+
+func (h httpNodeClient) RelayTx(nodeAddress NetworkNodeAddress, tx models.Transaction) error {
+	return relayTxToNode(nodeAddress, tx)
+}
+
+func (h httpNodeClient) AnnounceBlock(nodeAddress NetworkNodeAddress, announcement BlockAnnouncement) error {
+	return announceBlockToNode(nodeAddress, announcement)
+}
+
+// grpcNodeClient talks to the grpc server of the peers, a peer whose grpc port is unknown is contacted through http
+type grpcNodeClient struct {
+	nodeService *NodeService
+	httpClient  NodeClient
+
+	mu sync.Mutex
+	// grpc ports of the peers, refreshed from the node database every GRPC_PEERS_REFRESH_INTERVAL_IN_SECONDS
+	grpcPorts   map[NetworkNodeAddress]uint64
+	refreshedAt time.Time
+	// connections are kept open and shared by the requests to the same node
+	conns map[NetworkNodeAddress]grpcConn
+}
+
+// grpcConn connection to the grpc server of a node, dialled at target
+type grpcConn struct {
+	target string
+	conn   *grpc.ClientConn
+}
+
+func (g *grpcNodeClient) GetStatus(nodeAddress NetworkNodeAddress, nonce models.Hash) (NetworkNodeStatus, error) {
+	client, err := g.client(nodeAddress)
+	if err != nil {
+		return NetworkNodeStatus{}, fmt.Errorf("GetStatus: %w", err)
+	}
+	if client == nil {
+		return g.httpClient.GetStatus(nodeAddress, nonce)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), GRPC_SYNC_TIMEOUT_IN_SECONDS*time.Second)
+	defer cancel()
+	status, err := client.GetStatus(ctx, &pb.GetStatusRequest{Nonce: nonce[:]})
+	if err != nil {
+		return NetworkNodeStatus{}, fmt.Errorf("GetStatus: %w", err)
+	}
+	return statusFromPb(status)
+}
+
+func (g *grpcNodeClient) GetNextBlocksFromHash(nodeAddress NetworkNodeAddress, hash models.Hash) ([]models.Block, error) {
+	client, err := g.client(nodeAddress)
+	if err != nil {
+		return nil, fmt.Errorf("GetNextBlocksFromHash: %w", err)
+	}
+	if client == nil {
+		return g.httpClient.GetNextBlocksFromHash(nodeAddress, hash)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), GRPC_SYNC_TIMEOUT_IN_SECONDS*time.Second)
+	defer cancel()
+	stream, err := client.StreamBlocks(ctx, &pb.StreamBlocksRequest{From: hash[:]})
+	if err != nil {
+		return nil, fmt.Errorf("GetNextBlocksFromHash: %w", err)
+	}
+
+	blocks := make([]models.Block, 0)
+	for {
+		pbBlock, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("GetNextBlocksFromHash: %w", err)
+		}
+		block, err := blockFromPb(pbBlock)
+		if err != nil {
+			return nil, fmt.Errorf("GetNextBlocksFromHash: %w", err)
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+func (g *grpcNodeClient) RelayTx(nodeAddress NetworkNodeAddress, tx models.Transaction) error {
+	client, err := g.client(nodeAddress)
+	if err != nil {
+		return fmt.Errorf("RelayTx: %w", err)
+	}
+	if client == nil {
+		return g.httpClient.RelayTx(nodeAddress, tx)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RELAY_TX_TIMEOUT_IN_SECONDS*time.Second)
+	defer cancel()
+	if _, err = client.RelayTransaction(ctx, txToPb(tx)); err != nil {
+		return fmt.Errorf("RelayTx: %w", err)
+	}
+	return nil
+}
+
+func (g *grpcNodeClient) AnnounceBlock(nodeAddress NetworkNodeAddress, announcement BlockAnnouncement) error {
+	client, err := g.client(nodeAddress)
+	if err != nil {
+		return fmt.Errorf("AnnounceBlock: %w", err)
+	}
+	if client == nil {
+		return g.httpClient.AnnounceBlock(nodeAddress, announcement)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ANNOUNCE_BLOCK_TIMEOUT_IN_SECONDS*time.Second)
+	defer cancel()
+	if _, err = client.AnnounceBlock(ctx, &pb.BlockAnnouncement{
+		Hash:   announcement.Hash[:],
+		Height: announcement.Height,
+		Ip:     announcement.Node.ip,
+		Port:   announcement.Node.port,
+	}); err != nil {
+		return fmt.Errorf("AnnounceBlock: %w", err)
+	}
+	return nil
+}
+
+// client returns a client of the grpc server of the node, nil if the node doesn't expose one
+func (g *grpcNodeClient) client(nodeAddress NetworkNodeAddress) (pb.NodeClient, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.refreshGrpcPorts(); err != nil {
+		return nil, err
+	}
+	grpcPort := g.grpcPorts[nodeAddress]
+	if grpcPort == 0 {
+		return nil, nil
+	}
+	target := net.JoinHostPort(nodeAddress.ip, strconv.FormatUint(grpcPort, 10))
+
+	conn, ok := g.conns[nodeAddress]
+	if !ok || conn.target != target {
+		// the connection is established lazily by the first request
+		dialled, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial node %s: %w", target, err)
+		}
+		g.closeConn(nodeAddress)
+		conn = grpcConn{target: target, conn: dialled}
+		g.conns[nodeAddress] = conn
+	}
+	return pb.NewNodeClient(conn.conn), nil
+}
+
+// refreshGrpcPorts reads the grpc ports of the peers from the node database once they are too old, the connections
+// to the nodes which have left the database or stopped exposing a grpc server are closed
+func (g *grpcNodeClient) refreshGrpcPorts() error {
+	if g.grpcPorts != nil && time.Since(g.refreshedAt) < GRPC_PEERS_REFRESH_INTERVAL_IN_SECONDS*time.Second {
+		return nil
+	}
+
+	nodes, err := g.nodeService.List()
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	g.grpcPorts = make(map[NetworkNodeAddress]uint64, len(nodes))
+	for address, node := range nodes {
+		if node.GrpcPort > 0 {
+			g.grpcPorts[address] = node.GrpcPort
+		}
+	}
+	g.refreshedAt = time.Now()
+
+	for address := range g.conns {
+		if _, ok := g.grpcPorts[address]; !ok {
+			g.closeConn(address)
+		}
+	}
+	return nil
+}
+
+// closeConn closes the connection to the node if there is one
+func (g *grpcNodeClient) closeConn(nodeAddress NetworkNodeAddress) {
+	conn, ok := g.conns[nodeAddress]
+	if !ok {
+		return
+	}
+	if err := conn.conn.Close(); err != nil {
+		Logger.Debugf("closeConn: connection to node %s not closed: %s", conn.target, err)
+	}
+	delete(g.conns, nodeAddress)
+}
@@ -3,10 +3,14 @@ package nodes
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 )
 
 const NODES_DOMAIN_URL = "/api/nodes"
@@ -19,6 +23,10 @@ func RunDomain(
 	blockService services.BlockService,
 	syncNodeRefreshIntervalInSeconds uint32,
 	createNewBlockIntervalInSeconds uint32,
+	thisNodeAddress NetworkNodeAddress,
+	identity *NodeIdentity,
+	transportConf TransportConf,
+	operatorMiddleware gin.HandlerFunc,
 	middlewares ...gin.HandlerFunc,
 ) error {
 	v1 := r.Group(NODES_DOMAIN_URL)
@@ -26,12 +34,47 @@ func RunDomain(
 		v1.Use(middleware)
 	}
 
+	blockMetrics := NewBlockMetrics()
+	seenTxs := NewSeenTxs(MaxSeenTxs)
+	announcedBlocks := make(chan BlockAnnouncement, MaxPendingAnnouncements)
+
+	client, err := NewNodeClient(transportConf, nodeService)
+	if err != nil {
+		return fmt.Errorf("RunDomain: node client cannot be created: %w", err)
+	}
+
+	env := &NodesEnv{
+		nodeService:        nodeService,
+		state:              state,
+		transactionService: transactionService,
+		blockService:       blockService,
+		blockMetrics:       blockMetrics,
+		seenTxs:            seenTxs,
+		announcedBlocks:    announcedBlocks,
+		identity:           identity,
+		client:             client,
+		peerRegistrations:  NewPeerRegistrations(PEER_REGISTRATION_INTERVAL_IN_SECONDS * time.Second),
+		grpcPort:           transportConf.grpcPort,
+
+		operatorMiddlewares: []gin.HandlerFunc{operatorMiddleware},
+	}
+
 	// register http endpoints
-	NodesRegister(v1.Group("/"), &NodesEnv{
-		nodeService:  nodeService,
-		state:        state,
-		blockService: blockService,
-	})
+	NodesRegister(v1.Group("/"), env)
+
+	// serve the node protocol over grpc on its own port
+	if transportConf.grpcPort > 0 {
+		listener, err := net.Listen("tcp", net.JoinHostPort(thisNodeAddress.ip, strconv.FormatUint(transportConf.grpcPort, 10)))
+		if err != nil {
+			return fmt.Errorf("RunDomain: grpc server cannot listen: %w", err)
+		}
+		go func() {
+			Logger.Infof("RunDomain: start grpc server on %s", listener.Addr().String())
+			if err := NewGrpcServer(env).Serve(listener); err != nil {
+				Logger.Errorf("RunDomain: grpc server has stopped: %s", err)
+			}
+		}()
+	}
 
 	// run background tasks
 	manager, err := NewNodeTaskManager(
@@ -41,6 +84,11 @@ func RunDomain(
 		state,
 		transactionService,
 		blockService,
+		blockMetrics,
+		seenTxs,
+		thisNodeAddress,
+		announcedBlocks,
+		client,
 	)
 	if err != nil {
 		return fmt.Errorf("RunDomain: node task manager cannot start: %w", err)
@@ -51,5 +99,8 @@ func RunDomain(
 
 	ctx = context.Background()
 	go manager.RunSync(ctx)
+
+	ctx = context.Background()
+	go manager.RunGossip(ctx)
 	return nil
 }
@@ -0,0 +1,163 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+const (
+	// MaxSeenTxs number of relayed transactions remembered so they are not relayed twice
+	MaxSeenTxs = 10000
+	// RELAY_TX_TIMEOUT_IN_SECONDS time given to a peer to accept a relayed transaction
+	RELAY_TX_TIMEOUT_IN_SECONDS = 5
+	// MaxRelayWorkers number of transactions sent to the peers at the same time
+	MaxRelayWorkers = 16
+	// MaxPendingRelays number of transactions waiting to be sent to a peer, the next ones are not relayed
+	MaxPendingRelays = 1024
+)
+
+// txRelay a transaction waiting to be sent to a peer
+type txRelay struct {
+	node   NetworkNodeAddress
+	txHash models.TransactionId
+	tx     models.Transaction
+}
+
+// SeenTxs remembers the transactions already relayed to the peers, so a transaction going around the network
+// doesn't bounce back and forth between the nodes
+type SeenTxs struct {
+	mu sync.Mutex
+
+	size     int
+	txs      map[models.TransactionId]struct{}
+	txsQueue []models.TransactionId
+}
+
+func NewSeenTxs(size int) *SeenTxs {
+	return &SeenTxs{
+		size: size,
+		txs:  make(map[models.TransactionId]struct{}, size),
+	}
+}
+
+// Has tells if a transaction has already been relayed
+func (s *SeenTxs) Has(hash models.TransactionId) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.txs[hash]
+	return ok
+}
+
+// Add marks a transaction as relayed, returns false if it already was
+// the oldest transactions are forgotten first once the cache is full
+func (s *SeenTxs) Add(hash models.TransactionId) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.txs[hash]; ok {
+		return false
+	}
+	if len(s.txsQueue) >= s.size {
+		delete(s.txs, s.txsQueue[0])
+		s.txsQueue = s.txsQueue[1:]
+	}
+	s.txs[hash] = struct{}{}
+	s.txsQueue = append(s.txsQueue, hash)
+	return true
+}
+
+// RunGossip relays the transactions added to the pool to the active peers
+// whether they have been submitted to this node or relayed by another peer
+func (n *NodeTaskManager) RunGossip(ctx context.Context) {
+	pendingTxs := n.transactionService.SubscribePendingTxs()
+
+	// a pool of workers sends the transactions, however many transactions and peers there are
+	relays := make(chan txRelay, MaxPendingRelays)
+	for i := 0; i < MaxRelayWorkers; i++ {
+		go n.relayTxs(ctx, relays)
+	}
+
+	for {
+		select {
+		case tx := <-pendingTxs:
+			txHash, err := tx.Hash()
+			if err != nil {
+				Logger.Errorf("RunGossip: failed to hash transaction: %s", err)
+				continue
+			}
+			// a transaction is only sent once to each peer
+			if !n.seenTxs.Add(txHash) {
+				continue
+			}
+
+			nodes, err := n.nodeService.List()
+			if err != nil {
+				Logger.Errorf("RunGossip: failed to list nodes: %s", err)
+				continue
+			}
+			for nodeAddress, node := range nodes {
+				if !node.IsActive || nodeAddress == n.thisNodeAddress || n.nodeService.IsBanned(nodeAddress) {
+					continue
+				}
+				select {
+				case relays <- txRelay{node: nodeAddress, txHash: txHash, tx: tx}:
+				default:
+					Logger.Warnf("RunGossip: too many relays pending, transaction %s not relayed to %s", models.Hash(txHash).Hex(), nodeAddress.String())
+				}
+			}
+		case <-ctx.Done():
+			Logger.Debugf("RunGossip: Stop relaying transactions")
+			return
+		}
+	}
+}
+
+// relayTxs sends the queued transactions to the peers until the gossip stops
+func (n *NodeTaskManager) relayTxs(ctx context.Context, relays <-chan txRelay) {
+	for {
+		select {
+		case relay := <-relays:
+			if err := n.client.RelayTx(relay.node, relay.tx); err != nil {
+				Logger.Debugf("relayTxs: transaction %s not relayed to %s: %s", models.Hash(relay.txHash).Hex(), relay.node.String(), err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func relayTxToNode(nodeAddress NetworkNodeAddress, tx models.Transaction) error {
+	// generate url
+	url := fmt.Sprintf("http://%s%s%s", nodeAddress.String(), NODES_DOMAIN_URL, TRANSACTIONS_NODE_ENDPOINT)
+
+	// marshall payload
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return fmt.Errorf("relayTxToNode: failed to marshall transaction: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RELAY_TX_TIMEOUT_IN_SECONDS*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := peerHttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("relayTxToNode: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("relayTxToNode: transaction refused with status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package nodes
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+// testNodeClient records the transactions relayed to each peer
+type testNodeClient struct {
+	NodeClient
+
+	mu        sync.Mutex
+	relayedTx map[NetworkNodeAddress][]models.Transaction
+	relays    chan struct{}
+}
+
+func (c *testNodeClient) RelayTx(nodeAddress NetworkNodeAddress, tx models.Transaction) error {
+	c.mu.Lock()
+	c.relayedTx[nodeAddress] = append(c.relayedTx[nodeAddress], tx)
+	c.mu.Unlock()
+	c.relays <- struct{}{}
+	return nil
+}
+
+func TestSeenTxs_Add(t *testing.T) {
+	// define variables
+	hashes := []models.TransactionId{{1}, {2}, {3}}
+	s := NewSeenTxs(2)
+
+	// a transaction is only relayed the first time it is seen
+	if !s.Add(hashes[0]) {
+		t.Errorf("Add() = false, want true for a transaction never seen")
+	}
+	if s.Add(hashes[0]) {
+		t.Errorf("Add() = true, want false for a transaction already seen")
+	}
+
+	// the oldest transactions are forgotten first
+	s.Add(hashes[1])
+	s.Add(hashes[2])
+	if s.Has(hashes[0]) {
+		t.Errorf("Has() = true, want false for a transaction seen before the cache was full")
+	}
+	if !s.Has(hashes[1]) || !s.Has(hashes[2]) {
+		t.Errorf("Has() = false, want true for the latest transactions seen")
+	}
+}
+
+func TestNodeTaskManager_RunGossip(t *testing.T) {
+	test.InitTestContext()
+
+	// define variables
+	thisNodeAddress := NewNetworkNodeAddress("localhost", 8080)
+	peers := []NetworkNodeAddress{NewNetworkNodeAddress("localhost", 8081), NewNetworkNodeAddress("localhost", 8082)}
+	u := newTestNodeService(t)
+	if err := u.Add(map[NetworkNodeAddress]NetworkNode{
+		peers[1]:                                 {Name: "Beta", IsActive: true},
+		thisNodeAddress:                          {Name: "Self", IsActive: true},
+		NewNetworkNodeAddress("localhost", 8083): {Name: "Gamma", IsActive: false},
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	txService, _ := services.NewFileTransactionService(testStateReader{
+		balances: map[models.Account]uint{sender: 1000},
+	}, services.DefaultMempoolConf())
+	client := &testNodeClient{relayedTx: make(map[NetworkNodeAddress][]models.Transaction), relays: make(chan struct{}, 10)}
+	n := &NodeTaskManager{
+		nodeService:        u,
+		transactionService: txService,
+		seenTxs:            NewSeenTxs(MaxSeenTxs),
+		thisNodeAddress:    thisNodeAddress,
+		client:             client,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.RunGossip(ctx)
+	// the gossip has to subscribe to the pool before the transactions are added
+	time.Sleep(100 * time.Millisecond)
+
+	// the first transaction has already been relayed, the second one is sent to each active peer
+	seenTx := newRelayedTx(senderKey, 0)
+	seenTxHash, _ := seenTx.Hash()
+	n.seenTxs.Add(seenTxHash)
+	tx := newRelayedTx(senderKey, 1)
+	if err := txService.AddPendingTx(*seenTx); err != nil {
+		t.Fatalf("AddPendingTx() error = %v", err)
+	}
+	if err := txService.AddPendingTx(*tx); err != nil {
+		t.Fatalf("AddPendingTx() error = %v", err)
+	}
+
+	for range peers {
+		select {
+		case <-client.relays:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("RunGossip() didn't relay the transaction to the %d active peers", len(peers))
+		}
+	}
+	// leave time to any other relay to show up
+	time.Sleep(100 * time.Millisecond)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if len(client.relayedTx) != len(peers) {
+		t.Errorf("RunGossip() relayed transactions to %v, want %v", client.relayedTx, peers)
+	}
+	for _, peer := range peers {
+		if relayedTxs := client.relayedTx[peer]; len(relayedTxs) != 1 || relayedTxs[0].Nonce != tx.Nonce {
+			t.Errorf("RunGossip() relayed %v to %s, want only the transaction with nonce %d", relayedTxs, peer.String(), tx.Nonce)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+	"github.com/v4lproik/simple-blockchain-quickstart/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrInvalidHashLength = errors.New("hash should be a 32 byte array")
+
+// grpcNodeServer serves the node protocol over grpc, next to the http endpoints
+type grpcNodeServer struct {
+	pb.UnimplementedNodeServer
+	env *NodesEnv
+}
+
+func NewGrpcServer(env *NodesEnv) *grpc.Server {
+	server := grpc.NewServer()
+	pb.RegisterNodeServer(server, &grpcNodeServer{env: env})
+	return server
+}
+
+func (s *grpcNodeServer) GetStatus(ctx context.Context, req *pb.GetStatusRequest) (*pb.Status, error) {
+	// a status requested without nonce is signed with an empty one
+	nonce := models.Hash{}
+	if len(req.Nonce) > 0 {
+		var err error
+		if nonce, err = hashFromBytes(req.Nonce); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	nodes, err := s.env.nodeService.List()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "nodes could not be found")
+	}
+
+	response, err := s.env.signedStatus(nodes, nonce)
+	if err != nil {
+		Logger.Error(fmt.Errorf("GetStatus: couldn't sign status: %w", err))
+		return nil, status.Error(codes.Internal, "status could not be signed")
+	}
+	return statusToPb(response), nil
+}
+
+func (s *grpcNodeServer) StreamBlocks(req *pb.StreamBlocksRequest, stream pb.Node_StreamBlocksServer) error {
+	hashFrom, err := hashFromBytes(req.From)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	Logger.Debugf("starting process of streaming blocks from hash=%s", hashFrom.Hex())
+
+	blocks, err := s.env.blockService.GetNextBlocksFromHash(hashFrom)
+	if err != nil {
+		Logger.Error(fmt.Errorf("StreamBlocks: couldn't retrieve blocks from DB: %w", err))
+		return status.Error(codes.Internal, "blocks could not be retrieved")
+	}
+
+	for _, block := range blocks {
+		if err = stream.Send(blockToPb(block)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *grpcNodeServer) RelayTransaction(ctx context.Context, req *pb.Transaction) (*pb.RelayTransactionResponse, error) {
+	// the accounts are checked the same way the http endpoint does
+	if _, err := models.NewAccount(req.From); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := models.NewAccount(req.To); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	tx := txFromPb(req)
+	txHash, err := tx.Hash()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err = s.env.relayTx(txHash, tx); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &pb.RelayTransactionResponse{}, nil
+}
+
+func (s *grpcNodeServer) AnnounceBlock(ctx context.Context, req *pb.BlockAnnouncement) (*pb.AnnounceBlockResponse, error) {
+	hash, err := hashFromBytes(req.Hash)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.Height == 0 || req.Ip == "" || req.Port == 0 {
+		return nil, status.Error(codes.InvalidArgument, "height, ip and port are required")
+	}
+
+	if _, err = s.env.queueBlockAnnouncement(BlockAnnouncement{
+		Hash:   hash,
+		Height: req.Height,
+		Node:   NewNetworkNodeAddress(req.Ip, req.Port),
+	}); err != nil {
+		if errors.Is(err, ErrUntrustedAnnouncement) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if errors.Is(err, ErrTooManyAnnouncements) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.AnnounceBlockResponse{}, nil
+}
+
+func hashFromBytes(b []byte) (models.Hash, error) {
+	var hash models.Hash
+	if len(b) != len(hash) {
+		return hash, ErrInvalidHashLength
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+func statusToPb(response NetworkNodesResponse) *pb.Status {
+	networkNodes := make([]*pb.NetworkNode, len(response.NetworkNodeResponse))
+	for i, node := range response.NetworkNodeResponse {
+		networkNodes[i] = &pb.NetworkNode{
+			Name:        node.Name,
+			Ip:          node.Ip,
+			Port:        node.Port,
+			IsBootstrap: node.IsBootstrap,
+			IsActive:    node.IsActive,
+			GrpcPort:    node.GrpcPort,
+		}
+	}
+
+	return &pb.Status{
+		BlockHash:    response.Hash[:],
+		BlockHeight:  response.Height,
+		TotalWork:    response.Work,
+		NetworkNodes: networkNodes,
+		Handshake: &pb.Handshake{
+			PublicKey:       response.Handshake.PublicKey,
+			ChainId:         response.Handshake.ChainId,
+			GenesisHash:     response.Handshake.GenesisHash[:],
+			ProtocolVersion: response.Handshake.ProtocolVersion,
+			GrpcPort:        response.Handshake.GrpcPort,
+			Signature:       response.Handshake.Signature,
+		},
+	}
+}
+
+func statusFromPb(s *pb.Status) (NetworkNodeStatus, error) {
+	var err error
+	statusNode := NetworkNodeStatus{}
+	if statusNode.Hash, err = hashFromBytes(s.BlockHash); err != nil {
+		return NetworkNodeStatus{}, fmt.Errorf("statusFromPb: invalid block hash: %w", err)
+	}
+	statusNode.Height = s.BlockHeight
+	if work, ok := new(big.Int).SetString(s.TotalWork, 10); ok {
+		statusNode.Work = work
+	}
+
+	// an unsigned status is rejected when the handshake is verified
+	if handshake := s.Handshake; handshake != nil {
+		statusNode.Handshake = NodeHandshake{
+			PublicKey:       handshake.PublicKey,
+			ChainId:         handshake.ChainId,
+			ProtocolVersion: handshake.ProtocolVersion,
+			GrpcPort:        handshake.GrpcPort,
+			Signature:       handshake.Signature,
+		}
+		if statusNode.Handshake.GenesisHash, err = hashFromBytes(handshake.GenesisHash); err != nil {
+			return NetworkNodeStatus{}, fmt.Errorf("statusFromPb: invalid genesis hash: %w", err)
+		}
+	}
+
+	statusNode.NetworkNodes = make(map[NetworkNodeAddress]NetworkNode, len(s.NetworkNodes))
+	for _, node := range s.NetworkNodes {
+		statusNode.NetworkNodes[NewNetworkNodeAddress(node.Ip, node.Port)] = NetworkNode{
+			Name:        node.Name,
+			IsBootstrap: node.IsBootstrap,
+			IsActive:    node.IsActive,
+			GrpcPort:    node.GrpcPort,
+		}
+	}
+	return statusNode, nil
+}
+
+func blockToPb(block models.Block) *pb.Block {
+	txs := make([]*pb.Transaction, len(block.Txs))
+	for i, tx := range block.Txs {
+		txs[i] = txToPb(tx)
+	}
+
+	header := block.Header
+	return &pb.Block{
+		Header: &pb.BlockHeader{
+			Parent:    header.Parent[:],
+			TxRoot:    header.TxRoot[:],
+			Height:    header.Height,
+			Bits:      header.Bits,
+			Nonce:     header.Nonce,
+			Time:      header.Time,
+			Miner:     string(header.Miner),
+			Signature: header.Signature,
+		},
+		Transactions: txs,
+	}
+}
+
+// blockFromPb creates the block as it has been sent, so its transactions root can be verified
+func blockFromPb(b *pb.Block) (models.Block, error) {
+	header := b.GetHeader()
+	if header == nil {
+		return models.Block{}, errors.New("blockFromPb: block header is missing")
+	}
+	parent, err := hashFromBytes(header.Parent)
+	if err != nil {
+		return models.Block{}, fmt.Errorf("blockFromPb: invalid parent hash: %w", err)
+	}
+	txRoot, err := hashFromBytes(header.TxRoot)
+	if err != nil {
+		return models.Block{}, fmt.Errorf("blockFromPb: invalid transactions root: %w", err)
+	}
+
+	txs := make([]models.Transaction, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		txs[i] = txFromPb(tx)
+	}
+
+	return models.Block{
+		Header: models.BlockHeader{
+			Parent:    parent,
+			TxRoot:    txRoot,
+			Height:    header.Height,
+			Bits:      header.Bits,
+			Nonce:     header.Nonce,
+			Time:      header.Time,
+			Miner:     models.Account(header.Miner),
+			Signature: header.Signature,
+		},
+		Txs: txs,
+	}, nil
+}
+
+func txToPb(tx models.Transaction) *pb.Transaction {
+	return &pb.Transaction{
+		From:      string(tx.From),
+		To:        string(tx.To),
+		Value:     uint64(tx.Value),
+		Fee:       uint64(tx.Fee),
+		Nonce:     tx.Nonce,
+		Reason:    tx.Reason,
+		Time:      tx.Time,
+		ChainId:   tx.ChainId,
+		Signature: tx.Signature,
+	}
+}
+
+func txFromPb(tx *pb.Transaction) models.Transaction {
+	return models.Transaction{
+		From:      models.Account(tx.From),
+		To:        models.Account(tx.To),
+		Value:     uint(tx.Value),
+		Fee:       uint(tx.Fee),
+		Nonce:     tx.Nonce,
+		Reason:    tx.Reason,
+		Time:      tx.Time,
+		ChainId:   tx.ChainId,
+		Signature: tx.Signature,
+	}
+}
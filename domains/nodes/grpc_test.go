@@ -0,0 +1,111 @@
+package nodes
+
+import (
+	"net"
+	"testing"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGrpcNodeClient(t *testing.T) {
+	test.InitTestContext()
+
+	// serve the test node over grpc
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	grpcPort := uint64(listener.Addr().(*net.TCPAddr).Port)
+	server := NewGrpcServer(&NodesEnv{
+		nodeService:        newTestNodeService(t),
+		identity:           identity,
+		state:              state,
+		transactionService: transactionService,
+		blockService:       blockService,
+		blockMetrics:       NewBlockMetrics(),
+		seenTxs:            seenTxs,
+		announcedBlocks:    make(chan BlockAnnouncement, 1),
+		grpcPort:           grpcPort,
+	})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	// the node is known with its grpc port
+	address := NewNetworkNodeAddress("127.0.0.1", 8083)
+	u := newTestNodeService(t)
+	if err = u.Add(map[NetworkNodeAddress]NetworkNode{
+		address: {Name: "Grpc", IsActive: true, GrpcPort: grpcPort},
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	client, err := NewNodeClient(NewTransportConf(GRPC_TRANSPORT, 0), u)
+	if err != nil {
+		t.Fatalf("NewNodeClient() error = %v", err)
+	}
+
+	t.Run("the status of the node should be signed with the nonce", func(t *testing.T) {
+		nonce, _ := NewHandshakeNonce()
+		status, err := client.GetStatus(address, nonce)
+		if err != nil {
+			t.Fatalf("GetStatus() error = %v", err)
+		}
+		if status.Hash != state.GetLatestBlockHash() || status.Height != state.GetLatestBlockHeight() {
+			t.Errorf("GetStatus() = %+v, want the latest block of the node", status)
+		}
+		if err = VerifyHandshake(status, nonce, test.ChainId, state.GenesisHash()); err != nil {
+			t.Errorf("VerifyHandshake() error = %v", err)
+		}
+		if status.Handshake.GrpcPort != grpcPort {
+			t.Errorf("GetStatus() grpc port = %d, want %d", status.Handshake.GrpcPort, grpcPort)
+		}
+	})
+
+	t.Run("the grpc ports of the peers should be kept between the requests", func(t *testing.T) {
+		// the node can't be reached through http, only the cached grpc port lets the client reach it
+		if err := u.Remove("Grpc"); err != nil {
+			t.Fatalf("Remove() error = %v", err)
+		}
+		if _, err := client.GetStatus(address, models.Hash{}); err != nil {
+			t.Errorf("GetStatus() error = %v", err)
+		}
+	})
+
+	t.Run("the blocks following a block should be streamed", func(t *testing.T) {
+		got, err := client.GetNextBlocksFromHash(address, models.Hash{})
+		if err != nil {
+			t.Fatalf("GetNextBlocksFromHash() error = %v", err)
+		}
+		if len(got) != len(blocks) {
+			t.Fatalf("GetNextBlocksFromHash() returned %d blocks, want %d", len(got), len(blocks))
+		}
+		for i := range got {
+			gotHash, _ := got[i].Hash()
+			wantHash, _ := blocks[i].Hash()
+			if gotHash != wantHash {
+				t.Errorf("GetNextBlocksFromHash() block %d hash = %s, want %s", i, gotHash.Hex(), wantHash.Hex())
+			}
+		}
+	})
+
+	t.Run("a transaction not signed by its sender should be refused", func(t *testing.T) {
+		if err := client.RelayTx(address, *unsignedTx); err == nil {
+			t.Errorf("RelayTx() error = nil, want error")
+		}
+	})
+
+	t.Run("a known block announcement should be accepted", func(t *testing.T) {
+		if err := client.AnnounceBlock(address, BlockAnnouncement{Hash: blockHash, Height: 2, Node: address}); err != nil {
+			t.Errorf("AnnounceBlock() error = %v", err)
+		}
+	})
+
+	t.Run("a new block announced by a node which is not a verified peer should be refused", func(t *testing.T) {
+		err := client.AnnounceBlock(address, BlockAnnouncement{Hash: models.Hash{1}, Height: 5, Node: address})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("AnnounceBlock() error = %v, want %v", err, codes.PermissionDenied)
+		}
+	})
+}
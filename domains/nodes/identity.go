@@ -0,0 +1,201 @@
+package nodes
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+)
+
+// PROTOCOL_VERSION version of the protocol spoken by this node with its peers
+const PROTOCOL_VERSION = 1
+
+var (
+	ErrHandshakeMissing          = errors.New("node status is not signed")
+	ErrHandshakeSignatureInvalid = errors.New("node status signature is not valid")
+	ErrHandshakeChainIdMismatch  = errors.New("node chain id doesn't match with ours")
+	ErrHandshakeGenesisMismatch  = errors.New("node genesis hash doesn't match with ours")
+	ErrNodeIdentityChanged       = errors.New("node public key has changed")
+)
+
+// NodeIdentity keypair identifying this node within the network
+type NodeIdentity struct {
+	key *ecdsa.PrivateKey
+}
+
+func NewNodeIdentity(key *ecdsa.PrivateKey) *NodeIdentity {
+	return &NodeIdentity{key: key}
+}
+
+// LoadOrCreateNodeIdentity loads the identity of this node, a new identity is generated and saved the first time
+// the node starts so the node keeps its identity across restarts
+func LoadOrCreateNodeIdentity(identityKeyFilePath string) (*NodeIdentity, error) {
+	if _, err := os.Stat(identityKeyFilePath); err == nil {
+		key, err := crypto.LoadECDSA(identityKeyFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("LoadOrCreateNodeIdentity: failed to load identity key: %w", err)
+		}
+		return NewNodeIdentity(key), nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("LoadOrCreateNodeIdentity: failed to open identity key: %w", err)
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("LoadOrCreateNodeIdentity: failed to generate identity key: %w", err)
+	}
+	if err = crypto.SaveECDSA(identityKeyFilePath, key); err != nil {
+		return nil, fmt.Errorf("LoadOrCreateNodeIdentity: failed to save identity key: %w", err)
+	}
+	return NewNodeIdentity(key), nil
+}
+
+// PublicKey returns the compressed public key of this node
+func (i *NodeIdentity) PublicKey() string {
+	return hexutil.Encode(crypto.CompressPubkey(&i.key.PublicKey))
+}
+
+// NodeHandshake identity of a node, the chain it follows and the port of its grpc server (0 if the node can only
+// be reached through http), signed along with its status
+type NodeHandshake struct {
+	PublicKey       string           `json:"public_key"`
+	ChainId         string           `json:"chain_id"`
+	GenesisHash     models.Hash      `json:"genesis_hash"`
+	ProtocolVersion uint32           `json:"protocol_version"`
+	GrpcPort        uint64           `json:"grpc_port,omitempty"`
+	Signature       models.Signature `json:"signature"`
+}
+
+// handshakePayload part of the node status covered by the signature, a node can't lie about its chain or its
+// peers without its signature being invalid, the nonce sent by the verifier prevents the status from being replayed
+type handshakePayload struct {
+	PublicKey       string          `json:"public_key"`
+	ChainId         string          `json:"chain_id"`
+	GenesisHash     models.Hash     `json:"genesis_hash"`
+	ProtocolVersion uint32          `json:"protocol_version"`
+	GrpcPort        uint64          `json:"grpc_port"`
+	Nonce           models.Hash     `json:"nonce"`
+	BlockHash       models.Hash     `json:"block_hash"`
+	BlockHeight     uint64          `json:"block_height"`
+	Work            string          `json:"total_work"`
+	NetworkNodes    []handshakeNode `json:"network_nodes"`
+}
+
+type handshakeNode struct {
+	Name        string `json:"name"`
+	Ip          string `json:"ip"`
+	Port        uint64 `json:"port"`
+	IsBootstrap bool   `json:"is_bootstrap"`
+	IsActive    bool   `json:"is_active"`
+	GrpcPort    uint64 `json:"grpc_port"`
+}
+
+func handshakeHash(h NodeHandshake, nonce models.Hash, status NetworkNodeStatus) ([]byte, error) {
+	work := ""
+	if status.Work != nil {
+		work = status.Work.String()
+	}
+
+	// the nodes are sorted by address, the signer and the verifier hash them in the same order
+	nodes := make([]handshakeNode, 0, len(status.NetworkNodes))
+	for address, node := range status.NetworkNodes {
+		nodes = append(nodes, handshakeNode{
+			Name:        node.Name,
+			Ip:          address.ip,
+			Port:        address.port,
+			IsBootstrap: node.IsBootstrap,
+			IsActive:    node.IsActive,
+			GrpcPort:    node.GrpcPort,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Ip != nodes[j].Ip {
+			return nodes[i].Ip < nodes[j].Ip
+		}
+		return nodes[i].Port < nodes[j].Port
+	})
+
+	payloadJson, err := json.Marshal(handshakePayload{
+		PublicKey:       h.PublicKey,
+		ChainId:         h.ChainId,
+		GenesisHash:     h.GenesisHash,
+		ProtocolVersion: h.ProtocolVersion,
+		GrpcPort:        h.GrpcPort,
+		Nonce:           nonce,
+		BlockHash:       status.Hash,
+		BlockHeight:     status.Height,
+		Work:            work,
+		NetworkNodes:    nodes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(payloadJson)
+	return hash[:], nil
+}
+
+// NewHandshakeNonce returns a random nonce a node has to sign its status with
+func NewHandshakeNonce() (models.Hash, error) {
+	var nonce models.Hash
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return models.Hash{}, fmt.Errorf("NewHandshakeNonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// Handshake signs the status of this node, along with the port of its grpc server, for the verifier which has sent the nonce
+func (i *NodeIdentity) Handshake(chainId string, genesisHash models.Hash, grpcPort uint64, nonce models.Hash, status NetworkNodeStatus) (NodeHandshake, error) {
+	handshake := NodeHandshake{
+		PublicKey:       i.PublicKey(),
+		ChainId:         chainId,
+		GenesisHash:     genesisHash,
+		ProtocolVersion: PROTOCOL_VERSION,
+		GrpcPort:        grpcPort,
+	}
+	hash, err := handshakeHash(handshake, nonce, status)
+	if err != nil {
+		return NodeHandshake{}, fmt.Errorf("Handshake: failed to hash handshake: %w", err)
+	}
+	handshake.Signature, err = crypto.Sign(hash, i.key)
+	if err != nil {
+		return NodeHandshake{}, fmt.Errorf("Handshake: failed to sign handshake: %w", err)
+	}
+	return handshake, nil
+}
+
+// VerifyHandshake checks the status of a node has been signed with our nonce by the public key it claims
+// and that the node follows the same chain as ours
+func VerifyHandshake(status NetworkNodeStatus, nonce models.Hash, chainId string, genesisHash models.Hash) error {
+	handshake := status.Handshake
+	if handshake.PublicKey == "" || len(handshake.Signature) == 0 {
+		return ErrHandshakeMissing
+	}
+	if handshake.ChainId != chainId {
+		return fmt.Errorf("%w: %s", ErrHandshakeChainIdMismatch, handshake.ChainId)
+	}
+	if handshake.GenesisHash != genesisHash {
+		return fmt.Errorf("%w: %s", ErrHandshakeGenesisMismatch, handshake.GenesisHash.Hex())
+	}
+
+	hash, err := handshakeHash(handshake, nonce, status)
+	if err != nil {
+		return fmt.Errorf("VerifyHandshake: failed to hash handshake: %w", err)
+	}
+	publicKey, err := hexutil.Decode(handshake.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrHandshakeSignatureInvalid, err.Error())
+	}
+	if len(handshake.Signature) != crypto.SignatureLength ||
+		!crypto.VerifySignature(publicKey, hash, handshake.Signature[:crypto.SignatureLength-1]) {
+		return ErrHandshakeSignatureInvalid
+	}
+	return nil
+}
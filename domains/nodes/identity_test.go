@@ -0,0 +1,116 @@
+package nodes
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+func TestLoadOrCreateNodeIdentity(t *testing.T) {
+	// the identity is generated the first time and kept afterwards
+	identityKeyFilePath := filepath.Join(t.TempDir(), "node_identity.key")
+	created, err := LoadOrCreateNodeIdentity(identityKeyFilePath)
+	if err != nil {
+		t.Fatalf("LoadOrCreateNodeIdentity() error = %v", err)
+	}
+	loaded, err := LoadOrCreateNodeIdentity(identityKeyFilePath)
+	if err != nil {
+		t.Fatalf("LoadOrCreateNodeIdentity() error = %v", err)
+	}
+	if created.PublicKey() != loaded.PublicKey() {
+		t.Errorf("LoadOrCreateNodeIdentity() public key = %s, want %s", loaded.PublicKey(), created.PublicKey())
+	}
+}
+
+func TestVerifyHandshake(t *testing.T) {
+	// define variables
+	key, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+	genesisHash := models.Hash{1}
+	nonce, _ := NewHandshakeNonce()
+
+	newSignedStatus := func(identity *NodeIdentity, chainId string, genesisHash models.Hash, nonce models.Hash) NetworkNodeStatus {
+		status := NetworkNodeStatus{
+			Hash:   models.Hash{2},
+			Height: 3,
+			Work:   big.NewInt(4),
+			NetworkNodes: map[NetworkNodeAddress]NetworkNode{
+				NewNetworkNodeAddress("localhost", 8081): {Name: "Alpha", IsActive: true},
+				NewNetworkNodeAddress("localhost", 8082): {Name: "Beta", IsActive: true, GrpcPort: 9082},
+			},
+		}
+		status.Handshake, _ = identity.Handshake(chainId, genesisHash, 8090, nonce, status)
+		return status
+	}
+	newStatus := func(identity *NodeIdentity, chainId string, genesisHash models.Hash) NetworkNodeStatus {
+		return newSignedStatus(identity, chainId, genesisHash, nonce)
+	}
+	liarStatus := newStatus(NewNodeIdentity(key), test.ChainId, genesisHash)
+	liarStatus.Height = 10
+	peersLiarStatus := newStatus(NewNodeIdentity(key), test.ChainId, genesisHash)
+	peersLiarStatus.NetworkNodes[NewNetworkNodeAddress("localhost", 8083)] = NetworkNode{Name: "Gamma", IsActive: true}
+	replayedStatus := newSignedStatus(NewNodeIdentity(key), test.ChainId, genesisHash, models.Hash{6})
+	impersonatorStatus := newStatus(NewNodeIdentity(otherKey), test.ChainId, genesisHash)
+	impersonatorStatus.Handshake.PublicKey = NewNodeIdentity(key).PublicKey()
+
+	tests := []struct {
+		name    string
+		status  NetworkNodeStatus
+		wantErr error
+	}{
+		{
+			name:    "a status signed by the node following our chain should be accepted",
+			status:  newStatus(NewNodeIdentity(key), test.ChainId, genesisHash),
+			wantErr: nil,
+		},
+		{
+			name:    "a status without handshake should return error",
+			status:  NetworkNodeStatus{Hash: models.Hash{2}, Height: 3, Work: big.NewInt(4)},
+			wantErr: ErrHandshakeMissing,
+		},
+		{
+			name:    "a status modified after being signed should return error",
+			status:  liarStatus,
+			wantErr: ErrHandshakeSignatureInvalid,
+		},
+		{
+			name:    "a status whose peers have been modified after being signed should return error",
+			status:  peersLiarStatus,
+			wantErr: ErrHandshakeSignatureInvalid,
+		},
+		{
+			name:    "a status signed with another nonce than ours should return error",
+			status:  replayedStatus,
+			wantErr: ErrHandshakeSignatureInvalid,
+		},
+		{
+			name:    "a status signed by another key than the one claimed should return error",
+			status:  impersonatorStatus,
+			wantErr: ErrHandshakeSignatureInvalid,
+		},
+		{
+			name:    "a status of a node following another chain id should return error",
+			status:  newStatus(NewNodeIdentity(key), "another-chain", genesisHash),
+			wantErr: ErrHandshakeChainIdMismatch,
+		},
+		{
+			name:    "a status of a node following another genesis should return error",
+			status:  newStatus(NewNodeIdentity(key), test.ChainId, models.Hash{5}),
+			wantErr: ErrHandshakeGenesisMismatch,
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyHandshake(tt.status, nonce, test.ChainId, genesisHash); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyHandshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package nodes
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+// LOCAL_BLOCK_SOURCE source of the blocks mined by this node
+const LOCAL_BLOCK_SOURCE = "local"
+
+// reasons a block can be rejected for, the first error matching the rejection is used
+var rejectedBlockReasons = []struct {
+	err    error
+	reason string
+}{
+	{models.ErrBlockProofOfWork, "proof_of_work"},
+	{models.ErrBlockSignatureMissing, "signature"},
+	{models.ErrBlockSignatureInvalid, "signature"},
+	{models.ErrBlockSignerMismatch, "signature"},
+	{models.ErrUnauthorizedSigner, "signer"},
+	{models.ErrSignerRecentlySigned, "signer"},
+	{models.ErrBlockTxRoot, "tx_root"},
+	{models.ErrBlockDifficulty, "difficulty"},
+	{models.ErrBlockTimeTooOld, "time_too_old"},
+	{models.ErrBlockTimeTooNew, "time_too_new"},
+	{models.ErrNextBlockHeight, "height"},
+	{models.ErrNextBlockHash, "parent"},
+	{models.ErrBlockMinerMissing, "miner"},
+	{models.ErrTxSignatureMissing, "transaction_signature"},
+	{models.ErrTxSignatureInvalid, "transaction_signature"},
+	{models.ErrTxSignerMismatch, "transaction_signature"},
+}
+
+// BlockMetrics counts the blocks this node has refused, so misbehaving peers can be spotted
+type BlockMetrics struct {
+	mu sync.Mutex
+
+	rejectedBlocks         uint64
+	rejectedBlocksByReason map[string]uint64
+	rejectedBlocksBySource map[string]uint64
+}
+
+func NewBlockMetrics() *BlockMetrics {
+	return &BlockMetrics{
+		rejectedBlocksByReason: make(map[string]uint64),
+		rejectedBlocksBySource: make(map[string]uint64),
+	}
+}
+
+// RejectBlock logs and counts a block refused by the state
+// source is either the address of the peer which has sent the block or LOCAL_BLOCK_SOURCE
+func (m *BlockMetrics) RejectBlock(source string, err error) {
+	reason := getRejectedBlockReason(err)
+
+	var rejectedBlockErr *models.RejectedBlockError
+	if errors.As(err, &rejectedBlockErr) {
+		Logger.Warnf("RejectBlock: block rejected source=%s hash=%s height=%d reason=%s: %s",
+			source, rejectedBlockErr.Hash.Hex(), rejectedBlockErr.Height, reason, rejectedBlockErr.Err)
+	} else {
+		Logger.Warnf("RejectBlock: block rejected source=%s reason=%s: %s", source, reason, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rejectedBlocks++
+	m.rejectedBlocksByReason[reason]++
+	m.rejectedBlocksBySource[source]++
+}
+
+// RejectedBlocks returns the number of rejected blocks, by reason and by source
+func (m *BlockMetrics) RejectedBlocks() (uint64, map[string]uint64, map[string]uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byReason := make(map[string]uint64, len(m.rejectedBlocksByReason))
+	for reason, count := range m.rejectedBlocksByReason {
+		byReason[reason] = count
+	}
+	bySource := make(map[string]uint64, len(m.rejectedBlocksBySource))
+	for source, count := range m.rejectedBlocksBySource {
+		bySource[source] = count
+	}
+	return m.rejectedBlocks, byReason, bySource
+}
+
+func getRejectedBlockReason(err error) string {
+	for _, rejectedBlockReason := range rejectedBlockReasons {
+		if errors.Is(err, rejectedBlockReason.err) {
+			return rejectedBlockReason.reason
+		}
+	}
+	// any other consensus rule broken by the transactions of the block (balance, nonce...)
+	return "transactions"
+}
@@ -2,6 +2,7 @@ package nodes
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
 )
@@ -9,7 +10,9 @@ import (
 type NetworkNodeStatus struct {
 	Hash         models.Hash
 	Height       uint64
+	Work         *big.Int
 	NetworkNodes map[NetworkNodeAddress]NetworkNode
+	Handshake    NodeHandshake
 }
 
 type NetworkNodeAddress struct {
@@ -40,4 +43,6 @@ type NetworkNode struct {
 	Name        string
 	IsBootstrap bool
 	IsActive    bool
+	// port of the grpc server of the node, 0 if the node can only be reached through http
+	GrpcPort uint64
 }
@@ -0,0 +1,52 @@
+package nodes
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+)
+
+var (
+	ErrPeerUnreachable      = errors.New("peer cannot be reached to verify its handshake")
+	ErrPeerHandshakeInvalid = errors.New("peer handshake is not valid")
+)
+
+// PEER_REGISTRATION_INTERVAL_IN_SECONDS time a client has to wait between two peer registrations
+const PEER_REGISTRATION_INTERVAL_IN_SECONDS = 10
+
+// PeerRegistrations limits the peer registrations asked by each client, as each registration makes this node
+// contact the registered peer to verify its handshake
+type PeerRegistrations struct {
+	mu sync.Mutex
+
+	interval      time.Duration
+	registrations map[string]time.Time
+}
+
+func NewPeerRegistrations(interval time.Duration) *PeerRegistrations {
+	return &PeerRegistrations{
+		interval:      interval,
+		registrations: make(map[string]time.Time),
+	}
+}
+
+// Allow tells if the client can register a peer, the clients are forgotten once the interval is over
+func (r *PeerRegistrations) Allow(client string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := utils.DefaultTimeService.Now()
+	for c, registeredAt := range r.registrations {
+		if now.Sub(registeredAt) >= r.interval {
+			delete(r.registrations, c)
+		}
+	}
+
+	if _, ok := r.registrations[client]; ok {
+		return false
+	}
+	r.registrations[client] = now
+	return true
+}
@@ -0,0 +1,28 @@
+package nodes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeerRegistrations_Allow(t *testing.T) {
+	// define variables
+	r := NewPeerRegistrations(time.Hour)
+
+	// a client can register a single peer per interval, whatever the other clients do
+	if !r.Allow("10.0.0.1") {
+		t.Errorf("Allow() = false, want true for the first registration of a client")
+	}
+	if r.Allow("10.0.0.1") {
+		t.Errorf("Allow() = true, want false for a second registration within the interval")
+	}
+	if !r.Allow("10.0.0.2") {
+		t.Errorf("Allow() = false, want true for the first registration of another client")
+	}
+
+	// the clients are forgotten once the interval is over
+	r = NewPeerRegistrations(0)
+	if !r.Allow("10.0.0.1") || !r.Allow("10.0.0.1") {
+		t.Errorf("Allow() = false, want true once the interval is over")
+	}
+}
@@ -0,0 +1,221 @@
+package nodes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+const (
+	// MaxPeerScore score of a peer which has never misbehaved
+	MaxPeerScore = 100
+	// PeerBanScore score under which a peer is banned
+	PeerBanScore = 0
+	// PeerProbationScore score given back to a peer once its ban is over
+	PeerProbationScore = 50
+	// PEER_BAN_DURATION_IN_SECONDS time during which a banned peer is not contacted
+	PEER_BAN_DURATION_IN_SECONDS = 10 * 60
+	// MaxPeerBans number of bans after which a peer is marked as inactive in the nodes file
+	MaxPeerBans = 3
+	// SLOW_PEER_LATENCY time after which a peer answering a request is considered slow
+	SLOW_PEER_LATENCY = 2 * time.Second
+
+	// points won or lost by a peer
+	peerSuccessPoints          = 1
+	peerSlowPoints             = -2
+	peerFailurePoints          = -10
+	peerHeightLiePoints        = -20
+	peerInvalidBlockPoints     = -30
+	peerInvalidHandshakePoints = -30
+)
+
+// PeerStats behaviour of a peer since this node has started
+type PeerStats struct {
+	Score             int
+	LatencyInMs       int64
+	Successes         uint64
+	Failures          uint64
+	InvalidBlocks     uint64
+	HeightLies        uint64
+	InvalidHandshakes uint64
+	Bans              uint64
+	BannedUntil       uint64
+	// public key the peer has first identified itself with
+	PublicKey string
+}
+
+// RecordSuccess records a request the peer has answered, a slow answer costs points
+func (u *NodeService) RecordSuccess(address NetworkNodeAddress, latency time.Duration) {
+	u.updatePeerStats(address, func(stats *PeerStats) int {
+		stats.Successes++
+		// moving average, the latest requests weigh more
+		if stats.Successes == 1 {
+			stats.LatencyInMs = latency.Milliseconds()
+		} else {
+			stats.LatencyInMs = (4*stats.LatencyInMs + latency.Milliseconds()) / 5
+		}
+		if latency > SLOW_PEER_LATENCY {
+			return peerSlowPoints
+		}
+		return peerSuccessPoints
+	})
+}
+
+// RecordFailure records a request the peer hasn't answered
+func (u *NodeService) RecordFailure(address NetworkNodeAddress) {
+	u.updatePeerStats(address, func(stats *PeerStats) int {
+		stats.Failures++
+		return peerFailurePoints
+	})
+}
+
+// RecordInvalidBlocks records blocks refused by this node which have been served by the peer
+func (u *NodeService) RecordInvalidBlocks(address NetworkNodeAddress) {
+	u.updatePeerStats(address, func(stats *PeerStats) int {
+		stats.InvalidBlocks++
+		return peerInvalidBlockPoints
+	})
+}
+
+// RecordHeightLie records a peer claiming a chain or a block it couldn't serve
+func (u *NodeService) RecordHeightLie(address NetworkNodeAddress) {
+	u.updatePeerStats(address, func(stats *PeerStats) int {
+		stats.HeightLies++
+		return peerHeightLiePoints
+	})
+}
+
+// RecordInvalidHandshake records a status the peer hasn't signed or which doesn't match with our chain
+func (u *NodeService) RecordInvalidHandshake(address NetworkNodeAddress) {
+	u.updatePeerStats(address, func(stats *PeerStats) int {
+		stats.InvalidHandshakes++
+		return peerInvalidHandshakePoints
+	})
+}
+
+// VerifyPublicKey checks the peer is still identified by the same public key, the first key seen is trusted
+func (u *NodeService) VerifyPublicKey(address NetworkNodeAddress, publicKey string) error {
+	u.statsMu.Lock()
+	defer u.statsMu.Unlock()
+
+	stats := u.peerStats(address)
+	if stats.PublicKey == "" {
+		stats.PublicKey = publicKey
+		return nil
+	}
+	if stats.PublicKey != publicKey {
+		return fmt.Errorf("%w: %s", ErrNodeIdentityChanged, publicKey)
+	}
+	return nil
+}
+
+// IsBanned tells if the peer shouldn't be contacted for now
+func (u *NodeService) IsBanned(address NetworkNodeAddress) bool {
+	u.statsMu.Lock()
+	defer u.statsMu.Unlock()
+
+	// no stats are created for a peer this node has never been in contact with
+	if _, ok := u.peersStats[address]; !ok {
+		return false
+	}
+	return u.peerStats(address).BannedUntil > 0
+}
+
+// IsTrusted tells if the node is a known and active peer, not banned, which has identified itself with a verified handshake
+func (u *NodeService) IsTrusted(address NetworkNodeAddress) (bool, error) {
+	nodes, err := u.List()
+	if err != nil {
+		return false, fmt.Errorf("IsTrusted: %w", err)
+	}
+	if node, ok := nodes[address]; !ok || !node.IsActive {
+		return false, nil
+	}
+
+	u.statsMu.Lock()
+	defer u.statsMu.Unlock()
+
+	// no stats are created for a peer this node has never been in contact with
+	if _, ok := u.peersStats[address]; !ok {
+		return false, nil
+	}
+	stats := u.peerStats(address)
+	return stats.PublicKey != "" && stats.BannedUntil == 0, nil
+}
+
+// PeersStats returns the stats of the peers this node has been in contact with
+func (u *NodeService) PeersStats() map[NetworkNodeAddress]PeerStats {
+	u.statsMu.Lock()
+	defer u.statsMu.Unlock()
+
+	peersStats := make(map[NetworkNodeAddress]PeerStats, len(u.peersStats))
+	for address := range u.peersStats {
+		peersStats[address] = *u.peerStats(address)
+	}
+	return peersStats
+}
+
+// updatePeerStats applies the points returned by update to the score of the peer
+// the peer is banned once its score drops under PeerBanScore, and deactivated once it has been banned too often
+func (u *NodeService) updatePeerStats(address NetworkNodeAddress, update func(stats *PeerStats) int) {
+	u.statsMu.Lock()
+	defer u.statsMu.Unlock()
+
+	stats := u.peerStats(address)
+	stats.Score += update(stats)
+	if stats.Score > MaxPeerScore {
+		stats.Score = MaxPeerScore
+	}
+	if stats.Score >= PeerBanScore || stats.BannedUntil > 0 {
+		return
+	}
+
+	stats.Bans++
+	stats.BannedUntil = utils.DefaultTimeService.UnixUint64() + PEER_BAN_DURATION_IN_SECONDS
+	Logger.Warnf("updatePeerStats: node %s banned for %d seconds (score=%d)", address.String(), PEER_BAN_DURATION_IN_SECONDS, stats.Score)
+
+	if stats.Bans >= MaxPeerBans {
+		if err := u.deactivate(address); err != nil {
+			Logger.Errorf("updatePeerStats: failed to deactivate node %s: %s", address.String(), err)
+			return
+		}
+		Logger.Warnf("updatePeerStats: node %s deactivated after %d bans", address.String(), stats.Bans)
+	}
+}
+
+// peerStats returns the stats of the peer, the ban of the peer is lifted if it is over
+func (u *NodeService) peerStats(address NetworkNodeAddress) *PeerStats {
+	stats, ok := u.peersStats[address]
+	if !ok {
+		stats = &PeerStats{Score: MaxPeerScore}
+		u.peersStats[address] = stats
+	}
+	if stats.BannedUntil > 0 && stats.BannedUntil <= utils.DefaultTimeService.UnixUint64() {
+		stats.BannedUntil = 0
+		stats.Score = PeerProbationScore
+	}
+	return stats
+}
+
+// deactivate marks the node as inactive in the database, so it is not contacted anymore even after a restart
+func (u *NodeService) deactivate(address NetworkNodeAddress) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	networkNodes, err := u.read()
+	if err != nil {
+		return fmt.Errorf("deactivate: %w", err)
+	}
+	for name, record := range networkNodes.Nodes {
+		if NewNetworkNodeAddress(record.Address, record.Port) == address {
+			record.Is_active = false
+			networkNodes.Nodes[name] = record
+		}
+	}
+
+	if err = u.write(networkNodes); err != nil {
+		return fmt.Errorf("deactivate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package nodes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+// newTestNodeService node service working on a copy of the test nodes
+func newTestNodeService(t *testing.T) *NodeService {
+	nodesFile, err := os.ReadFile(test.NodesFilePath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	nodesFilePath := filepath.Join(t.TempDir(), "network_nodes.toml")
+	if err = os.WriteFile(nodesFilePath, nodesFile, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	service, _ := NewNodeService(nodesFilePath)
+	return service
+}
+
+func TestNodeService_PeerReputation(t *testing.T) {
+	test.InitTestContext()
+
+	// define variables
+	address := NewNetworkNodeAddress("localhost", 8081)
+
+	t.Run("a peer answering quickly should keep the maximum score", func(t *testing.T) {
+		u := newTestNodeService(t)
+		u.RecordSuccess(address, 100*time.Millisecond)
+		u.RecordSuccess(address, 200*time.Millisecond)
+
+		stats := u.PeersStats()[address]
+		if stats.Score != MaxPeerScore || stats.Successes != 2 || stats.LatencyInMs != 120 {
+			t.Errorf("PeersStats() = %+v, want score %d, 2 successes and a latency of 120ms", stats, MaxPeerScore)
+		}
+	})
+
+	t.Run("a misbehaving peer should lose points", func(t *testing.T) {
+		u := newTestNodeService(t)
+		u.RecordSuccess(address, SLOW_PEER_LATENCY+time.Second)
+		u.RecordFailure(address)
+		u.RecordHeightLie(address)
+		u.RecordInvalidBlocks(address)
+
+		want := MaxPeerScore + peerSlowPoints + peerFailurePoints + peerHeightLiePoints + peerInvalidBlockPoints
+		if stats := u.PeersStats()[address]; stats.Score != want {
+			t.Errorf("PeersStats() score = %d, want %d", stats.Score, want)
+		}
+		if u.IsBanned(address) {
+			t.Errorf("IsBanned() = true, want false for a score above %d", PeerBanScore)
+		}
+	})
+
+	t.Run("a peer under the ban score should be banned until its ban is over", func(t *testing.T) {
+		u := newTestNodeService(t)
+		for i := 0; i < 4; i++ {
+			u.RecordInvalidBlocks(address)
+		}
+		if !u.IsBanned(address) {
+			t.Fatalf("IsBanned() = false, want true for a score under %d", PeerBanScore)
+		}
+
+		// the ban is over
+		u.peersStats[address].BannedUntil = 1
+		if u.IsBanned(address) {
+			t.Errorf("IsBanned() = true, want false once the ban is over")
+		}
+		if stats := u.PeersStats()[address]; stats.Score != PeerProbationScore {
+			t.Errorf("PeersStats() score = %d, want %d after a ban", stats.Score, PeerProbationScore)
+		}
+	})
+
+	t.Run("a peer banned too often should be deactivated", func(t *testing.T) {
+		u := newTestNodeService(t)
+		for ban := 0; ban < MaxPeerBans; ban++ {
+			u.peersStats[address] = &PeerStats{Score: PeerBanScore, Bans: uint64(ban)}
+			u.RecordFailure(address)
+		}
+
+		nodes, err := u.List()
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if nodes[address].IsActive {
+			t.Errorf("List() node is active, want inactive after %d bans", MaxPeerBans)
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package nodes
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 
 	. "github.com/v4lproik/simple-blockchain-quickstart/common/utils"
@@ -14,22 +16,70 @@ import (
 )
 
 const (
-	STATUS_NODE_ENDPOINT = "/status"
-	BLOCKS_NODE_ENDPOINT = "/blocks"
+	STATUS_NODE_ENDPOINT         = "/status"
+	BLOCKS_NODE_ENDPOINT         = "/blocks"
+	METRICS_NODE_ENDPOINT        = "/metrics"
+	TX_PROOF_NODE_ENDPOINT       = "/transactions/:hash/proof"
+	TRANSACTIONS_NODE_ENDPOINT   = "/transactions"
+	ANNOUNCE_BLOCK_NODE_ENDPOINT = "/blocks/announcements"
+	PEERS_NODE_ENDPOINT          = "/peers"
+	PEER_NODE_ENDPOINT           = "/peers/:name"
 )
 
 type NodesEnv struct {
-	nodeService  *NodeService
-	state        models.State
-	blockService services.BlockService
+	nodeService        *NodeService
+	state              models.State
+	transactionService services.TransactionService
+	blockService       services.BlockService
+	blockMetrics       *BlockMetrics
+	seenTxs            *SeenTxs
+	announcedBlocks    chan<- BlockAnnouncement
+	identity           *NodeIdentity
+	client             NodeClient
+	peerRegistrations  *PeerRegistrations
+	// port of the grpc server of this node, 0 if it is not started
+	grpcPort uint64
+
+	// middlewares restricting the endpoints reserved to the operators of the node
+	operatorMiddlewares []gin.HandlerFunc
 }
 
 func NodesRegister(router *gin.RouterGroup, env *NodesEnv) {
 	router.GET(STATUS_NODE_ENDPOINT, env.NodeStatus)
 	router.POST(BLOCKS_NODE_ENDPOINT, env.NodeListBlocks)
+	router.GET(METRICS_NODE_ENDPOINT, env.NodeMetrics)
+	router.GET(TX_PROOF_NODE_ENDPOINT, env.NodeTxProof)
+	router.POST(TRANSACTIONS_NODE_ENDPOINT, env.NodeRelayTransaction)
+	router.POST(ANNOUNCE_BLOCK_NODE_ENDPOINT, env.NodeAnnounceBlock)
+	router.POST(PEERS_NODE_ENDPOINT, env.NodeAddPeer)
+
+	operatorRouter := router.Group("/", env.operatorMiddlewares...)
+	operatorRouter.DELETE(PEER_NODE_ENDPOINT, env.NodeRemovePeer)
 }
 
+type NodeStatusParams struct {
+	// random value the status is signed with, so the status can't be replayed to the verifier
+	Nonce string `form:"nonce" binding:"omitempty,hash"`
+}
+
+// NodeStatus Get the status of this node and its peers, signed with the nonce of the verifier
 func (env NodesEnv) NodeStatus(c *gin.Context) {
+	params := &NodeStatusParams{}
+	// check params
+	if err := ShouldBindQuery(c, "status cannot be retrieved", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// verified in parameter above, a status requested without nonce is signed with an empty one
+	nonce := models.Hash{}
+	if params.Nonce != "" {
+		if err := nonce.UnmarshalText([]byte(params.Nonce)); err != nil {
+			AbortWithError(c, NewError(http.StatusBadRequest, "status cannot be retrieved"))
+			return
+		}
+	}
+
 	// get all the nodes
 	nodes, err := env.nodeService.List()
 	if err != nil {
@@ -37,14 +87,50 @@ func (env NodesEnv) NodeStatus(c *gin.Context) {
 		return
 	}
 
+	response, err := env.signedStatus(nodes, nonce)
+	if err != nil {
+		Logger.Error(fmt.Errorf("NodeStatus: couldn't sign status: %w", err))
+		AbortWithError(c, NewError(http.StatusInternalServerError, "status could not be signed"))
+		return
+	}
+
+	// render
+	c.JSON(http.StatusOK, gin.H{"status": response})
+}
+
+// signedStatus returns the status of this node signed with its identity and the nonce of the verifier, so peers
+// can check who is claiming this chain and these peers
+func (env NodesEnv) signedStatus(nodes map[NetworkNodeAddress]NetworkNode, nonce models.Hash) (NetworkNodesResponse, error) {
 	// init serializer
 	serializer := &NodeSerializer{
-		State: env.state,
-		nodes: nodes,
+		State:      env.state,
+		nodes:      nodes,
+		peersStats: env.nodeService.PeersStats(),
+	}
+
+	var err error
+	response := serializer.Response()
+	// the signed status is the one rendered
+	work, _ := new(big.Int).SetString(response.Work, 10)
+	status := NetworkNodeStatus{
+		Hash:         response.Hash,
+		Height:       response.Height,
+		Work:         work,
+		NetworkNodes: nodes,
+	}
+	response.Handshake, err = env.identity.Handshake(env.state.ChainId(), env.state.GenesisHash(), env.grpcPort, nonce, status)
+	if err != nil {
+		return NetworkNodesResponse{}, fmt.Errorf("signedStatus: %w", err)
 	}
+	return response, nil
+}
+
+// NodeMetrics Get the blocks refused by this node
+func (env NodesEnv) NodeMetrics(c *gin.Context) {
+	serializer := &MetricsSerializer{blockMetrics: env.blockMetrics}
 
 	// render
-	c.JSON(http.StatusOK, gin.H{"status": serializer.Response()})
+	c.JSON(http.StatusOK, gin.H{"metrics": serializer.Response()})
 }
 
 type ListBlocksParam struct {
@@ -76,10 +162,333 @@ func (env NodesEnv) NodeListBlocks(c *gin.Context) {
 		return
 	}
 
-	// render
-	serializer := BlocksSerializer{
-		blocks: blocks,
+	blocksDB := make([]models.BlockDB, len(blocks))
+	for i, block := range blocks {
+		blockHash, err := block.Hash()
+		if err != nil {
+			Logger.Error(fmt.Errorf("NodeListBlocks: couldn't hash block: %w", err))
+			AbortWithError(c, NewError(http.StatusInternalServerError, "blocks could not be retrieved"))
+			return
+		}
+		blocksDB[i] = models.BlockDB{Hash: blockHash, Block: block}
 	}
 
+	// render
+	serializer := NewBlocksSerializer(blocksDB)
 	c.JSON(http.StatusOK, serializer.Response())
 }
+
+type TxProofParams struct {
+	Hash string `uri:"hash" binding:"required,hash"`
+}
+
+// NodeTxProof Get the merkle proof that a transaction is included in a block
+func (env NodesEnv) NodeTxProof(c *gin.Context) {
+	params := &TxProofParams{}
+	// check params
+	if err := ShouldBindUri(c, "proof cannot be generated", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// verified in parameter above
+	txHash := models.Hash{}
+	err := txHash.UnmarshalText([]byte(params.Hash))
+	if err != nil {
+		AbortWithError(c, NewUnknownError())
+		return
+	}
+
+	blockDB, err := env.blockService.GetBlockByTxHash(models.TransactionId(txHash))
+	if err != nil {
+		if errors.Is(err, services.ErrBlockNotFound) {
+			AbortWithError(c, NewError(http.StatusNotFound, "transaction cannot be found in any block"))
+			return
+		}
+		Logger.Error(fmt.Errorf("NodeTxProof: couldn't retrieve block from DB: %w", err))
+		AbortWithError(c, NewError(http.StatusInternalServerError, "proof cannot be generated"))
+		return
+	}
+
+	proof, err := models.TxProof(blockDB.Block.Txs, models.TransactionId(txHash))
+	if err != nil {
+		Logger.Error(fmt.Errorf("NodeTxProof: couldn't generate proof: %w", err))
+		AbortWithError(c, NewError(http.StatusInternalServerError, "proof cannot be generated"))
+		return
+	}
+
+	// render
+	serializer := TxProofSerializer{
+		txHash:  txHash,
+		blockDB: blockDB,
+		proof:   proof,
+	}
+	c.JSON(http.StatusOK, gin.H{"proof": serializer.Response()})
+}
+
+type RelayTransactionParams struct {
+	From      string        `json:"from" binding:"required,account"`
+	To        string        `json:"to" binding:"required,account"`
+	Value     uint          `json:"value"`
+	Fee       uint          `json:"fee"`
+	Nonce     uint64        `json:"nonce"`
+	Reason    models.Reason `json:"reason" binding:"omitempty,enum"`
+	Time      uint64        `json:"time" binding:"required"`
+	ChainId   string        `json:"chain_id" binding:"required"`
+	Signature string        `json:"signature" binding:"required,signature"`
+}
+
+// NodeRelayTransaction Add to the pool a transaction relayed by a peer
+// the transaction is relayed in turn to the peers of this node once it is in the pool
+func (env NodesEnv) NodeRelayTransaction(c *gin.Context) {
+	params := &RelayTransactionParams{}
+	// check params
+	if err := ShouldBind(c, "transaction cannot be relayed", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// create the transaction as signed by its sender
+	from, _ := models.NewAccount(params.From)
+	to, _ := models.NewAccount(params.To)
+	tx := models.NewTransaction(
+		from,
+		to,
+		params.Value,
+		params.Fee,
+		params.Nonce,
+		string(params.Reason),
+		params.Time,
+		params.ChainId,
+	)
+	// verified in parameter above
+	if err := tx.Signature.UnmarshalText([]byte(params.Signature)); err != nil {
+		AbortWithError(c, NewUnknownError())
+		return
+	}
+	txHash, err := tx.Hash()
+	if err != nil {
+		AbortWithError(c, NewUnknownError())
+		return
+	}
+
+	if err = env.relayTx(txHash, *tx); err != nil {
+		AbortWithError(c, NewError(http.StatusBadRequest, "transaction cannot be relayed", err))
+		return
+	}
+
+	// render
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// relayTx adds to the pool a transaction relayed by a peer, a transaction already seen or pending is accepted
+func (env NodesEnv) relayTx(txHash models.TransactionId, tx models.Transaction) error {
+	// the transaction has already gone through this node
+	if env.seenTxs.Has(txHash) {
+		return nil
+	}
+
+	// the pool checks the transaction the same way it does for the ones submitted to this node
+	err := env.transactionService.AddPendingTx(tx)
+	if err != nil && !errors.Is(err, services.ErrTxAlreadyInPool) {
+		Logger.Debugf("relayTx: transaction %s refused: %s", models.Hash(txHash).Hex(), err)
+		return err
+	}
+	return nil
+}
+
+type AnnounceBlockParams struct {
+	Hash   string `json:"hash" binding:"required,hash"`
+	Height uint64 `json:"height" binding:"required"`
+	Ip     string `json:"ip" binding:"required"`
+	Port   uint64 `json:"port" binding:"required"`
+}
+
+// NodeAnnounceBlock Fetch right away a new block announced by a peer
+// the block is fetched and validated in the background, the announcement is accepted as long as it can be queued
+func (env NodesEnv) NodeAnnounceBlock(c *gin.Context) {
+	params := &AnnounceBlockParams{}
+	// check params
+	if err := ShouldBind(c, "block announcement cannot be processed", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// verified in parameter above
+	hash := models.Hash{}
+	if err := hash.UnmarshalText([]byte(params.Hash)); err != nil {
+		AbortWithError(c, NewUnknownError())
+		return
+	}
+
+	isKnown, err := env.queueBlockAnnouncement(BlockAnnouncement{
+		Hash:   hash,
+		Height: params.Height,
+		Node:   NewNetworkNodeAddress(params.Ip, params.Port),
+	})
+	if err != nil {
+		if errors.Is(err, ErrUntrustedAnnouncement) {
+			AbortWithError(c, NewError(http.StatusForbidden, "block announcement cannot be processed, the node is not a verified peer"))
+			return
+		}
+		if errors.Is(err, ErrTooManyAnnouncements) {
+			AbortWithError(c, NewError(http.StatusServiceUnavailable, "block announcement cannot be processed, too many announcements pending"))
+			return
+		}
+		Logger.Error(fmt.Errorf("NodeAnnounceBlock: couldn't queue announcement: %w", err))
+		AbortWithError(c, NewError(http.StatusInternalServerError, "block announcement cannot be processed"))
+		return
+	}
+
+	// render
+	if isKnown {
+		c.JSON(http.StatusOK, gin.H{})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{})
+}
+
+// queueBlockAnnouncement queues the announcement without waiting for the synchronisation
+// returns true if the block is already part of our main chain
+// the announced node is only contacted if it is a peer which has already identified itself with a verified handshake
+func (env NodesEnv) queueBlockAnnouncement(announcement BlockAnnouncement) (bool, error) {
+	if _, ok := env.state.GetBlockByHash(announcement.Hash); ok {
+		return true, nil
+	}
+	isTrusted, err := env.nodeService.IsTrusted(announcement.Node)
+	if err != nil {
+		return false, fmt.Errorf("queueBlockAnnouncement: %w", err)
+	}
+	if !isTrusted {
+		return false, ErrUntrustedAnnouncement
+	}
+
+	select {
+	case env.announcedBlocks <- announcement:
+		return false, nil
+	default:
+		return false, ErrTooManyAnnouncements
+	}
+}
+
+type AddPeerParams struct {
+	Name string `json:"name" binding:"required"`
+	Ip   string `json:"ip" binding:"required"`
+	Port uint64 `json:"port" binding:"required"`
+}
+
+// NodeAddPeer Add a node announcing itself to the known nodes, a node already known at the same address is updated
+// but a deactivated or banned node stays as it is
+// the node is only added once it has signed its status with a nonce of this node, its grpc port is the signed one
+func (env NodesEnv) NodeAddPeer(c *gin.Context) {
+	params := &AddPeerParams{}
+	// check params
+	if err := ShouldBind(c, "peer cannot be added", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// each registration makes this node contact the peer
+	if !env.peerRegistrations.Allow(c.ClientIP()) {
+		AbortWithError(c, NewError(http.StatusTooManyRequests, "peer cannot be added, too many registrations"))
+		return
+	}
+
+	address := NewNetworkNodeAddress(params.Ip, params.Port)
+	handshake, err := env.verifyPeer(address)
+	if err != nil {
+		if errors.Is(err, ErrNodeBanned) {
+			AbortWithError(c, NewError(http.StatusForbidden, "peer cannot be added", ErrNodeBanned))
+			return
+		}
+		if errors.Is(err, ErrPeerUnreachable) {
+			AbortWithError(c, NewError(http.StatusBadGateway, "peer cannot be added", ErrPeerUnreachable))
+			return
+		}
+		Logger.Debugf("NodeAddPeer: peer %s refused: %s", address.String(), err)
+		AbortWithError(c, NewError(http.StatusForbidden, "peer cannot be added", ErrPeerHandshakeInvalid))
+		return
+	}
+
+	node, err := env.nodeService.Register(address, params.Name, handshake.GrpcPort)
+	if err != nil {
+		if errors.Is(err, ErrNodeNameAlreadyUsed) {
+			AbortWithError(c, NewError(http.StatusConflict, "peer cannot be added", ErrNodeNameAlreadyUsed))
+			return
+		}
+		if errors.Is(err, ErrNodeDeactivated) {
+			AbortWithError(c, NewError(http.StatusForbidden, "peer cannot be added", ErrNodeDeactivated))
+			return
+		}
+		if errors.Is(err, ErrNodeBanned) {
+			AbortWithError(c, NewError(http.StatusForbidden, "peer cannot be added", ErrNodeBanned))
+			return
+		}
+		if errors.Is(err, ErrTooManyNodes) {
+			AbortWithError(c, NewError(http.StatusServiceUnavailable, "peer cannot be added", ErrTooManyNodes))
+			return
+		}
+		Logger.Error(fmt.Errorf("NodeAddPeer: couldn't add peer: %w", err))
+		AbortWithError(c, NewError(http.StatusInternalServerError, "peer cannot be added"))
+		return
+	}
+
+	// render
+	serializer := PeerSerializer{
+		address: address,
+		node:    node,
+	}
+	c.JSON(http.StatusCreated, gin.H{"peer": serializer.Response()})
+}
+
+// verifyPeer asks the node for its status signed with a new nonce, so only a node answering at the address with
+// a handshake of our chain can be added, the handshake returned is the one the node has signed
+func (env NodesEnv) verifyPeer(address NetworkNodeAddress) (NodeHandshake, error) {
+	// checked before contacting the node, a banned node isn't contacted
+	if env.nodeService.IsBanned(address) {
+		return NodeHandshake{}, fmt.Errorf("verifyPeer: %w: %s", ErrNodeBanned, address.String())
+	}
+
+	nonce, err := NewHandshakeNonce()
+	if err != nil {
+		return NodeHandshake{}, fmt.Errorf("verifyPeer: %w", err)
+	}
+	status, err := env.client.GetStatus(address, nonce)
+	if err != nil {
+		return NodeHandshake{}, fmt.Errorf("verifyPeer: %w: %s", ErrPeerUnreachable, err)
+	}
+	if err = VerifyHandshake(status, nonce, env.state.ChainId(), env.state.GenesisHash()); err != nil {
+		return NodeHandshake{}, fmt.Errorf("verifyPeer: %w", err)
+	}
+	if err = env.nodeService.VerifyPublicKey(address, status.Handshake.PublicKey); err != nil {
+		return NodeHandshake{}, fmt.Errorf("verifyPeer: %w", err)
+	}
+	return status.Handshake, nil
+}
+
+type PeerNameParams struct {
+	Name string `uri:"name" binding:"required"`
+}
+
+// NodeRemovePeer Remove a node from the known nodes
+func (env NodesEnv) NodeRemovePeer(c *gin.Context) {
+	params := &PeerNameParams{}
+	// check params
+	if err := ShouldBindUri(c, "peer cannot be removed", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	if err := env.nodeService.Remove(params.Name); err != nil {
+		if errors.Is(err, ErrNodeNotFound) {
+			AbortWithError(c, NewError(http.StatusNotFound, "peer cannot be found"))
+			return
+		}
+		Logger.Error(fmt.Errorf("NodeRemovePeer: couldn't remove peer: %w", err))
+		AbortWithError(c, NewError(http.StatusInternalServerError, "peer cannot be removed"))
+		return
+	}
+
+	// render
+	c.JSON(http.StatusOK, gin.H{})
+}
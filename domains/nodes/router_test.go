@@ -0,0 +1,616 @@
+package nodes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+var (
+	state, _        = models.NewStateFromFile(test.GenesisFilePath, test.BlocksFilePath, models.DefaultEngine())
+	blockService, _ = services.NewFileBlockService(test.BlocksFilePath, "", models.DefaultEngine())
+	blocks, _       = blockService.GetNextBlocksFromHash(models.Hash{})
+	blockHash, _    = blocks[1].Hash()
+	txHash, _       = blocks[1].Txs[0].Hash()
+
+	senderKey, _          = crypto.GenerateKey()
+	sender                = models.Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+	transactionService, _ = services.NewFileTransactionService(testStateReader{
+		balances: map[models.Account]uint{sender: 1000},
+	}, services.DefaultMempoolConf())
+	seenTxs = NewSeenTxs(MaxSeenTxs)
+
+	relayedTx     = newRelayedTx(senderKey, 0)
+	seenTx        = newRelayedTx(senderKey, 6)
+	seenTxHash, _ = seenTx.Hash()
+	unsignedTx    = newRelayedTx(nil, 1)
+	nonceGapTx    = newRelayedTx(senderKey, 5)
+
+	// a single announcement can be waiting to be fetched
+	announcedBlocks = make(chan BlockAnnouncement, 1)
+
+	// set by the tests modifying the known nodes, on a copy of the test nodes
+	nodeService *NodeService
+
+	identityKey, _ = crypto.GenerateKey()
+	identity       = NewNodeIdentity(identityKey)
+
+	// the peers answering the status requests of the nodes registering, with the grpc port they sign
+	peerKey, _ = crypto.GenerateKey()
+	peerClient = &testPeerClient{
+		identity: NewNodeIdentity(peerKey),
+		grpcPorts: map[NetworkNodeAddress]uint64{
+			NewNetworkNodeAddress("localhost", 8081): 0,
+			NewNetworkNodeAddress("localhost", 8083): 9083,
+			NewNetworkNodeAddress("localhost", 8084): 0,
+			NewNetworkNodeAddress("localhost", 8085): 0,
+			NewNetworkNodeAddress("localhost", 8086): 0,
+		},
+		otherChain: NewNetworkNodeAddress("localhost", 8088),
+	}
+)
+
+// testPeerClient signs the status of the known peers with the nonce of the verifier
+type testPeerClient struct {
+	NodeClient
+
+	identity   *NodeIdentity
+	grpcPorts  map[NetworkNodeAddress]uint64
+	otherChain NetworkNodeAddress
+}
+
+func (c *testPeerClient) GetStatus(nodeAddress NetworkNodeAddress, nonce models.Hash) (NetworkNodeStatus, error) {
+	chainId := test.ChainId
+	if nodeAddress == c.otherChain {
+		chainId = "another-chain"
+	} else if _, ok := c.grpcPorts[nodeAddress]; !ok {
+		return NetworkNodeStatus{}, errors.New("connection refused")
+	}
+
+	status := NetworkNodeStatus{Work: big.NewInt(0)}
+	handshake, err := c.identity.Handshake(chainId, state.GenesisHash(), c.grpcPorts[nodeAddress], nonce, status)
+	if err != nil {
+		return NetworkNodeStatus{}, err
+	}
+	status.Handshake = handshake
+	return status, nil
+}
+
+var NodeTxProofDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for transaction proof endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/transactions/" + models.Hash(txHash).Hex() + "/proof",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"proof":{"tx_hash":"` + models.Hash(txHash).Hex() + `","block_hash":"` + blockHash.Hex() + `","block_height":2,"tx_root":"[0-9a-f]{64}","merkle_proof":\[.*\]}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request proof of a transaction included in a block should return its merkle proof",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/transactions/" + models.Hash{}.Hex() + "/proof",
+		method:         "GET",
+		expectedCode:   http.StatusNotFound,
+		jsonResponse:   `{"error":{"code":404,"status":"Not Found","message":"transaction cannot be found in any block","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request proof of an unknown transaction should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/transactions/nothash/proof",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"proof cannot be generated","context":[[{"field":"Hash","message":"The hash should be a 32 byte array"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request proof with an invalid hash should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+var NodeRelayTransactionDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	body           interface{}
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for relay transaction endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/transactions",
+		method:         "POST",
+		body:           relayedTx,
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "relay a valid transaction should add it to the pool",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/transactions",
+		method:         "POST",
+		body:           relayedTx,
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "relay a transaction already in the pool should be accepted",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init: func(req *http.Request) {
+			seenTxs.Add(seenTxHash)
+		},
+		url:            NODES_DOMAIN_URL + "/transactions",
+		method:         "POST",
+		body:           seenTx,
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "relay a transaction already relayed by this node should be ignored",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/transactions",
+		method:         "POST",
+		body:           nonceGapTx,
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"transaction cannot be relayed","context":\[".*` + models.ErrTxNonceTooHigh.Error() + `.*"\]}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "relay a transaction refused by the pool should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/transactions",
+		method:         "POST",
+		body:           unsignedTx,
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"transaction cannot be relayed","context":\[\[{"field":"Signature","message":"This field is required"}\]\]}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "relay a transaction without signature should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+var NodeAnnounceBlockDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	body           interface{}
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for block announcement endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/blocks/announcements",
+		method:         "POST",
+		body:           AnnounceBlockParams{Hash: models.Hash{3}.Hex(), Height: 5, Ip: "127.0.0.1", Port: 8082},
+		expectedCode:   http.StatusForbidden,
+		jsonResponse:   `{"error":{"code":403,"status":"Forbidden","message":"block announcement cannot be processed, the node is not a verified peer","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "announce a new block from a node which is not a known peer should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/blocks/announcements",
+		method:         "POST",
+		body:           AnnounceBlockParams{Hash: models.Hash{3}.Hex(), Height: 5, Ip: "localhost", Port: 8081},
+		expectedCode:   http.StatusForbidden,
+		jsonResponse:   `{"error":{"code":403,"status":"Forbidden","message":"block announcement cannot be processed, the node is not a verified peer","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "announce a new block from a known peer which hasn't sent a verified handshake should return error",
+		after: func(req *http.Request) {
+			// the peer identifies itself for the next announcements
+			_ = nodeService.VerifyPublicKey(NewNetworkNodeAddress("localhost", 8081), identity.PublicKey())
+		},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/blocks/announcements",
+		method:         "POST",
+		body:           AnnounceBlockParams{Hash: blockHash.Hex(), Height: 2, Ip: "localhost", Port: 8081},
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "announce a block already in the main chain should be ignored",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/blocks/announcements",
+		method:         "POST",
+		body:           AnnounceBlockParams{Hash: models.Hash{1}.Hex(), Height: 5, Ip: "localhost", Port: 8081},
+		expectedCode:   http.StatusAccepted,
+		jsonResponse:   `{}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "announce a new block should queue it to be fetched from the node",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/blocks/announcements",
+		method:         "POST",
+		body:           AnnounceBlockParams{Hash: models.Hash{2}.Hex(), Height: 5, Ip: "localhost", Port: 8081},
+		expectedCode:   http.StatusServiceUnavailable,
+		jsonResponse:   `{"error":{"code":503,"status":"Service Unavailable","message":"block announcement cannot be processed, too many announcements pending","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "announce a new block while too many announcements are pending should return error",
+		after: func(req *http.Request) {
+			<-announcedBlocks
+		},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/blocks/announcements",
+		method:         "POST",
+		body:           AnnounceBlockParams{Hash: "nothash", Height: 5, Ip: "localhost", Port: 8081},
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"block announcement cannot be processed","context":[[{"field":"Hash","message":"The hash should be a 32 byte array"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "announce a block with an invalid hash should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+var NodePeersDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	body           interface{}
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for add peer endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/peers",
+		method:         "POST",
+		body:           AddPeerParams{Name: "Gamma", Ip: "localhost", Port: 8083},
+		expectedCode:   http.StatusCreated,
+		jsonResponse:   `{"peer":{"name":"Gamma","ip":"localhost","port":8083,"is_bootstrap":false,"is_active":true,"grpc_port":9083}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "add a peer should add it to the known nodes with the grpc port it has signed",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/peers",
+		method:         "POST",
+		body:           AddPeerParams{Name: "Zeta", Ip: "localhost", Port: 8087},
+		expectedCode:   http.StatusBadGateway,
+		jsonResponse:   `{"error":{"code":502,"status":"Bad Gateway","message":"peer cannot be added","context":["` + ErrPeerUnreachable.Error() + `"]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "add a peer which can't be reached should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/peers",
+		method:         "POST",
+		body:           AddPeerParams{Name: "Eta", Ip: "localhost", Port: 8088},
+		expectedCode:   http.StatusForbidden,
+		jsonResponse:   `{"error":{"code":403,"status":"Forbidden","message":"peer cannot be added","context":["` + ErrPeerHandshakeInvalid.Error() + `"]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "add a peer of another chain should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/peers",
+		method:         "POST",
+		body:           AddPeerParams{Name: "Alpha", Ip: "localhost", Port: 8084},
+		expectedCode:   http.StatusConflict,
+		jsonResponse:   `{"error":{"code":409,"status":"Conflict","message":"peer cannot be added","context":["` + ErrNodeNameAlreadyUsed.Error() + `"]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "add a peer with the name of another node should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/peers",
+		method:         "POST",
+		body:           AddPeerParams{Ip: "localhost", Port: 8084},
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"peer cannot be added","context":[[{"field":"Name","message":"This field is required"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "add a peer without name should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/peers",
+		method:         "POST",
+		body:           AddPeerParams{Name: "Alpha", Ip: "localhost", Port: 8081},
+		expectedCode:   http.StatusCreated,
+		jsonResponse:   `{"peer":{"name":"Alpha","ip":"localhost","port":8081,"is_bootstrap":true,"is_active":true}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "add a known peer again should keep it as a bootstrap node",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init: func(req *http.Request) {
+			_ = nodeService.Add(map[NetworkNodeAddress]NetworkNode{
+				NewNetworkNodeAddress("localhost", 8085): {Name: "Delta", IsActive: false},
+			})
+		},
+		url:            NODES_DOMAIN_URL + "/peers",
+		method:         "POST",
+		body:           AddPeerParams{Name: "Delta", Ip: "localhost", Port: 8085},
+		expectedCode:   http.StatusForbidden,
+		jsonResponse:   `{"error":{"code":403,"status":"Forbidden","message":"peer cannot be added","context":["` + ErrNodeDeactivated.Error() + `"]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "add a deactivated peer should return error",
+		after: func(req *http.Request) {
+			_ = nodeService.Remove("Delta")
+		},
+	},
+	{
+		init: func(req *http.Request) {
+			for i := 0; i < 11; i++ {
+				nodeService.RecordFailure(NewNetworkNodeAddress("localhost", 8086))
+			}
+		},
+		url:            NODES_DOMAIN_URL + "/peers",
+		method:         "POST",
+		body:           AddPeerParams{Name: "Epsilon", Ip: "localhost", Port: 8086},
+		expectedCode:   http.StatusForbidden,
+		jsonResponse:   `{"error":{"code":403,"status":"Forbidden","message":"peer cannot be added","context":["` + ErrNodeBanned.Error() + `"]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "add a banned peer should return error",
+		after:          func(req *http.Request) {},
+	},
+	//---------------------   Test suit for status endpoint   ---------------------
+	{
+		init: func(req *http.Request) {
+			nodeService.RecordFailure(NewNetworkNodeAddress("localhost", 8081))
+		},
+		url:            NODES_DOMAIN_URL + "/status",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"status":{.*"network_nodes":\[.*{"name":"Alpha","ip":"localhost","port":8081,"is_bootstrap":true,"is_active":true,"reputation":{"score":90,"latency_in_ms":0,"successes":0,"failures":1,"invalid_blocks":0,"height_lies":0,"invalid_handshakes":0,"bans":0}}.*\],"handshake":{"public_key":"` + identity.PublicKey() + `","chain_id":"` + test.ChainId + `","genesis_hash":"[0-9a-f]{64}","protocol_version":1,"signature":"[0-9a-f]{130}"}}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request status should return the reputation of the peers this node has been in contact with and be signed",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/status?nonce=" + models.Hash{7}.Hex(),
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"status":{.*"handshake":{"public_key":"` + identity.PublicKey() + `",.*"signature":"[0-9a-f]{130}"}}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request status with a nonce should be signed",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/status?nonce=notanonce",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"status cannot be retrieved","context":[[{"field":"Nonce","message":"The hash should be a 32 byte array"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request status with an invalid nonce should return error",
+		after:          func(req *http.Request) {},
+	},
+	//---------------------   Test suit for remove peer endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/peers/Gamma",
+		method:         "DELETE",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "remove a peer should remove it from the known nodes",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            NODES_DOMAIN_URL + "/peers/Gamma",
+		method:         "DELETE",
+		expectedCode:   http.StatusNotFound,
+		jsonResponse:   `{"error":{"code":404,"status":"Not Found","message":"peer cannot be found","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "remove an unknown peer should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+func TestNodesEnv_NodeTxProof(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	r := gin.New()
+	initServer(r)
+
+	for _, testData := range NodeTxProofDomainTests {
+		req, err := http.NewRequest(testData.method, testData.url, nil)
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+}
+
+func TestNodesEnv_NodeRelayTransaction(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	r := gin.New()
+	initServer(r)
+
+	for _, testData := range NodeRelayTransactionDomainTests {
+		body, _ := json.Marshal(testData.body)
+		req, err := http.NewRequest(testData.method, testData.url, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+}
+
+func TestNodesEnv_NodeListBlocks(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	r := gin.New()
+	initServer(r)
+
+	body, _ := json.Marshal(ListBlocksParam{From: models.Hash{}.Hex()})
+	req, err := http.NewRequest("POST", NODES_DOMAIN_URL+BLOCKS_NODE_ENDPOINT, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	asserts.NoError(err)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	asserts.Equal(http.StatusOK, w.Code)
+	asserts.Regexp(`^{"blocks":\[{"hash":"[0-9a-f]{64}","header":{.*},"transactions":\[{"hash":"[0-9a-f]{64}",.*$`, w.Body.String(), "the blocks should be rendered as by the blocks domain")
+
+	// the blocks parsed by the peers should be the blocks served
+	got, err := getBlocks(w.Result())
+	asserts.NoError(err)
+	asserts.Equal(len(blocks), len(got))
+	for i := range got {
+		gotHash, _ := got[i].Hash()
+		wantHash, _ := blocks[i].Hash()
+		asserts.Equal(wantHash, gotHash)
+	}
+}
+
+func TestNodesEnv_NodeAnnounceBlock(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	// only the known peers can announce a block
+	nodeService = newTestNodeService(t)
+
+	r := gin.New()
+	initServer(r)
+
+	for _, testData := range NodeAnnounceBlockDomainTests {
+		body, _ := json.Marshal(testData.body)
+		req, err := http.NewRequest(testData.method, testData.url, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+}
+
+func TestNodesEnv_NodePeers(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	// the known nodes are modified by the tests
+	nodeService = newTestNodeService(t)
+
+	r := gin.New()
+	initServer(r)
+
+	for _, testData := range NodePeersDomainTests {
+		body, _ := json.Marshal(testData.body)
+		req, err := http.NewRequest(testData.method, testData.url, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+
+	// the existing nodes are kept
+	nodes, err := nodeService.List()
+	asserts.NoError(err)
+	asserts.Equal(map[NetworkNodeAddress]NetworkNode{
+		NewNetworkNodeAddress("localhost", 8081): {Name: "Alpha", IsBootstrap: true, IsActive: true},
+	}, nodes)
+}
+
+func initServer(r *gin.Engine) {
+	services.ValidatorService{}.AddValidators()
+	NodesRegister(r.Group(NODES_DOMAIN_URL), &NodesEnv{
+		nodeService:        nodeService,
+		identity:           identity,
+		state:              state,
+		transactionService: transactionService,
+		blockService:       blockService,
+		blockMetrics:       NewBlockMetrics(),
+		seenTxs:            seenTxs,
+		announcedBlocks:    announcedBlocks,
+		client:             peerClient,
+		// the tests register their peers from the same client
+		peerRegistrations: NewPeerRegistrations(0),
+	})
+}
+
+// newRelayedTx creates a transaction of the test sender as relayed by a peer
+func newRelayedTx(key *ecdsa.PrivateKey, nonce uint64) *models.Transaction {
+	tx := models.NewTransaction(sender, sender, 10, 1, nonce, "", 1, test.ChainId)
+	if key != nil {
+		_ = tx.Sign(key)
+	}
+	return tx
+}
@@ -7,27 +7,45 @@ import (
 // nodes
 type NodeSerializer struct {
 	models.State
-	nodes map[NetworkNodeAddress]NetworkNode
+	nodes      map[NetworkNodeAddress]NetworkNode
+	peersStats map[NetworkNodeAddress]PeerStats
 }
 
 type NetworkNodeResponse struct {
-	Name        string `json:"name"`
-	Ip          string `json:"ip"`
-	Port        uint64 `json:"port"`
-	IsBootstrap bool   `json:"is_bootstrap"`
-	IsActive    bool   `json:"is_active"`
+	Name        string                  `json:"name"`
+	Ip          string                  `json:"ip"`
+	Port        uint64                  `json:"port"`
+	IsBootstrap bool                    `json:"is_bootstrap"`
+	IsActive    bool                    `json:"is_active"`
+	GrpcPort    uint64                  `json:"grpc_port,omitempty"`
+	Reputation  *PeerReputationResponse `json:"reputation,omitempty"`
+}
+
+type PeerReputationResponse struct {
+	Score             int    `json:"score"`
+	LatencyInMs       int64  `json:"latency_in_ms"`
+	Successes         uint64 `json:"successes"`
+	Failures          uint64 `json:"failures"`
+	InvalidBlocks     uint64 `json:"invalid_blocks"`
+	HeightLies        uint64 `json:"height_lies"`
+	InvalidHandshakes uint64 `json:"invalid_handshakes"`
+	Bans              uint64 `json:"bans"`
+	BannedUntil       uint64 `json:"banned_until,omitempty"`
 }
 
 type NetworkNodesResponse struct {
 	Hash                models.Hash           `json:"block_hash"`
 	Height              uint64                `json:"block_height"`
+	Work                string                `json:"total_work"`
 	NetworkNodeResponse []NetworkNodeResponse `json:"network_nodes"`
+	Handshake           NodeHandshake         `json:"handshake"`
 }
 
 func (n *NodeSerializer) Response() NetworkNodesResponse {
 	response := new(NetworkNodesResponse)
 	response.Hash = n.State.GetLatestBlockHash()
 	response.Height = n.State.GetLatestBlockHeight()
+	response.Work = n.State.GetTotalWork().String()
 
 	nodesResponse := make([]NetworkNodeResponse, len(n.nodes))
 	i := 0
@@ -38,6 +56,21 @@ func (n *NodeSerializer) Response() NetworkNodesResponse {
 			Port:        address.port,
 			IsBootstrap: node.IsBootstrap,
 			IsActive:    node.IsActive,
+			GrpcPort:    node.GrpcPort,
+		}
+		// only the peers this node has been in contact with have a reputation
+		if stats, ok := n.peersStats[address]; ok {
+			nodesResponse[i].Reputation = &PeerReputationResponse{
+				Score:             stats.Score,
+				LatencyInMs:       stats.LatencyInMs,
+				Successes:         stats.Successes,
+				Failures:          stats.Failures,
+				InvalidBlocks:     stats.InvalidBlocks,
+				HeightLies:        stats.HeightLies,
+				InvalidHandshakes: stats.InvalidHandshakes,
+				Bans:              stats.Bans,
+				BannedUntil:       stats.BannedUntil,
+			}
 		}
 		i++
 	}
@@ -46,74 +79,70 @@ func (n *NodeSerializer) Response() NetworkNodesResponse {
 	return *response
 }
 
-// blocks
-type BlockSerializer struct {
-	block models.Block
-}
-
-type BlocksSerializer struct {
-	blocks []models.Block
+// peers
+type PeerSerializer struct {
+	address NetworkNodeAddress
+	node    NetworkNode
 }
 
-type TransactionResponse struct {
-	From   models.Account `json:"from"`
-	To     models.Account `json:"to"`
-	Value  uint           `json:"value"`
-	Reason string         `json:"reason"`
-	Time   uint64         `json:"time"`
+func (p *PeerSerializer) Response() NetworkNodeResponse {
+	return NetworkNodeResponse{
+		Name:        p.node.Name,
+		Ip:          p.address.ip,
+		Port:        p.address.port,
+		IsBootstrap: p.node.IsBootstrap,
+		IsActive:    p.node.IsActive,
+		GrpcPort:    p.node.GrpcPort,
+	}
 }
 
-type BlockHeaderResponse struct {
-	Parent models.Hash `json:"parent"`
-	Height uint64      `json:"height"`
-	Nonce  uint32      `json:"nonce"`
-	Time   uint64      `json:"time"`
+// metrics
+type MetricsSerializer struct {
+	blockMetrics *BlockMetrics
 }
 
-type BlockResponse struct {
-	Header BlockHeaderResponse   `json:"header"`
-	Txs    []TransactionResponse `json:"transactions"`
+type RejectedBlocksResponse struct {
+	Total    uint64            `json:"total"`
+	ByReason map[string]uint64 `json:"by_reason"`
+	BySource map[string]uint64 `json:"by_source"`
 }
 
-type BlocksResponse struct {
-	Blocks []BlockResponse `json:"blocks"`
+type MetricsResponse struct {
+	RejectedBlocks RejectedBlocksResponse `json:"rejected_blocks"`
 }
 
-func (n *BlockSerializer) Response() BlockResponse {
-	response := BlockResponse{}
-	block := n.block
-
-	// add block metadata
-	response = BlockResponse{
-		Header: BlockHeaderResponse{
-			Parent: block.Header.Parent,
-			Height: block.Header.Height,
-			Nonce:  block.Header.Nonce,
-			Time:   block.Header.Time,
+func (m *MetricsSerializer) Response() MetricsResponse {
+	total, byReason, bySource := m.blockMetrics.RejectedBlocks()
+	return MetricsResponse{
+		RejectedBlocks: RejectedBlocksResponse{
+			Total:    total,
+			ByReason: byReason,
+			BySource: bySource,
 		},
 	}
+}
 
-	// add block transactions
-	txRes := make([]TransactionResponse, len(block.Txs))
-	for i, tx := range block.Txs {
-		txRes[i] = TransactionResponse{
-			From:   tx.From,
-			To:     tx.To,
-			Value:  tx.Value,
-			Reason: tx.Reason,
-			Time:   tx.Time,
-		}
-	}
-	response.Txs = txRes
+// proofs
+type TxProofSerializer struct {
+	txHash  models.Hash
+	blockDB models.BlockDB
+	proof   []models.MerkleProofNode
+}
 
-	return response
+type TxProofResponse struct {
+	TxHash      models.Hash              `json:"tx_hash"`
+	BlockHash   models.Hash              `json:"block_hash"`
+	BlockHeight uint64                   `json:"block_height"`
+	TxRoot      models.Hash              `json:"tx_root"`
+	Proof       []models.MerkleProofNode `json:"merkle_proof"`
 }
 
-func (n *BlocksSerializer) Response() BlocksResponse {
-	response := make([]BlockResponse, len(n.blocks))
-	for i, block := range n.blocks {
-		serializer := BlockSerializer{block: block}
-		response[i] = serializer.Response()
+func (t *TxProofSerializer) Response() TxProofResponse {
+	return TxProofResponse{
+		TxHash:      t.txHash,
+		BlockHash:   t.blockDB.Hash,
+		BlockHeight: t.blockDB.Block.Header.Height,
+		TxRoot:      t.blockDB.Block.Header.TxRoot,
+		Proof:       t.proof,
 	}
-	return BlocksResponse{response}
 }
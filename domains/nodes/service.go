@@ -1,6 +1,7 @@
 package nodes
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,9 +10,24 @@ import (
 	"github.com/pelletier/go-toml/v2"
 )
 
+var (
+	ErrNodeNotFound        = errors.New("node cannot be found")
+	ErrNodeNameAlreadyUsed = errors.New("node name is already used by another node")
+	ErrNodeDeactivated     = errors.New("node has been deactivated")
+	ErrNodeBanned          = errors.New("node is banned")
+	ErrTooManyNodes        = errors.New("too many nodes are known")
+)
+
+// MaxNetworkNodes number of nodes a node can register itself among at most
+const MaxNetworkNodes = 100
+
 type NodeService struct {
 	nodeDatabasePath string
 	mu               sync.Mutex
+
+	// the stats of the peers are kept in memory, a restart gives the peers a clean slate
+	peersStats map[NetworkNodeAddress]*PeerStats
+	statsMu    sync.Mutex
 }
 
 type (
@@ -21,6 +37,7 @@ type (
 		Port         uint64
 		Is_bootstrap bool
 		Is_active    bool
+		Grpc_port    uint64 `toml:",omitempty"`
 	}
 )
 
@@ -29,7 +46,10 @@ type NetworkNodeFromDB struct {
 }
 
 func NewNodeService(nodeDatabasePath string) (*NodeService, error) {
-	service := &NodeService{nodeDatabasePath: nodeDatabasePath}
+	service := &NodeService{
+		nodeDatabasePath: nodeDatabasePath,
+		peersStats:       make(map[NetworkNodeAddress]*PeerStats),
+	}
 	// check if the file can be opened and list the nodes
 	if _, err := service.List(); err != nil {
 		return nil, nil
@@ -42,56 +62,189 @@ func (u *NodeService) List() (map[NetworkNodeAddress]NetworkNode, error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
-	file, err := ioutil.ReadFile(u.nodeDatabasePath)
-	if err != nil {
-		return nil, fmt.Errorf("List: failed to open node database: %w", err)
-	}
-
-	var networkNodes NetworkNodeFromDB
-	err = toml.Unmarshal(file, &networkNodes)
+	networkNodes, err := u.read()
 	if err != nil {
-		return nil, fmt.Errorf("List: failed to unmarshal nodes: %w", err)
+		return nil, fmt.Errorf("List: %w", err)
 	}
 
-	nodesNb := len(networkNodes.Nodes)
-	nodes := make(map[NetworkNodeAddress]NetworkNode, nodesNb)
-	i := 0
+	nodes := make(map[NetworkNodeAddress]NetworkNode, len(networkNodes.Nodes))
 	for nodeName, node := range networkNodes.Nodes {
 		nodes[NewNetworkNodeAddress(node.Address, node.Port)] = NetworkNode{
 			Name:        string(nodeName),
 			IsBootstrap: node.Is_bootstrap,
 			IsActive:    node.Is_active,
+			GrpcPort:    node.Grpc_port,
 		}
-		i++
 	}
 	return nodes, nil
 }
 
-// Add nodes in the database, return error otherwise
+// Add nodes in the database, a node already known at the same address is replaced, return error otherwise
 func (u *NodeService) Add(nodes map[NetworkNodeAddress]NetworkNode) error {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
-	mapToInsert := make(map[NetworkNodeName]NetworkNodeRecord, len(nodes))
+	networkNodes, err := u.read()
+	if err != nil {
+		return fmt.Errorf("Add: %w", err)
+	}
+	if err = add(&networkNodes, nodes); err != nil {
+		return fmt.Errorf("Add: %w", err)
+	}
+
+	if err = u.write(networkNodes); err != nil {
+		return fmt.Errorf("Add: %w", err)
+	}
+	return nil
+}
+
+// Register adds a node announcing itself as an active node, a new node is refused once MaxNetworkNodes are known
+// a node already known at the same address keeps its bootstrap and active flags, so a deactivated or banned node
+// can't reactivate itself
+func (u *NodeService) Register(address NetworkNodeAddress, name string, grpcPort uint64) (NetworkNode, error) {
+	// checked before locking the database, a ban can lock it to deactivate the node
+	if u.IsBanned(address) {
+		return NetworkNode{}, fmt.Errorf("Register: %w: %s", ErrNodeBanned, address.String())
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	networkNodes, err := u.read()
+	if err != nil {
+		return NetworkNode{}, fmt.Errorf("Register: %w", err)
+	}
+
+	node := NetworkNode{
+		Name:     name,
+		IsActive: true,
+		GrpcPort: grpcPort,
+	}
+	isKnown := false
+	for _, record := range networkNodes.Nodes {
+		if NewNetworkNodeAddress(record.Address, record.Port) != address {
+			continue
+		}
+		if !record.Is_active {
+			return NetworkNode{}, fmt.Errorf("Register: %w: %s", ErrNodeDeactivated, address.String())
+		}
+		node.IsBootstrap = record.Is_bootstrap
+		isKnown = true
+	}
+	if !isKnown && len(networkNodes.Nodes) >= MaxNetworkNodes {
+		return NetworkNode{}, fmt.Errorf("Register: %w: %d", ErrTooManyNodes, len(networkNodes.Nodes))
+	}
+	if err = add(&networkNodes, map[NetworkNodeAddress]NetworkNode{address: node}); err != nil {
+		return NetworkNode{}, fmt.Errorf("Register: %w", err)
+	}
+
+	if err = u.write(networkNodes); err != nil {
+		return NetworkNode{}, fmt.Errorf("Register: %w", err)
+	}
+	return node, nil
+}
+
+// UpdateGrpcPort records the grpc port a known node has signed its status with, the database is only written
+// if the port has changed
+func (u *NodeService) UpdateGrpcPort(address NetworkNodeAddress, grpcPort uint64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	networkNodes, err := u.read()
+	if err != nil {
+		return fmt.Errorf("UpdateGrpcPort: %w", err)
+	}
+	for name, record := range networkNodes.Nodes {
+		if NewNetworkNodeAddress(record.Address, record.Port) != address {
+			continue
+		}
+		if record.Grpc_port == grpcPort {
+			return nil
+		}
+		record.Grpc_port = grpcPort
+		networkNodes.Nodes[name] = record
+
+		if err = u.write(networkNodes); err != nil {
+			return fmt.Errorf("UpdateGrpcPort: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("UpdateGrpcPort: %w: %s", ErrNodeNotFound, address.String())
+}
+
+// add replaces the records of the nodes known at the same addresses
+func add(networkNodes *NetworkNodeFromDB, nodes map[NetworkNodeAddress]NetworkNode) error {
+	if networkNodes.Nodes == nil {
+		networkNodes.Nodes = make(map[NetworkNodeName]NetworkNodeRecord, len(nodes))
+	}
+
 	for address, node := range nodes {
-		mapToInsert[NetworkNodeName(node.Name)] = NetworkNodeRecord{
+		// a name identifies a single node
+		if record, ok := networkNodes.Nodes[NetworkNodeName(node.Name)]; ok &&
+			NewNetworkNodeAddress(record.Address, record.Port) != address {
+			return fmt.Errorf("%w: %s", ErrNodeNameAlreadyUsed, node.Name)
+		}
+		// a node changing name replaces its previous record
+		for name, record := range networkNodes.Nodes {
+			if NewNetworkNodeAddress(record.Address, record.Port) == address {
+				delete(networkNodes.Nodes, name)
+			}
+		}
+		networkNodes.Nodes[NetworkNodeName(node.Name)] = NetworkNodeRecord{
 			Address:      address.ip,
 			Port:         address.port,
 			Is_bootstrap: node.IsBootstrap,
 			Is_active:    node.IsActive,
+			Grpc_port:    node.GrpcPort,
 		}
 	}
+	return nil
+}
 
-	nodesToInsert := NetworkNodeFromDB{mapToInsert}
-	byteNodes, err := toml.Marshal(&nodesToInsert)
+// Remove the node from the database, return error if the node cannot be found
+func (u *NodeService) Remove(name string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	networkNodes, err := u.read()
 	if err != nil {
-		return fmt.Errorf("Add: failed to marshal node: %w", err)
+		return fmt.Errorf("Remove: %w", err)
+	}
+	if _, ok := networkNodes.Nodes[NetworkNodeName(name)]; !ok {
+		return fmt.Errorf("Remove: %w: %s", ErrNodeNotFound, name)
 	}
+	delete(networkNodes.Nodes, NetworkNodeName(name))
 
-	err = os.WriteFile(u.nodeDatabasePath, byteNodes, 0o644)
+	if err = u.write(networkNodes); err != nil {
+		return fmt.Errorf("Remove: %w", err)
+	}
+	return nil
+}
+
+func (u *NodeService) read() (NetworkNodeFromDB, error) {
+	var networkNodes NetworkNodeFromDB
+
+	file, err := ioutil.ReadFile(u.nodeDatabasePath)
 	if err != nil {
-		return fmt.Errorf("Add: failed to write node in database: %w", err)
+		return networkNodes, fmt.Errorf("failed to open node database: %w", err)
 	}
 
+	err = toml.Unmarshal(file, &networkNodes)
+	if err != nil {
+		return networkNodes, fmt.Errorf("failed to unmarshal nodes: %w", err)
+	}
+	return networkNodes, nil
+}
+
+func (u *NodeService) write(networkNodes NetworkNodeFromDB) error {
+	byteNodes, err := toml.Marshal(&networkNodes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal node: %w", err)
+	}
+
+	err = os.WriteFile(u.nodeDatabasePath, byteNodes, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write node in database: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,86 @@
+package nodes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+func TestNodeService_UpdateGrpcPort(t *testing.T) {
+	test.InitTestContext()
+
+	// define variables
+	address := NewNetworkNodeAddress("localhost", 8081)
+
+	tests := []struct {
+		name     string
+		address  NetworkNodeAddress
+		grpcPort uint64
+		wantErr  error
+	}{
+		{
+			name:     "the grpc port of a known node should be updated",
+			address:  address,
+			grpcPort: 9081,
+			wantErr:  nil,
+		},
+		{
+			name:     "a known node which has stopped its grpc server should be reached through http",
+			address:  address,
+			grpcPort: 0,
+			wantErr:  nil,
+		},
+		{
+			name:     "the grpc port of an unknown node should return error",
+			address:  NewNetworkNodeAddress("localhost", 8083),
+			grpcPort: 9083,
+			wantErr:  ErrNodeNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestNodeService(t)
+			if err := u.UpdateGrpcPort(tt.address, tt.grpcPort); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateGrpcPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			nodes, err := u.List()
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if got := nodes[tt.address].GrpcPort; got != tt.grpcPort {
+				t.Errorf("List() grpc port = %d, want %d", got, tt.grpcPort)
+			}
+		})
+	}
+}
+
+func TestNodeService_Register(t *testing.T) {
+	test.InitTestContext()
+
+	// define variables
+	u := newTestNodeService(t)
+	knownNodes, err := u.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	nodes := make(map[NetworkNodeAddress]NetworkNode)
+	for i := len(knownNodes); i < MaxNetworkNodes; i++ {
+		nodes[NewNetworkNodeAddress("10.0.0.1", uint64(10000+i))] = NetworkNode{Name: fmt.Sprintf("node-%d", i), IsActive: true}
+	}
+	if err = u.Add(nodes); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// a new node is refused once the maximum number of nodes is known, a known node can still register again
+	if _, err = u.Register(NewNetworkNodeAddress("localhost", 8083), "Gamma", 0); !errors.Is(err, ErrTooManyNodes) {
+		t.Errorf("Register() error = %v, wantErr %v", err, ErrTooManyNodes)
+	}
+	if _, err = u.Register(NewNetworkNodeAddress("localhost", 8081), "Alpha", 0); err != nil {
+		t.Errorf("Register() error = %v, wantErr nil", err)
+	}
+}
@@ -7,19 +7,23 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"sync"
 	"time"
 
-	"github.com/thoas/go-funk"
-
 	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
 
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	. "github.com/v4lproik/simple-blockchain-quickstart/domains"
 	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 )
 
+// MaxDiscoveredNodes number of unknown nodes contacted and added to the known nodes during a synchronisation,
+// the next ones are discovered during the following synchronisations
+const MaxDiscoveredNodes = 20
+
 type BlockHeight uint64
 
 type NodeTaskManager struct {
@@ -31,11 +35,26 @@ type NodeTaskManager struct {
 	nodeService        *NodeService
 	transactionService services.TransactionService
 	blockService       services.BlockService
+	blockMetrics       *BlockMetrics
+	seenTxs            *SeenTxs
+
+	thisNodeAddress NetworkNodeAddress
+	announcedBlocks chan BlockAnnouncement
+	// transport used to talk to the peers
+	client NodeClient
 
 	isCurrentlyMining bool
 	syncedBlock       chan models.Block
 }
 
+// minedBlock result of a mining task
+type minedBlock struct {
+	block       *models.Block
+	txs         []models.Transaction
+	err         error
+	isCancelled bool
+}
+
 // NewNodeTaskManager handles all the background tasks needed for a node to sync its status
 // as well as mining new blocks
 func NewNodeTaskManager(
@@ -45,6 +64,11 @@ func NewNodeTaskManager(
 	state models.State,
 	transactionService services.TransactionService,
 	blockService services.BlockService,
+	blockMetrics *BlockMetrics,
+	seenTxs *SeenTxs,
+	thisNodeAddress NetworkNodeAddress,
+	announcedBlocks chan BlockAnnouncement,
+	client NodeClient,
 ) (*NodeTaskManager, error) {
 	if state == nil {
 		return nil, errors.New("NewNodeTaskManager: state cannot be nil")
@@ -52,6 +76,18 @@ func NewNodeTaskManager(
 	if nodeService == nil {
 		return nil, errors.New("NewNodeTaskManager: node service cannot be nil")
 	}
+	if blockMetrics == nil {
+		return nil, errors.New("NewNodeTaskManager: block metrics cannot be nil")
+	}
+	if seenTxs == nil {
+		return nil, errors.New("NewNodeTaskManager: seen transactions cannot be nil")
+	}
+	if announcedBlocks == nil {
+		return nil, errors.New("NewNodeTaskManager: announced blocks channel cannot be nil")
+	}
+	if client == nil {
+		return nil, errors.New("NewNodeTaskManager: node client cannot be nil")
+	}
 
 	return &NodeTaskManager{
 		syncNodeRefreshIntervalInSeconds: syncNodeRefreshIntervalInSeconds,
@@ -60,6 +96,11 @@ func NewNodeTaskManager(
 		state:                            state,
 		transactionService:               transactionService,
 		blockService:                     blockService,
+		blockMetrics:                     blockMetrics,
+		seenTxs:                          seenTxs,
+		thisNodeAddress:                  thisNodeAddress,
+		announcedBlocks:                  announcedBlocks,
+		client:                           client,
 		syncedBlock:                      make(chan models.Block),
 	}, nil
 }
@@ -71,39 +112,81 @@ func (n *NodeTaskManager) RunMine(ctx context.Context) {
 	ticker := time.NewTicker(time.Second * time.Duration(n.createNewBlockIntervalInSeconds))
 
 	// shared variables
+	// the block is mined in the background so a block synced in the meantime can cancel it
 	var miningCancelCtx context.CancelFunc
+	minedBlocks := make(chan minedBlock, 1)
 
 	for {
 		select {
 		case <-ticker.C:
-			txs := n.transactionService.GetPendingTxs()
-			if len(txs) > 0 && !n.isCurrentlyMining {
+			n.transactionService.DropExpiredTxs()
+			n.dropStaleTxs()
+			if n.isCurrentlyMining {
+				continue
+			}
+			txs := buildBlockTxs(n.state, n.transactionService.GetPendingTxs())
+			if len(txs) > 0 {
+				// let the consensus engine fill the fields of the header it's in charge of
+				header := models.BlockHeader{
+					Parent: n.state.GetLatestBlockHash(),
+					Height: n.state.GetLatestBlockHeight() + 1,
+					Time:   utils.DefaultTimeService.UnixUint64(),
+					Miner:  n.blockService.ThisNodeMiningAddress(),
+				}
+				if err := n.state.PrepareHeader(&header); err != nil {
+					// with the poa engine, the node waits for its turn or only follows the chain if it's not a signer
+					if errors.Is(err, models.ErrUnauthorizedSigner) || errors.Is(err, models.ErrSignerRecentlySigned) {
+						Logger.Debugf("RunMine: not allowed to seal the next block: %s", err)
+						continue
+					}
+					Logger.Errorf("RunMine: failed to prepare the block header: %s", err)
+					continue
+				}
 				n.isCurrentlyMining = true
 
 				var miningCtx context.Context
-				var block *models.Block
-				var err error
 				miningCtx, miningCancelCtx = context.WithCancel(context.Background())
 
 				// mine a new block
-				if block, err = n.blockService.Mine(miningCtx, models.PendingBlock{
-					Parent:       n.state.GetLatestBlockHash(),
-					Height:       n.state.GetLatestBlockHeight() + 1,
-					Time:         utils.DefaultTimeService.UnixUint64(),
-					MinerAddress: n.blockService.ThisNodeMiningAddress(),
-					Txs:          txsMapToArr(txs),
-				}); err != nil {
-					Logger.Errorf("RunMine: failed to mine a block: %s", err)
-				} else {
-					// if all ok, add block to database
-					if err = n.state.AddBlock(*block); err != nil {
-						Logger.Errorf("RunMine: failed to add block to state: %s", err)
-					} else {
-						// if all ok, remove the mined transactions
-						n.transactionService.RemovePendingTxs(funk.Keys(txs).([]models.TransactionId))
-					}
+				pendingBlock := models.PendingBlock{
+					Parent:       header.Parent,
+					Height:       header.Height,
+					Bits:         header.Bits,
+					Time:         header.Time,
+					MinerAddress: header.Miner,
+					Txs:          txs,
 				}
-				n.isCurrentlyMining = false
+				go func() {
+					block, err := n.blockService.Mine(miningCtx, pendingBlock)
+					minedBlocks <- minedBlock{block: block, txs: txs, err: err, isCancelled: miningCtx.Err() != nil}
+				}()
+			}
+		case mined := <-minedBlocks:
+			n.isCurrentlyMining = false
+			miningCancelCtx()
+			if mined.isCancelled {
+				Logger.Debugf("RunMine: mining has been cancelled by a synced block")
+				continue
+			}
+			if mined.err != nil {
+				Logger.Errorf("RunMine: failed to mine a block: %s", mined.err)
+				continue
+			}
+
+			// if all ok, add block to database
+			orphanedTxs, err := n.state.AddBlock(*mined.block)
+			n.returnTxsToPool(orphanedTxs)
+			if err != nil {
+				Logger.Errorf("RunMine: failed to add block to state: %s", err)
+				n.rejectBlock(LOCAL_BLOCK_SOURCE, err)
+			} else if blockHash, _ := mined.block.Hash(); blockHash != n.state.GetLatestBlockHash() {
+				// the chain has moved while we were mining, the block only lives on a competing branch
+				Logger.Warnf("RunMine: mined block %s is not part of the main chain", blockHash.Hex())
+			} else {
+				// if all ok, remove the mined transactions, the skipped ones stay in the pool
+				n.transactionService.RemovePendingTxs(txsHashes(mined.txs))
+				// let the peers know without waiting for their next synchronisation
+				go n.announceBlock(*mined.block)
 			}
 		case block := <-n.syncedBlock:
 			// if we are mining then we might want to remove any pendingTx that is currently been mined
@@ -127,7 +210,9 @@ func (n *NodeTaskManager) RunMine(ctx context.Context) {
 			}
 		case <-ctx.Done():
 			Logger.Debugf("RunMine: stop mining process...")
-			miningCancelCtx()
+			if miningCancelCtx != nil {
+				miningCancelCtx()
+			}
 			return
 		}
 	}
@@ -150,13 +235,29 @@ func (n *NodeTaskManager) RunSync(ctx context.Context) {
 			}
 
 			// time to synchronise our database as we have other nodes' status block height
-			err = n.runSyncNode(nodeStatus)
+			err = n.runSyncNode(ctx, nodeStatus)
 			if err != nil {
 				Logger.Errorf("RunSync: failed to synchronise: %s", err)
 			}
+		case announcement := <-n.announcedBlocks:
+			// a peer has a new block, no need to wait for the next tick to fetch it
+			if _, ok := n.state.GetBlockByHash(announcement.Hash); ok {
+				continue
+			}
+			// the peer may have been banned or deactivated since its announcement has been queued
+			if isTrusted, err := n.nodeService.IsTrusted(announcement.Node); err != nil || !isTrusted {
+				continue
+			}
+			Logger.Debugf("RunSync: block %s announced by node %s", announcement.Hash.Hex(), announcement.Node.String())
+			// the announcement isn't signed, anyone could have sent it on behalf of the peer, so the peer isn't
+			// penalised if it can't serve the block, only its signed status is held against it
+			if err := n.syncBlocksFromNode(ctx, announcement.Node); err != nil {
+				Logger.Errorf("RunSync: failed to synchronise announced block: %s", err)
+			}
 		case <-ctx.Done():
 			Logger.Debugf("RunSync: Stop looking for new nodes within the network")
 			ticker.Stop()
+			return
 		}
 	}
 }
@@ -183,7 +284,13 @@ func (n *NodeTaskManager) runFetchNodeStatus() (map[NetworkNodeAddress]NetworkNo
 	// we use a buffered channel, no need for safe concurrent map
 	nodeStatus := make(map[NetworkNodeAddress]NetworkNodeStatus, len(knownNetworkNodes))
 
-	go fetchNodesHeights(done, wg, c, knownNetworkNodes)
+	// the nodes found through our peers are added to the known nodes
+	networkNodes := make(map[NetworkNodeAddress]NetworkNode, len(knownNetworkNodes))
+	for address, node := range knownNetworkNodes {
+		networkNodes[address] = node
+	}
+
+	go n.fetchNodesHeights(done, wg, c, networkNodes)
 
 waitLoop:
 	for {
@@ -199,18 +306,50 @@ waitLoop:
 	}
 	close(done)
 
+	n.addDiscoveredNodes(knownNetworkNodes, networkNodes)
+
 	return nodeStatus, nil
 }
 
-func fetchNodesHeights(done chan<- bool, wg *sync.WaitGroup, nodeStatus chan map[NetworkNodeAddress]NetworkNodeStatus, nodes map[NetworkNodeAddress]NetworkNode) {
+// addDiscoveredNodes persists the nodes found through our peers, so they are still known after a restart
+// a node whose name is already used by another node is skipped
+func (n *NodeTaskManager) addDiscoveredNodes(knownNetworkNodes, networkNodes map[NetworkNodeAddress]NetworkNode) {
+	for address, node := range networkNodes {
+		if _, isKnownNode := knownNetworkNodes[address]; isKnownNode {
+			continue
+		}
+		if err := n.nodeService.Add(map[NetworkNodeAddress]NetworkNode{address: node}); err != nil {
+			Logger.Warnf("addDiscoveredNodes: failed to add node %s: %s", address.String(), err)
+			continue
+		}
+		Logger.Infof("addDiscoveredNodes: node %s added to the known nodes", address.String())
+	}
+}
+
+func (n *NodeTaskManager) fetchNodesHeights(done chan<- bool, wg *sync.WaitGroup, nodeStatus chan map[NetworkNodeAddress]NetworkNodeStatus, nodes map[NetworkNodeAddress]NetworkNode) {
+	nodeService := n.nodeService
+
+	// nodes is updated by each goroutine with the new nodes found
+	mu := &sync.Mutex{}
+	discoveredNodes := 0
+	knownNodes := make([]NetworkNodeAddress, 0, len(nodes))
+	for address, node := range nodes {
+		// inactive and banned nodes are not contacted
+		if !node.IsActive || nodeService.IsBanned(address) {
+			wg.Done()
+			continue
+		}
+		knownNodes = append(knownNodes, address)
+	}
+
 	// asynchronously loop over each knownNode
-	for address := range nodes {
+	for _, address := range knownNodes {
 		go func(address NetworkNodeAddress) {
 			defer wg.Done()
 
 			// call the node and get its status
 			// send in channel node height or 0 if the node is not reachable
-			status, err := getNodeStatus(address)
+			status, err := n.fetchNodeStatus(address)
 			if err != nil {
 				nodeStatus <- map[NetworkNodeAddress]NetworkNodeStatus{address: status}
 				Logger.Warnf("runFetchNodeStatus: failed to reach node: %s", err)
@@ -221,11 +360,10 @@ func fetchNodesHeights(done chan<- bool, wg *sync.WaitGroup, nodeStatus chan map
 			// each node status returns its own knownNodes information
 			// we also want to reach out to those nodes as their heights might be closer to the world state
 			for networkNodeIp, newNode := range status.NetworkNodes {
-				_, isKnownNode := nodes[networkNodeIp]
-				// we only want to reach out to the node if it's not known and active
-				if !isKnownNode && newNode.IsActive {
-					nodes[networkNodeIp] = newNode
-
+				mu.Lock()
+				isNewNode := n.discoverNode(nodes, &discoveredNodes, networkNodeIp, newNode)
+				mu.Unlock()
+				if isNewNode {
 					// increment delta to one as we run a new goroutine
 					wg.Add(1)
 					go func(address NetworkNodeAddress) {
@@ -233,7 +371,7 @@ func fetchNodesHeights(done chan<- bool, wg *sync.WaitGroup, nodeStatus chan map
 
 						// call the node and get its status
 						// send in channel node height or 0 if the node is not reachable
-						status, err := getNodeStatus(address)
+						status, err := n.fetchNodeStatus(address)
 						if err != nil {
 							nodeStatus <- map[NetworkNodeAddress]NetworkNodeStatus{address: status}
 							Logger.Warnf("runFetchNodeStatus: failed to reach node: %s", err)
@@ -250,7 +388,27 @@ func fetchNodesHeights(done chan<- bool, wg *sync.WaitGroup, nodeStatus chan map
 	done <- true
 }
 
-func (n *NodeTaskManager) runSyncNode(nodeStatus map[NetworkNodeAddress]NetworkNodeStatus) error {
+// discoverNode adds a node found in the status of a peer to the nodes to contact
+// returns false if the node is already known, is this node, is inactive or banned, uses the name of another node
+// or if MaxDiscoveredNodes have already been found during this synchronisation
+func (n *NodeTaskManager) discoverNode(nodes map[NetworkNodeAddress]NetworkNode, discoveredNodes *int, address NetworkNodeAddress, node NetworkNode) bool {
+	if _, isKnownNode := nodes[address]; isKnownNode || address == n.thisNodeAddress {
+		return false
+	}
+	if !node.IsActive || n.nodeService.IsBanned(address) || *discoveredNodes >= MaxDiscoveredNodes {
+		return false
+	}
+	for _, knownNode := range nodes {
+		if knownNode.Name == node.Name {
+			return false
+		}
+	}
+	nodes[address] = node
+	*discoveredNodes++
+	return true
+}
+
+func (n *NodeTaskManager) runSyncNode(ctx context.Context, nodeStatus map[NetworkNodeAddress]NetworkNodeStatus) error {
 	Logger.Debugf("runSyncNode: synchronisation has started")
 
 	// if no node found in the network, let's stop sync
@@ -258,44 +416,44 @@ func (n *NodeTaskManager) runSyncNode(nodeStatus map[NetworkNodeAddress]NetworkN
 		return nil
 	}
 
-	// get current block height
+	// get current chain work
 	state := n.state
-	currentHeight := state.GetLatestBlockHeight()
+	currentWork := state.GetTotalWork()
 
-	// find the node with the highest block height and higher than ours
+	// find the node with the heaviest chain and the consensus engine would switch to, the chain with the most
+	// cumulative weight wins even if it's not the longest one
 	// if condition met, then sync, otherwise do not do anything
-	var highestHeight uint64
+	highestWork := big.NewInt(0)
 	var nodeToSyncFrom map[NetworkNodeAddress]NetworkNodeStatus
 	for address, status := range nodeStatus {
-		if currentHeight < status.Height && highestHeight < status.Height {
+		if status.Work == nil {
+			continue
+		}
+		if state.Engine().SelectFork(currentWork, status.Work) && highestWork.Cmp(status.Work) < 0 {
 			if nodeToSyncFrom == nil {
 				nodeToSyncFrom = make(map[NetworkNodeAddress]NetworkNodeStatus, 1)
 			}
 			nodeToSyncFrom[address] = status
-			highestHeight = status.Height
+			highestWork = status.Work
 		}
 	}
 
-	// skip sync if couldn't find any node with a higher block height
+	// skip sync if couldn't find any node with a heavier chain
 	if nodeToSyncFrom == nil {
-		Logger.Debugf("runSyncNode: couldn't find a node with a higher block height than us")
+		Logger.Debugf("runSyncNode: couldn't find a node with a heavier chain than us")
 		return nil
 	}
 
 	// start sync the node
 	for address, status := range nodeToSyncFrom {
-		missingBlockCount := status.Height - currentHeight
-		currentHash := state.GetLatestBlockHash()
-
-		Logger.Debugf("runSyncNode: starting synchronisation, new blocks (%d) needs from %s to be added", missingBlockCount, address.String())
-		blocks, err := getNextNodeBlocksFromHash(address, currentHash)
-		if err != nil {
-			return fmt.Errorf("runSyncNode: failed at fetching blocks from node to sychronise from: %w", err)
+		Logger.Debugf("runSyncNode: starting synchronisation, node %s has a heavier chain (height=%d)", address.String(), status.Height)
+		if err := n.syncBlocksFromNode(ctx, address); err != nil {
+			return fmt.Errorf("runSyncNode: %w", err)
 		}
-
-		// insert the new blocks into our database
-		if err = state.AddBlocks(blocks); err != nil {
-			return fmt.Errorf("runSyncNode: failed to add blocks into database: %w", err)
+		// the node has claimed a chain it couldn't serve
+		if _, ok := state.GetBlockByHash(status.Hash); !ok {
+			Logger.Warnf("runSyncNode: node %s couldn't serve its latest block %s", address.String(), status.Hash.Hex())
+			n.nodeService.RecordHeightLie(address)
 		}
 	}
 
@@ -303,15 +461,124 @@ func (n *NodeTaskManager) runSyncNode(nodeStatus map[NetworkNodeAddress]NetworkN
 	return nil
 }
 
-func getNodeStatus(nodeAddress NetworkNodeAddress) (NetworkNodeStatus, error) {
-	url := fmt.Sprintf("http://%s%s%s", nodeAddress.String(), NODES_DOMAIN_URL, STATUS_NODE_ENDPOINT)
+// syncBlocksFromNode fetches the blocks of a node following our main chain and adds them to our database
+// the miner is notified of each new block so it stops mining transactions which have already been mined,
+// unless the node is stopping and the miner isn't listening anymore
+func (n *NodeTaskManager) syncBlocksFromNode(ctx context.Context, address NetworkNodeAddress) error {
+	blocks, err := getNodeBlocksFromLocator(n.client, address, n.state.GetBlockLocator())
+	if err != nil {
+		n.nodeService.RecordFailure(address)
+		return fmt.Errorf("syncBlocksFromNode: failed at fetching blocks from node to sychronise from: %w", err)
+	}
+
+	// refuse the whole batch if the peer is trying to inject a transaction which hasn't
+	// been signed by its sender, the state would refuse it anyway when applying the block
+	if err = verifyBlocksSignatures(blocks); err != nil {
+		n.rejectPeerBlocks(address, err)
+		return fmt.Errorf("syncBlocksFromNode: node %s sent invalid blocks: %w", address.String(), err)
+	}
+
+	// insert the new blocks into our database, the chain might be reorganised and the transactions
+	// of the blocks which have left the main chain need to be mined again
+	orphanedTxs, err := n.state.AddBlocks(blocks)
+	n.returnTxsToPool(orphanedTxs)
+	if err != nil {
+		n.rejectPeerBlocks(address, err)
+		return fmt.Errorf("syncBlocksFromNode: failed to add blocks into database: %w", err)
+	}
+
+	for _, block := range blocks {
+		select {
+		case n.syncedBlock <- block:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// rejectPeerBlocks records the blocks refused by the state, the peer which has served them loses reputation
+func (n *NodeTaskManager) rejectPeerBlocks(address NetworkNodeAddress, err error) {
+	var rejectedBlockErr *models.RejectedBlockError
+	if errors.As(err, &rejectedBlockErr) {
+		n.nodeService.RecordInvalidBlocks(address)
+	}
+	n.rejectBlock(address.String(), err)
+}
+
+// rejectBlock records the block refused by the state, a block which couldn't be added for another
+// reason (eg. database failure) doesn't say anything about its source
+func (n *NodeTaskManager) rejectBlock(source string, err error) {
+	var rejectedBlockErr *models.RejectedBlockError
+	if errors.As(err, &rejectedBlockErr) {
+		n.blockMetrics.RejectBlock(source, err)
+	}
+}
+
+// dropStaleTxs removes from the pool the transactions whose nonce has already been used in the main chain
+// eg. a transaction included in a block synced from another node or replaced after a reorganisation
+func (n *NodeTaskManager) dropStaleTxs() {
+	staleTxs := make([]models.TransactionId, 0)
+	for txHash, tx := range n.transactionService.GetPendingTxs() {
+		if tx.Nonce < n.state.GetNextNonce(tx.From) {
+			staleTxs = append(staleTxs, txHash)
+		}
+	}
+	for _, txHash := range staleTxs {
+		Logger.Debugf("dropStaleTxs: transaction %s dropped from the pool", models.Hash(txHash).Hex())
+		n.transactionService.DropPendingTx(txHash, models.ErrTxNonceAlreadyUsed)
+	}
+}
+
+// returnTxsToPool adds back to the mempool the transactions of the blocks which have left the main chain
+func (n *NodeTaskManager) returnTxsToPool(txs []models.Transaction) {
+	for _, tx := range txs {
+		if err := n.transactionService.AddPendingTx(tx); err != nil {
+			Logger.Debugf("returnTxsToPool: transaction not returned to the pool: %s", err)
+		}
+	}
+}
+
+// fetchNodeStatus gets the status of the node, the time taken by the node to answer is part of its reputation
+// a status which isn't signed by the node or which belongs to another chain is rejected
+func (n *NodeTaskManager) fetchNodeStatus(nodeAddress NetworkNodeAddress) (NetworkNodeStatus, error) {
+	// a new nonce for each request, a status signed for another verifier or earlier can't be replayed
+	nonce, err := NewHandshakeNonce()
+	if err != nil {
+		return NetworkNodeStatus{}, fmt.Errorf("fetchNodeStatus: %w", err)
+	}
+
+	start := time.Now()
+	status, err := n.client.GetStatus(nodeAddress, nonce)
+	if err != nil {
+		n.nodeService.RecordFailure(nodeAddress)
+		return NetworkNodeStatus{}, err
+	}
+	n.nodeService.RecordSuccess(nodeAddress, time.Since(start))
+
+	if err = VerifyHandshake(status, nonce, n.state.ChainId(), n.state.GenesisHash()); err != nil {
+		n.nodeService.RecordInvalidHandshake(nodeAddress)
+		return NetworkNodeStatus{}, fmt.Errorf("fetchNodeStatus: node %s rejected: %w", nodeAddress.String(), err)
+	}
+	if err = n.nodeService.VerifyPublicKey(nodeAddress, status.Handshake.PublicKey); err != nil {
+		n.nodeService.RecordInvalidHandshake(nodeAddress)
+		return NetworkNodeStatus{}, fmt.Errorf("fetchNodeStatus: node %s rejected: %w", nodeAddress.String(), err)
+	}
+
+	// the grpc port is trusted once signed by the node, the client switches to grpc when it refreshes the peers
+	if err = n.nodeService.UpdateGrpcPort(nodeAddress, status.Handshake.GrpcPort); err != nil && !errors.Is(err, ErrNodeNotFound) {
+		Logger.Errorf("fetchNodeStatus: grpc port of node %s cannot be updated: %s", nodeAddress.String(), err)
+	}
+	return status, nil
+}
+
+func getNodeStatus(nodeAddress NetworkNodeAddress, nonce models.Hash) (NetworkNodeStatus, error) {
+	url := fmt.Sprintf("http://%s%s%s?nonce=%s", nodeAddress.String(), NODES_DOMAIN_URL, STATUS_NODE_ENDPOINT, nonce.Hex())
 
 	req, _ := http.NewRequest(http.MethodGet, url, nil)
 	req.Header.Set("Content-Type", "application/json")
 
-	// TODO Do not use default http client
-	cc := &http.Client{}
-	response, err := cc.Do(req)
+	response, err := peerHttpClient.Do(req)
 	if err != nil {
 		return NetworkNodeStatus{}, err
 	}
@@ -338,7 +605,11 @@ func unmarshalNodeStatus(r *http.Response) (NetworkNodeStatus, error) {
 
 	statusNode := NetworkNodeStatus{}
 	statusNode.Hash = response.Status.Hash
+	statusNode.Handshake = response.Status.Handshake
 	statusNode.Height = response.Status.Height
+	if work, ok := new(big.Int).SetString(response.Status.Work, 10); ok {
+		statusNode.Work = work
+	}
 
 	statusNode.NetworkNodes = make(map[NetworkNodeAddress]NetworkNode, len(response.Status.NetworkNodeResponse))
 	for _, nodeResponse := range response.Status.NetworkNodeResponse {
@@ -346,12 +617,27 @@ func unmarshalNodeStatus(r *http.Response) (NetworkNodeStatus, error) {
 			Name:        nodeResponse.Name,
 			IsBootstrap: nodeResponse.IsBootstrap,
 			IsActive:    nodeResponse.IsActive,
+			GrpcPort:    nodeResponse.GrpcPort,
 		}
 	}
 
 	return statusNode, nil
 }
 
+// getNodeBlocksFromLocator fetches the blocks following the most recent block of the locator the node knows about
+func getNodeBlocksFromLocator(client NodeClient, nodeAddress NetworkNodeAddress, locator []models.Hash) ([]models.Block, error) {
+	for _, hash := range locator {
+		blocks, err := client.GetNextBlocksFromHash(nodeAddress, hash)
+		if err != nil {
+			return nil, fmt.Errorf("getNodeBlocksFromLocator: %w", err)
+		}
+		if len(blocks) > 0 {
+			return blocks, nil
+		}
+	}
+	return []models.Block{}, nil
+}
+
 func getNextNodeBlocksFromHash(nodeAddress NetworkNodeAddress, hash models.Hash) ([]models.Block, error) {
 	// generate url
 	url := fmt.Sprintf("http://%s%s%s", nodeAddress.String(), NODES_DOMAIN_URL, BLOCKS_NODE_ENDPOINT)
@@ -364,13 +650,10 @@ func getNextNodeBlocksFromHash(nodeAddress NetworkNodeAddress, hash models.Hash)
 	// marshall payload
 	body, _ := json.Marshal(listBlocksParam)
 
-	// TODO Do not use default http client
 	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 
-	// TODO Do not use default http client
-	cc := &http.Client{}
-	res, err := cc.Do(req)
+	res, err := peerHttpClient.Do(req)
 	if err != nil {
 		return []models.Block{}, err
 	}
@@ -387,41 +670,15 @@ func getBlocks(r *http.Response) ([]models.Block, error) {
 	}
 	defer r.Body.Close()
 
-	var response BlocksResponse
-	err = json.Unmarshal(reqBodyJson, &response)
-	if err != nil {
-		return blocks, fmt.Errorf("unable to unmarshal response body %s", err)
-	}
-
 	var blocksRes BlocksResponse
 	err = json.Unmarshal(reqBodyJson, &blocksRes)
 	if err != nil {
-		return blocks, err
+		return blocks, fmt.Errorf("unable to unmarshal response body %s", err)
 	}
 
 	blocks = make([]models.Block, len(blocksRes.Blocks))
 	for i, blockRes := range blocksRes.Blocks {
-		// format transactions
-		txs := make([]models.Transaction, len(blockRes.Txs))
-		for y, tx := range blockRes.Txs {
-			txs[y] = models.Transaction{
-				From:   tx.From,
-				To:     tx.To,
-				Value:  tx.Value,
-				Reason: tx.Reason,
-				Time:   tx.Time,
-			}
-		}
-		// create block
-		block := models.NewBlock(
-			blockRes.Header.Parent,
-			blockRes.Header.Height,
-			blockRes.Header.Nonce,
-			blockRes.Header.Time,
-			txs,
-		)
-		// add to array of blocks
-		blocks[i] = block
+		blocks[i] = blockRes.Block()
 	}
 	return blocks, nil
 }
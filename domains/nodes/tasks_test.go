@@ -0,0 +1,132 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+// testBlocksClient serves the test blocks whatever the hash asked
+type testBlocksClient struct {
+	NodeClient
+}
+
+func (c testBlocksClient) GetNextBlocksFromHash(nodeAddress NetworkNodeAddress, hash models.Hash) ([]models.Block, error) {
+	return blocks, nil
+}
+
+func TestNodeTaskManager_discoverNode(t *testing.T) {
+	test.InitTestContext()
+
+	// define variables
+	thisNodeAddress := NewNetworkNodeAddress("localhost", 8080)
+	bannedAddress := NewNetworkNodeAddress("localhost", 8090)
+
+	tests := []struct {
+		name            string
+		address         NetworkNodeAddress
+		node            NetworkNode
+		discoveredNodes int
+		want            bool
+	}{
+		{
+			name:    "an unknown active node should be discovered",
+			address: NewNetworkNodeAddress("localhost", 8083),
+			node:    NetworkNode{Name: "Gamma", IsActive: true},
+			want:    true,
+		},
+		{
+			name:    "a known node should be skipped",
+			address: NewNetworkNodeAddress("localhost", 8081),
+			node:    NetworkNode{Name: "Alpha", IsActive: true},
+			want:    false,
+		},
+		{
+			name:    "this node should be skipped",
+			address: thisNodeAddress,
+			node:    NetworkNode{Name: "Self", IsActive: true},
+			want:    false,
+		},
+		{
+			name:    "an inactive node should be skipped",
+			address: NewNetworkNodeAddress("localhost", 8083),
+			node:    NetworkNode{Name: "Gamma", IsActive: false},
+			want:    false,
+		},
+		{
+			name:    "a banned node should be skipped",
+			address: bannedAddress,
+			node:    NetworkNode{Name: "Gamma", IsActive: true},
+			want:    false,
+		},
+		{
+			name:    "a node using the name of a known node should be skipped",
+			address: NewNetworkNodeAddress("127.0.0.1", 8081),
+			node:    NetworkNode{Name: "Alpha", IsActive: true},
+			want:    false,
+		},
+		{
+			name:            "a node found once too many nodes have been discovered should be skipped",
+			address:         NewNetworkNodeAddress("localhost", 8083),
+			node:            NetworkNode{Name: "Gamma", IsActive: true},
+			discoveredNodes: MaxDiscoveredNodes,
+			want:            false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestNodeService(t)
+			for i := 0; i < 11; i++ {
+				u.RecordFailure(bannedAddress)
+			}
+			n := &NodeTaskManager{nodeService: u, thisNodeAddress: thisNodeAddress}
+			nodes, err := u.List()
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			discoveredNodes := tt.discoveredNodes
+			if got := n.discoverNode(nodes, &discoveredNodes, tt.address, tt.node); got != tt.want {
+				t.Errorf("discoverNode() = %v, want %v", got, tt.want)
+			}
+			_, isAdded := nodes[tt.address]
+			if isAdded != tt.want && tt.address != NewNetworkNodeAddress("localhost", 8081) {
+				t.Errorf("discoverNode() added the node = %v, want %v", isAdded, tt.want)
+			}
+			if tt.want && discoveredNodes != tt.discoveredNodes+1 {
+				t.Errorf("discoverNode() discovered nodes = %d, want %d", discoveredNodes, tt.discoveredNodes+1)
+			}
+		})
+	}
+}
+
+func TestNodeTaskManager_syncBlocksFromNode(t *testing.T) {
+	test.InitTestContext()
+
+	// define variables, the miner isn't listening to the synced blocks anymore
+	n := &NodeTaskManager{
+		state:       state,
+		nodeService: newTestNodeService(t),
+		client:      testBlocksClient{},
+		syncedBlock: make(chan models.Block),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the synchronisation shouldn't wait for the miner once the node is stopping
+	done := make(chan error, 1)
+	go func() {
+		done <- n.syncBlocksFromNode(ctx, NewNetworkNodeAddress("localhost", 8081))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("syncBlocksFromNode() error = %v, wantErr nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("syncBlocksFromNode() is blocked sending the synced blocks")
+	}
+}
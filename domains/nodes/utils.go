@@ -1,7 +1,46 @@
 package nodes
 
-import "github.com/v4lproik/simple-blockchain-quickstart/common/models"
+import (
+	"fmt"
+	"sort"
 
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+// buildBlockTxs returns the pending transactions which can be applied on top of the main chain
+// the transactions which have become invalid since they have been added to the pool (eg. after a
+// reorganisation) are skipped instead of failing the whole block, along with the following transactions
+// of their sender
+func buildBlockTxs(state models.StateReader, txsMap map[models.TransactionId]models.Transaction) []models.Transaction {
+	nonces := make(map[models.Account]uint64)
+	balances := make(map[models.Account]uint)
+
+	blockTxs := make([]models.Transaction, 0, len(txsMap))
+	for _, tx := range txsMapToArr(txsMap) {
+		nonce, ok := nonces[tx.From]
+		if !ok {
+			nonce = state.GetNextNonce(tx.From)
+			nonces[tx.From] = nonce
+			balances[tx.From] = state.GetBalance(tx.From)
+		}
+
+		// the amounts received in the same block are not taken into account
+		cost, err := tx.Cost()
+		if err != nil || tx.ChainId != state.ChainId() || tx.Nonce != nonce || cost > balances[tx.From] {
+			txHash, _ := tx.Hash()
+			Logger.Debugf("buildBlockTxs: transaction %s skipped from=%s nonce=%d", models.Hash(txHash).Hex(), tx.From, tx.Nonce)
+			continue
+		}
+		nonces[tx.From]++
+		balances[tx.From] -= cost
+		blockTxs = append(blockTxs, tx)
+	}
+	return blockTxs
+}
+
+// txsMapToArr returns the transactions ordered by sender and nonce, so the transactions
+// of an account are applied in the order they have been signed
 func txsMapToArr(txsMap map[models.TransactionId]models.Transaction) []models.Transaction {
 	arr := make([]models.Transaction, len(txsMap))
 
@@ -11,5 +50,38 @@ func txsMapToArr(txsMap map[models.TransactionId]models.Transaction) []models.Tr
 		i++
 	}
 
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].From != arr[j].From {
+			return arr[i].From < arr[j].From
+		}
+		return arr[i].Nonce < arr[j].Nonce
+	})
+
 	return arr
 }
+
+// txsHashes returns the hashes of the transactions
+func txsHashes(txs []models.Transaction) []models.TransactionId {
+	hashes := make([]models.TransactionId, len(txs))
+	for i, tx := range txs {
+		hashes[i], _ = tx.Hash()
+	}
+	return hashes
+}
+
+// verifyBlocksSignatures checks that every transaction of the blocks has been signed by its sender
+func verifyBlocksSignatures(blocks []models.Block) error {
+	for _, block := range blocks {
+		for _, tx := range block.Txs {
+			if err := tx.VerifySignature(); err != nil {
+				blockHash, _ := block.Hash()
+				return fmt.Errorf("verifyBlocksSignatures: %w", &models.RejectedBlockError{
+					Hash:   blockHash,
+					Height: block.Header.Height,
+					Err:    err,
+				})
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package nodes
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+// testStateReader state of the chain the block transactions are built on top of
+type testStateReader struct {
+	balances map[models.Account]uint
+	nonces   map[models.Account]uint64
+}
+
+func (s testStateReader) ChainId() string {
+	return test.ChainId
+}
+
+func (s testStateReader) GetNextNonce(account models.Account) uint64 {
+	return s.nonces[account]
+}
+
+func (s testStateReader) GetBalance(account models.Account) uint {
+	return s.balances[account]
+}
+
+func (s testStateReader) CanVote(account models.Account) bool {
+	return true
+}
+
+func Test_buildBlockTxs(t *testing.T) {
+	test.InitTestContext()
+
+	// define variables
+	senderKey, _ := crypto.GenerateKey()
+	sender := models.Account(crypto.PubkeyToAddress(senderKey.PublicKey).Hex())
+	otherKey, _ := crypto.GenerateKey()
+	other := models.Account(crypto.PubkeyToAddress(otherKey.PublicKey).Hex())
+
+	// every transaction costs 11
+	newTx := func(from models.Account, nonce uint64, chainId string) models.Transaction {
+		return *models.NewTransaction(from, from, 10, 1, nonce, "", 0, chainId)
+	}
+	newTxsMap := func(txs ...models.Transaction) map[models.TransactionId]models.Transaction {
+		txsMap := make(map[models.TransactionId]models.Transaction, len(txs))
+		for _, tx := range txs {
+			txHash, _ := tx.Hash()
+			txsMap[txHash] = tx
+		}
+		return txsMap
+	}
+
+	state := testStateReader{
+		balances: map[models.Account]uint{sender: 22, other: 11},
+		nonces:   map[models.Account]uint64{sender: 1},
+	}
+
+	tests := []struct {
+		name string
+		txs  map[models.TransactionId]models.Transaction
+		want []models.Transaction
+	}{
+		{
+			name: "transactions following the nonces of their sender should be included by nonce",
+			txs:  newTxsMap(newTx(sender, 2, test.ChainId), newTx(sender, 1, test.ChainId)),
+			want: []models.Transaction{newTx(sender, 1, test.ChainId), newTx(sender, 2, test.ChainId)},
+		},
+		{
+			name: "transactions the sender can't afford anymore should be skipped",
+			txs:  newTxsMap(newTx(sender, 1, test.ChainId), newTx(sender, 2, test.ChainId), newTx(sender, 3, test.ChainId)),
+			want: []models.Transaction{newTx(sender, 1, test.ChainId), newTx(sender, 2, test.ChainId)},
+		},
+		{
+			name: "transactions with a nonce already used should be skipped without holding back the others",
+			txs:  newTxsMap(newTx(sender, 0, test.ChainId), newTx(sender, 1, test.ChainId)),
+			want: []models.Transaction{newTx(sender, 1, test.ChainId)},
+		},
+		{
+			name: "transactions following a skipped transaction of their sender should be skipped",
+			txs:  newTxsMap(newTx(sender, 1, "another-chain"), newTx(sender, 2, test.ChainId), newTx(other, 0, test.ChainId)),
+			want: []models.Transaction{newTx(other, 0, test.ChainId)},
+		},
+	}
+
+	// run tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildBlockTxs(state, tt.txs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("buildBlockTxs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				gotHash, _ := got[i].Hash()
+				wantHash, _ := tt.want[i].Hash()
+				if gotHash != wantHash {
+					t.Errorf("buildBlockTxs()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package domains
+
+import (
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+)
+
+// the blocks are rendered the same way by the blocks and the nodes domains, so a node can parse the blocks
+// served by its peers
+
+type BlockSerializer struct {
+	blockDB models.BlockDB
+}
+
+func NewBlockSerializer(blockDB models.BlockDB) *BlockSerializer {
+	return &BlockSerializer{blockDB: blockDB}
+}
+
+type BlocksSerializer struct {
+	blocksDB []models.BlockDB
+}
+
+func NewBlocksSerializer(blocksDB []models.BlockDB) *BlocksSerializer {
+	return &BlocksSerializer{blocksDB: blocksDB}
+}
+
+type BlockTransactionResponse struct {
+	Hash      models.Hash      `json:"hash"`
+	From      models.Account   `json:"from"`
+	To        models.Account   `json:"to"`
+	Value     uint             `json:"value"`
+	Fee       uint             `json:"fee"`
+	Nonce     uint64           `json:"nonce"`
+	Reason    string           `json:"reason"`
+	Time      uint64           `json:"time"`
+	ChainId   string           `json:"chain_id"`
+	Signature models.Signature `json:"signature"`
+}
+
+type BlockHeaderResponse struct {
+	Parent    models.Hash      `json:"parent"`
+	TxRoot    models.Hash      `json:"tx_root"`
+	Height    uint64           `json:"height"`
+	Bits      uint32           `json:"bits"`
+	Nonce     uint32           `json:"nonce"`
+	Time      uint64           `json:"time"`
+	Miner     models.Account   `json:"miner"`
+	Signature models.Signature `json:"signature,omitempty"`
+}
+
+type BlockResponse struct {
+	Hash   models.Hash                `json:"hash"`
+	Header BlockHeaderResponse        `json:"header"`
+	Txs    []BlockTransactionResponse `json:"transactions"`
+}
+
+type BlocksResponse struct {
+	Blocks []BlockResponse `json:"blocks"`
+}
+
+func (b *BlockSerializer) Response() BlockResponse {
+	block := b.blockDB.Block
+	response := BlockResponse{
+		Hash: b.blockDB.Hash,
+		Header: BlockHeaderResponse{
+			Parent:    block.Header.Parent,
+			TxRoot:    block.Header.TxRoot,
+			Height:    block.Header.Height,
+			Bits:      block.Header.Bits,
+			Nonce:     block.Header.Nonce,
+			Time:      block.Header.Time,
+			Miner:     block.Header.Miner,
+			Signature: block.Header.Signature,
+		},
+	}
+
+	// add block transactions
+	txRes := make([]BlockTransactionResponse, len(block.Txs))
+	for i, tx := range block.Txs {
+		txHash, _ := tx.Hash()
+		txRes[i] = BlockTransactionResponse{
+			Hash:      models.Hash(txHash),
+			From:      tx.From,
+			To:        tx.To,
+			Value:     tx.Value,
+			Fee:       tx.Fee,
+			Nonce:     tx.Nonce,
+			Reason:    tx.Reason,
+			Time:      tx.Time,
+			ChainId:   tx.ChainId,
+			Signature: tx.Signature,
+		}
+	}
+	response.Txs = txRes
+
+	return response
+}
+
+// Block returns the block as it has been sent, so its hash and its transactions root can be verified
+func (b BlockResponse) Block() models.Block {
+	txs := make([]models.Transaction, len(b.Txs))
+	for i, tx := range b.Txs {
+		txs[i] = models.Transaction{
+			From:      tx.From,
+			To:        tx.To,
+			Value:     tx.Value,
+			Fee:       tx.Fee,
+			Nonce:     tx.Nonce,
+			Reason:    tx.Reason,
+			Time:      tx.Time,
+			ChainId:   tx.ChainId,
+			Signature: tx.Signature,
+		}
+	}
+	return models.Block{
+		Header: models.BlockHeader{
+			Parent:    b.Header.Parent,
+			TxRoot:    b.Header.TxRoot,
+			Height:    b.Header.Height,
+			Bits:      b.Header.Bits,
+			Nonce:     b.Header.Nonce,
+			Time:      b.Header.Time,
+			Miner:     b.Header.Miner,
+			Signature: b.Header.Signature,
+		},
+		Txs: txs,
+	}
+}
+
+func (b *BlocksSerializer) Response() BlocksResponse {
+	response := make([]BlockResponse, len(b.blocksDB))
+	for i, blockDB := range b.blocksDB {
+		response[i] = NewBlockSerializer(blockDB).Response()
+	}
+	return BlocksResponse{response}
+}
@@ -8,7 +8,9 @@ import (
 
 const TRANSACTIONS_DOMAIN_URL = "/api/transactions"
 
-func RunDomain(r *gin.Engine, state models.State, transactionService services.TransactionService, middlewares ...gin.HandlerFunc) {
+// RunDomain the operatorMiddleware restricts the endpoints reserved to the operators of the node on top of the
+// middlewares of the domain
+func RunDomain(r *gin.Engine, state models.State, transactionService services.TransactionService, operatorMiddleware gin.HandlerFunc, middlewares ...gin.HandlerFunc) {
 	v1 := r.Group(TRANSACTIONS_DOMAIN_URL)
 	for _, middleware := range middlewares {
 		v1.Use(middleware)
@@ -17,5 +19,7 @@ func RunDomain(r *gin.Engine, state models.State, transactionService services.Tr
 	TransactionsRegister(v1.Group("/"), &TransactionsEnv{
 		state:              state,
 		transactionService: transactionService,
+
+		operatorMiddlewares: []gin.HandlerFunc{operatorMiddleware},
 	})
 }
@@ -10,24 +10,42 @@ import (
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
 	. "github.com/v4lproik/simple-blockchain-quickstart/domains"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 )
 
-const ADD_TRANSACTIONS_ENDPOINT = "/"
+const (
+	ADD_TRANSACTIONS_ENDPOINT          = "/"
+	GET_TRANSACTION_ENDPOINT           = "/:hash"
+	LIST_PENDING_TRANSACTIONS_ENDPOINT = "/pending"
+	DROP_PENDING_TRANSACTION_ENDPOINT  = "/pending/:hash"
+)
 
 type TransactionsEnv struct {
 	state              models.State
 	transactionService services.TransactionService
+
+	// middlewares restricting the endpoints reserved to the operators of the node
+	operatorMiddlewares []gin.HandlerFunc
 }
 
 func TransactionsRegister(router *gin.RouterGroup, env *TransactionsEnv) {
 	router.PUT(ADD_TRANSACTIONS_ENDPOINT, env.AddTransaction)
+	router.GET(GET_TRANSACTION_ENDPOINT, env.GetTransaction)
+	router.GET(LIST_PENDING_TRANSACTIONS_ENDPOINT, env.ListPendingTransactions)
+
+	operatorRouter := router.Group("/", env.operatorMiddlewares...)
+	operatorRouter.DELETE(DROP_PENDING_TRANSACTION_ENDPOINT, env.DropPendingTransaction)
 }
 
 type AddTransactionParams struct {
-	From   string        `json:"from" binding:"required,account"`
-	To     string        `json:"to" binding:"required,account"`
-	Value  uint          `json:"value" binding:"required,gte=1"`
-	Reason models.Reason `json:"reason" binding:"omitempty,enum"`
+	From      string        `json:"from" binding:"required,account"`
+	To        string        `json:"to" binding:"required,account"`
+	Value     uint          `json:"value"`
+	Fee       uint          `json:"fee"`
+	Nonce     uint64        `json:"nonce"`
+	Reason    models.Reason `json:"reason" binding:"omitempty,enum"`
+	Time      uint64        `json:"time" binding:"required"`
+	Signature string        `json:"signature" binding:"required,signature"`
 }
 
 func (env TransactionsEnv) AddTransaction(c *gin.Context) {
@@ -38,33 +56,165 @@ func (env TransactionsEnv) AddTransaction(c *gin.Context) {
 		return
 	}
 
+	// miners are rewarded by the protocol, nobody can mint through the api
+	if params.Reason == models.SELF_REWARD {
+		AbortWithError(c, NewError(http.StatusBadRequest, "transaction cannot be added", models.ErrTxSelfReward))
+		return
+	}
+
+	// the value and the fee are debited together, their sum must not wrap around
+	if _, err := models.AddAmounts(params.Value, params.Fee); err != nil {
+		AbortWithError(c, NewError(http.StatusBadRequest, "transaction cannot be added", err))
+		return
+	}
+
+	state := env.state
+	if len(state.Balances()) == 0 {
+		AbortWithError(c, NewError(http.StatusNotFound, "balances could not be found"))
+		return
+	}
+
 	// create a transaction
+	// the chain id is the one of this node, a transaction signed for another chain won't match its sender
 	from, _ := models.NewAccount(params.From)
 	to, _ := models.NewAccount(params.To)
 	tx := models.NewTransaction(
 		from,
 		to,
 		params.Value,
+		params.Fee,
+		params.Nonce,
 		string(params.Reason),
-		DefaultTimeService.UnixUint64(),
+		params.Time,
+		state.ChainId(),
 	)
-
-	state := env.state
-	if len(state.Balances()) == 0 {
-		AbortWithError(c, NewError(http.StatusNotFound, "balances could not be found"))
+	// verified in parameter above
+	if err := tx.Signature.UnmarshalText([]byte(params.Signature)); err != nil {
+		AbortWithError(c, NewUnknownError())
 		return
 	}
 
-	// add to state
+	// add to the pool, the transaction is checked against the state and the other pending transactions of the sender
 	err := env.transactionService.AddPendingTx(*tx)
 	if err != nil {
-		code := http.StatusInternalServerError
-		if errors.As(err, &services.ErrMarshalTx) {
-			code = http.StatusConflict
+		switch {
+		case errors.Is(err, services.ErrTxAlreadyInPool):
+			AbortWithError(c, NewError(http.StatusConflict, "transaction cannot be added", services.ErrTxAlreadyInPool))
+		case errors.Is(err, models.ErrTxNonceAlreadyUsed):
+			AbortWithError(c, NewError(http.StatusConflict, "transaction cannot be added", models.ErrTxNonceAlreadyUsed))
+		case errors.Is(err, services.ErrTxNonceAlreadyInPool):
+			AbortWithError(c, NewError(http.StatusConflict, "transaction cannot be added", services.ErrTxNonceAlreadyInPool))
+		case errors.Is(err, services.ErrTxNotSigned):
+			AbortWithError(c, NewError(http.StatusBadRequest, "transaction cannot be added", services.ErrTxNotSigned))
+		case errors.Is(err, models.ErrTxNonceTooHigh):
+			AbortWithError(c, NewError(http.StatusBadRequest, "transaction cannot be added", models.ErrTxNonceTooHigh))
+		case errors.Is(err, models.ErrInsufficientBalance):
+			AbortWithError(c, NewError(http.StatusBadRequest, "transaction cannot be added", models.ErrInsufficientBalance))
+		case errors.Is(err, models.ErrAmountOverflow):
+			AbortWithError(c, NewError(http.StatusBadRequest, "transaction cannot be added", models.ErrAmountOverflow))
+		case errors.Is(err, models.ErrTxZeroValue):
+			AbortWithError(c, NewError(http.StatusBadRequest, "transaction cannot be added", models.ErrTxZeroValue))
+		case errors.Is(err, services.ErrTxVoteNotSigner):
+			AbortWithError(c, NewError(http.StatusForbidden, "transaction cannot be added", services.ErrTxVoteNotSigner))
+		case errors.Is(err, services.ErrTxSenderLimitReached):
+			AbortWithError(c, NewError(http.StatusTooManyRequests, "transaction cannot be added", services.ErrTxSenderLimitReached))
+		case errors.Is(err, services.ErrMempoolFull):
+			AbortWithError(c, NewError(http.StatusServiceUnavailable, "transaction cannot be added", services.ErrMempoolFull))
+		default:
+			AbortWithError(c, NewError(http.StatusInternalServerError, "transaction cannot be added"))
 		}
-		AbortWithError(c, NewError(code, "transaction cannot be added"))
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{})
+	// render, the hash is needed to follow the transaction
+	txHash, err := tx.Hash()
+	if err != nil {
+		AbortWithError(c, NewUnknownError())
+		return
+	}
+	serializer := TransactionSerializer{
+		hash:        models.Hash(txHash),
+		transaction: *tx,
+	}
+	c.JSON(http.StatusCreated, serializer.Response())
+}
+
+type TransactionHashParams struct {
+	Hash string `uri:"hash" binding:"required,hash"`
+}
+
+// GetTransaction Get the status of a transaction: pending in the pool, included in a block or dropped from the pool
+func (env TransactionsEnv) GetTransaction(c *gin.Context) {
+	params := &TransactionHashParams{}
+	// check params
+	if err := ShouldBindUri(c, "transaction cannot be retrieved", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// verified in parameter above
+	hash := models.Hash{}
+	if err := hash.UnmarshalText([]byte(params.Hash)); err != nil {
+		AbortWithError(c, NewUnknownError())
+		return
+	}
+	txHash := models.TransactionId(hash)
+
+	serializer := TransactionStatusSerializer{hash: hash}
+	if _, ok := env.transactionService.GetPendingTx(txHash); ok {
+		serializer.status = TX_STATUS_PENDING
+	} else if blockDB, ok := env.state.GetBlockByTxHash(txHash); ok {
+		serializer.status = TX_STATUS_INCLUDED
+		serializer.blockDB = blockDB
+		serializer.confirmations = env.state.GetLatestBlockHeight() - blockDB.Block.Header.Height + 1
+	} else if reason, ok := env.transactionService.GetDroppedTxReason(txHash); ok {
+		serializer.status = TX_STATUS_DROPPED
+		serializer.reason = reason
+	} else if reason, ok := env.transactionService.GetRejectedTxReason(txHash); ok {
+		serializer.status = TX_STATUS_REJECTED
+		serializer.reason = reason
+	} else {
+		AbortWithError(c, NewError(http.StatusNotFound, "transaction cannot be found"))
+		return
+	}
+
+	// render
+	c.JSON(http.StatusOK, serializer.Response())
+}
+
+// ListPendingTransactions Get the transactions waiting in the pool and what each sender has pending
+func (env TransactionsEnv) ListPendingTransactions(c *gin.Context) {
+	// render
+	serializer := PendingTransactionsSerializer{
+		pendingTxs: env.transactionService.ListPendingTxs(),
+		now:        DefaultTimeService.UnixUint64(),
+	}
+	c.JSON(http.StatusOK, serializer.Response())
+}
+
+// DropPendingTransaction Remove a stuck transaction from the pool
+func (env TransactionsEnv) DropPendingTransaction(c *gin.Context) {
+	params := &TransactionHashParams{}
+	// check params
+	if err := ShouldBindUri(c, "transaction cannot be dropped", params); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// verified in parameter above
+	hash := models.Hash{}
+	if err := hash.UnmarshalText([]byte(params.Hash)); err != nil {
+		AbortWithError(c, NewUnknownError())
+		return
+	}
+	txHash := models.TransactionId(hash)
+
+	if _, ok := env.transactionService.GetPendingTx(txHash); !ok {
+		AbortWithError(c, NewError(http.StatusNotFound, "transaction cannot be found in the pool"))
+		return
+	}
+	Logger.Infof("DropPendingTransaction: transaction %s dropped from the pool", hash.Hex())
+	env.transactionService.DropPendingTx(txHash, services.ErrTxDroppedByOperator)
+
+	c.JSON(http.StatusOK, gin.H{})
 }
@@ -0,0 +1,266 @@
+package transactions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/middleware"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+const operatorToken = "operator-token"
+
+var (
+	state, _              = models.NewStateFromFile(test.GenesisFilePath, test.BlocksFilePath, models.DefaultEngine())
+	transactionService, _ = services.NewFileTransactionService(fundedState{state}, services.DefaultMempoolConf())
+
+	includedBlock, _  = state.GetBlockByHeight(2)
+	includedTxHash, _ = includedBlock.Block.Txs[0].Hash()
+	pendingTxHash     = addTestTx(0)
+	droppedTxHash     = addTestTx(1)
+	rejectedTxHash    = addTestTx(5)
+	stuckTxHash       = addTestTx(0)
+)
+
+var GetTransactionDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for transaction status endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            TRANSACTIONS_DOMAIN_URL + "/" + models.Hash(includedTxHash).Hex(),
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"transaction_status":{"hash":"` + models.Hash(includedTxHash).Hex() + `","status":"included","block_hash":"` + includedBlock.Hash.Hex() + `","block_height":2,"confirmations":3}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request status of a transaction included in a block should return the block and its confirmations",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            TRANSACTIONS_DOMAIN_URL + "/" + models.Hash(pendingTxHash).Hex(),
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"transaction_status":{"hash":"` + models.Hash(pendingTxHash).Hex() + `","status":"pending"}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request status of a transaction in the pool should return pending",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init: func(req *http.Request) {
+			transactionService.DropPendingTx(droppedTxHash, models.ErrTxNonceAlreadyUsed)
+		},
+		url:            TRANSACTIONS_DOMAIN_URL + "/" + models.Hash(droppedTxHash).Hex(),
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"transaction_status":{"hash":"` + models.Hash(droppedTxHash).Hex() + `","status":"dropped","reason":"` + models.ErrTxNonceAlreadyUsed.Error() + `"}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request status of a transaction dropped from the pool should return the reason",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            TRANSACTIONS_DOMAIN_URL + "/" + models.Hash(rejectedTxHash).Hex(),
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"transaction_status":{"hash":"` + models.Hash(rejectedTxHash).Hex() + `","status":"rejected","reason":"` + models.ErrTxNonceTooHigh.Error() + `"}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request status of a transaction refused by the pool should return the reason",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            TRANSACTIONS_DOMAIN_URL + "/" + models.Hash{}.Hex(),
+		method:         "GET",
+		expectedCode:   http.StatusNotFound,
+		jsonResponse:   `{"error":{"code":404,"status":"Not Found","message":"transaction cannot be found","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request status of an unknown transaction should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            TRANSACTIONS_DOMAIN_URL + "/nothash",
+		method:         "GET",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"transaction cannot be retrieved","context":[[{"field":"Hash","message":"The hash should be a 32 byte array"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request status with an invalid hash should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+var PendingTransactionsDomainTests = []struct {
+	init           func(*http.Request)
+	url            string
+	method         string
+	expectedCode   int
+	jsonResponse   string
+	validationFunc func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions)
+	msg            string
+	after          func(*http.Request)
+}{
+	//---------------------   Test suit for pending transactions endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            TRANSACTIONS_DOMAIN_URL + "/pending",
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"pending":{"transactions":\[.*{"hash":"` + models.Hash(stuckTxHash).Hex() + `","from":"0x[0-9a-fA-F]{40}",[^}]*"value":10,"fee":1,[^}]*"added_at":[0-9]+,"age_in_seconds":[0-9]+}.*\],"accounts":\[.*{"account":"0x[0-9a-fA-F]{40}","transactions":1,"value":10,"fee":1}.*\]}}`,
+		validationFunc: test.RegexpHttpValidationFunc,
+		msg:            "request pending transactions should return the transactions of the pool and the totals of each sender",
+		after:          func(req *http.Request) {},
+	},
+	//---------------------   Test suit for drop pending transaction endpoint   ---------------------
+	{
+		init:           func(req *http.Request) {},
+		url:            TRANSACTIONS_DOMAIN_URL + "/pending/" + models.Hash(stuckTxHash).Hex(),
+		method:         "DELETE",
+		expectedCode:   http.StatusForbidden,
+		jsonResponse:   `{"error":{"code":403,"status":"Forbidden","message":"operator token is not valid","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "drop a pending transaction without operator token should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init: func(req *http.Request) {
+			req.Header.Set(middleware.OPERATOR_HEADER, "not the operator token")
+		},
+		url:            TRANSACTIONS_DOMAIN_URL + "/pending/" + models.Hash(stuckTxHash).Hex(),
+		method:         "DELETE",
+		expectedCode:   http.StatusForbidden,
+		jsonResponse:   `{"error":{"code":403,"status":"Forbidden","message":"operator token is not valid","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "drop a pending transaction with another token than the operator one should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           setOperatorToken,
+		url:            TRANSACTIONS_DOMAIN_URL + "/pending/" + models.Hash(stuckTxHash).Hex(),
+		method:         "DELETE",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "drop a pending transaction should remove it from the pool",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           func(req *http.Request) {},
+		url:            TRANSACTIONS_DOMAIN_URL + "/" + models.Hash(stuckTxHash).Hex(),
+		method:         "GET",
+		expectedCode:   http.StatusOK,
+		jsonResponse:   `{"transaction_status":{"hash":"` + models.Hash(stuckTxHash).Hex() + `","status":"dropped","reason":"` + services.ErrTxDroppedByOperator.Error() + `"}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "request status of a transaction dropped by an operator should return the reason",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           setOperatorToken,
+		url:            TRANSACTIONS_DOMAIN_URL + "/pending/" + models.Hash(stuckTxHash).Hex(),
+		method:         "DELETE",
+		expectedCode:   http.StatusNotFound,
+		jsonResponse:   `{"error":{"code":404,"status":"Not Found","message":"transaction cannot be found in the pool","context":[]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "drop a transaction which is not in the pool should return error",
+		after:          func(req *http.Request) {},
+	},
+	{
+		init:           setOperatorToken,
+		url:            TRANSACTIONS_DOMAIN_URL + "/pending/nothash",
+		method:         "DELETE",
+		expectedCode:   http.StatusBadRequest,
+		jsonResponse:   `{"error":{"code":400,"status":"Bad Request","message":"transaction cannot be dropped","context":[[{"field":"Hash","message":"The hash should be a 32 byte array"}]]}}`,
+		validationFunc: test.StandardHttpValidationFunc,
+		msg:            "drop a transaction with an invalid hash should return error",
+		after:          func(req *http.Request) {},
+	},
+}
+
+func TestTransactionsEnv_GetTransaction(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	r := gin.New()
+	initServer(r)
+
+	for _, testData := range GetTransactionDomainTests {
+		req, err := http.NewRequest(testData.method, testData.url, nil)
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+}
+
+func TestTransactionsEnv_PendingTransactions(t *testing.T) {
+	test.InitTestContext()
+	asserts := assert.New(t)
+
+	r := gin.New()
+	initServer(r)
+
+	for _, testData := range PendingTransactionsDomainTests {
+		req, err := http.NewRequest(testData.method, testData.url, nil)
+		req.Header.Set("Content-Type", "application/json")
+		asserts.NoError(err)
+
+		testData.init(req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		testData.after(req)
+
+		testData.validationFunc(testData.expectedCode, w.Code, testData.msg, testData.jsonResponse, w.Body.String(), asserts)
+	}
+}
+
+func initServer(r *gin.Engine) {
+	services.ValidatorService{}.AddValidators()
+	RunDomain(r, state, transactionService, middleware.OperatorMiddleware(operatorToken))
+}
+
+func setOperatorToken(req *http.Request) {
+	req.Header.Set(middleware.OPERATOR_HEADER, operatorToken)
+}
+
+// fundedState state where every account can afford the test transactions
+type fundedState struct {
+	*models.FromFileState
+}
+
+func (s fundedState) GetBalance(account models.Account) uint {
+	return 1000
+}
+
+// addTestTx adds a transaction signed by a random account to the pool
+func addTestTx(nonce uint64) models.TransactionId {
+	key, _ := crypto.GenerateKey()
+	sender := models.Account(crypto.PubkeyToAddress(key.PublicKey).Hex())
+	tx := models.NewTransaction(sender, sender, 10, 1, nonce, "", utils.DefaultTimeService.UnixUint64(), test.ChainId)
+	_ = tx.Sign(key)
+	_ = transactionService.AddPendingTx(*tx)
+	txHash, _ := tx.Hash()
+	return txHash
+}
@@ -1,7 +1,10 @@
 package transactions
 
 import (
+	"sort"
+
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
 )
 
 type TransactionSerializer struct {
@@ -36,3 +39,119 @@ func (t TransactionSerializer) Response() TransactionResponse {
 		},
 	}
 }
+
+const (
+	TX_STATUS_PENDING  = "pending"
+	TX_STATUS_INCLUDED = "included"
+	TX_STATUS_DROPPED  = "dropped"
+	TX_STATUS_REJECTED = "rejected"
+)
+
+type TransactionStatusSerializer struct {
+	hash          models.Hash
+	status        string
+	blockDB       models.BlockDB
+	confirmations uint64
+	reason        string
+}
+
+type TransactionStatusResponse struct {
+	Status struct {
+		Hash          models.Hash  `json:"hash"`
+		Status        string       `json:"status"`
+		BlockHash     *models.Hash `json:"block_hash,omitempty"`
+		BlockHeight   uint64       `json:"block_height,omitempty"`
+		Confirmations uint64       `json:"confirmations,omitempty"`
+		Reason        string       `json:"reason,omitempty"`
+	} `json:"transaction_status"`
+}
+
+func (t TransactionStatusSerializer) Response() TransactionStatusResponse {
+	response := TransactionStatusResponse{}
+	response.Status.Hash = t.hash
+	response.Status.Status = t.status
+	response.Status.Reason = t.reason
+	if t.status == TX_STATUS_INCLUDED {
+		response.Status.BlockHash = &t.blockDB.Hash
+		response.Status.BlockHeight = t.blockDB.Block.Header.Height
+		response.Status.Confirmations = t.confirmations
+	}
+	return response
+}
+
+type PendingTransactionsSerializer struct {
+	pendingTxs []services.PendingTx
+	now        uint64
+}
+
+type PendingTransactionResponse struct {
+	Hash         models.Hash    `json:"hash"`
+	From         models.Account `json:"from"`
+	To           models.Account `json:"to"`
+	Value        uint           `json:"value"`
+	Fee          uint           `json:"fee"`
+	Nonce        uint64         `json:"nonce"`
+	Reason       string         `json:"reason"`
+	Time         uint64         `json:"time"`
+	AddedAt      uint64         `json:"added_at"`
+	AgeInSeconds uint64         `json:"age_in_seconds"`
+}
+
+type PendingAccountResponse struct {
+	Account      models.Account `json:"account"`
+	Transactions uint           `json:"transactions"`
+	Value        uint           `json:"value"`
+	Fee          uint           `json:"fee"`
+}
+
+type PendingTransactionsResponse struct {
+	Pending struct {
+		Transactions []PendingTransactionResponse `json:"transactions"`
+		Accounts     []PendingAccountResponse     `json:"accounts"`
+	} `json:"pending"`
+}
+
+func (p PendingTransactionsSerializer) Response() PendingTransactionsResponse {
+	response := PendingTransactionsResponse{}
+	response.Pending.Transactions = make([]PendingTransactionResponse, len(p.pendingTxs))
+
+	// totals of each sender
+	accounts := make(map[models.Account]*PendingAccountResponse)
+	for i, pendingTx := range p.pendingTxs {
+		tx := pendingTx.Tx
+		var age uint64
+		if p.now > pendingTx.AddedAt {
+			age = p.now - pendingTx.AddedAt
+		}
+		response.Pending.Transactions[i] = PendingTransactionResponse{
+			Hash:         models.Hash(pendingTx.Hash),
+			From:         tx.From,
+			To:           tx.To,
+			Value:        tx.Value,
+			Fee:          tx.Fee,
+			Nonce:        tx.Nonce,
+			Reason:       tx.Reason,
+			Time:         tx.Time,
+			AddedAt:      pendingTx.AddedAt,
+			AgeInSeconds: age,
+		}
+
+		account, ok := accounts[tx.From]
+		if !ok {
+			account = &PendingAccountResponse{Account: tx.From}
+			accounts[tx.From] = account
+		}
+		account.Transactions++
+		account.Value += tx.Value
+		account.Fee += tx.Fee
+	}
+
+	response.Pending.Accounts = make([]PendingAccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		response.Pending.Accounts = append(response.Pending.Accounts, *account)
+	}
+	sort.Slice(response.Pending.Accounts, func(i, j int) bool {
+		return response.Pending.Accounts[i].Account < response.Pending.Accounts[j].Account
+	})
+	return response
+}
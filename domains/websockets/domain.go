@@ -0,0 +1,26 @@
+package websockets
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+)
+
+const WEBSOCKETS_DOMAIN_URL = "/api/ws"
+
+// RunDomain the browsers can only connect from this node or from the allowed origins
+func RunDomain(r *gin.Engine, state models.State, transactionService services.TransactionService, allowedOrigins []string, middlewares ...gin.HandlerFunc) {
+	v1 := r.Group(WEBSOCKETS_DOMAIN_URL)
+	for _, middleware := range middlewares {
+		v1.Use(middleware)
+	}
+
+	// dispatch the events of the node to the clients
+	hub := NewHub()
+	ctx := context.Background()
+	go hub.Run(ctx, state.SubscribeNewHeads(), transactionService.SubscribePendingTxs())
+
+	WebsocketsRegister(v1, NewWebsocketsEnv(hub, allowedOrigins))
+}
@@ -0,0 +1,215 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+const (
+	TOPIC_NEW_HEADS    = "new_heads"
+	TOPIC_PENDING_TXS  = "pending_transactions"
+	TOPIC_BALANCES     = "balances"
+	SUBSCRIBE_ACTION   = "subscribe"
+	UNSUBSCRIBE_ACTION = "unsubscribe"
+
+	// MaxClientPendingMessages number of messages a client can lag behind before being disconnected
+	MaxClientPendingMessages = 100
+	// MaxClientAccounts number of accounts a client can watch the balance of
+	MaxClientAccounts = 100
+)
+
+var ErrTooManyAccounts = errors.New("too many accounts watched by the client")
+
+// Hub dispatches the events of the node to the clients subscribed to them
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*Client]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{clients: make(map[*Client]struct{})}
+}
+
+// Client websocket connection and the topics it has subscribed to
+type Client struct {
+	// messages waiting to be written to the connection, closed once the client is unregistered
+	send chan []byte
+
+	mu       sync.Mutex
+	topics   map[string]struct{}
+	accounts map[models.Account]struct{}
+}
+
+// Register adds a client which hasn't subscribed to any topic yet
+func (h *Hub) Register() *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client := &Client{
+		send:     make(chan []byte, MaxClientPendingMessages),
+		topics:   make(map[string]struct{}),
+		accounts: make(map[models.Account]struct{}),
+	}
+	h.clients[client] = struct{}{}
+	return client
+}
+
+// Unregister removes the client, its connection is closed once its pending messages are written
+func (h *Hub) Unregister(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.unregister(client)
+}
+
+func (h *Hub) unregister(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// Run dispatches the new heads of the main chain and the transactions added to the pool until ctx is done
+func (h *Hub) Run(ctx context.Context, newHeads <-chan models.NewHeadEvent, pendingTxs <-chan models.Transaction) {
+	for {
+		select {
+		case event := <-newHeads:
+			h.broadcast(TOPIC_NEW_HEADS, (&NewHeadSerializer{blockDB: event.Block}).Response())
+			h.dispatchBalances(event)
+		case tx := <-pendingTxs:
+			h.broadcast(TOPIC_PENDING_TXS, (&PendingTxSerializer{tx: tx}).Response())
+		case <-ctx.Done():
+			Logger.Debugf("Run: stop dispatching events to websocket clients")
+			return
+		}
+	}
+}
+
+// broadcast sends the event to the clients subscribed to the topic
+func (h *Hub) broadcast(topic string, data interface{}) {
+	message, err := json.Marshal(EventResponse{Topic: topic, Data: data})
+	if err != nil {
+		Logger.Errorf("broadcast: failed to marshal %s event: %s", topic, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		if client.isSubscribed(topic) {
+			h.trySend(client, message)
+		}
+	}
+}
+
+// dispatchBalances sends to each client the changed balances of the accounts it watches
+func (h *Hub) dispatchBalances(event models.NewHeadEvent) {
+	if len(event.Balances) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		balances := client.watchedBalances(event.Balances)
+		if len(balances) == 0 {
+			continue
+		}
+		serializer := &BalancesSerializer{blockDB: event.Block, balances: balances}
+		message, err := json.Marshal(EventResponse{Topic: TOPIC_BALANCES, Data: serializer.Response()})
+		if err != nil {
+			Logger.Errorf("dispatchBalances: failed to marshal balances event: %s", err)
+			return
+		}
+		h.trySend(client, message)
+	}
+}
+
+// reply queues the response to a request of the client, returns false if the client has been disconnected
+func (h *Hub) reply(client *Client, message []byte) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		return false
+	}
+	h.trySend(client, message)
+	_, ok := h.clients[client]
+	return ok
+}
+
+// trySend queues the message, a client too slow to read its messages is disconnected so it can't hold the node back
+func (h *Hub) trySend(client *Client, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		Logger.Warnf("trySend: websocket client is too slow, disconnecting it")
+		h.unregister(client)
+	}
+}
+
+// Subscribe adds the topic to the client, the accounts are added to the watched accounts of the balances topic
+func (c *Client) Subscribe(topic string, accounts []models.Account) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if topic == TOPIC_BALANCES {
+		watched := make(map[models.Account]struct{}, len(c.accounts)+len(accounts))
+		for account := range c.accounts {
+			watched[account] = struct{}{}
+		}
+		for _, account := range accounts {
+			watched[account] = struct{}{}
+		}
+		if len(watched) > MaxClientAccounts {
+			return ErrTooManyAccounts
+		}
+		c.accounts = watched
+	}
+	c.topics[topic] = struct{}{}
+	return nil
+}
+
+// Unsubscribe removes the topic from the client, unsubscribing from balances forgets every watched account
+func (c *Client) Unsubscribe(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if topic == TOPIC_BALANCES {
+		c.accounts = make(map[models.Account]struct{})
+	}
+	delete(c.topics, topic)
+}
+
+func (c *Client) isSubscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.topics[topic]
+	return ok
+}
+
+// watchedBalances returns the balances of the accounts watched by the client
+func (c *Client) watchedBalances(balances map[models.Account]uint) map[models.Account]uint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.topics[TOPIC_BALANCES]; !ok {
+		return nil
+	}
+	watchedBalances := make(map[models.Account]uint)
+	for account := range c.accounts {
+		if balance, ok := balances[account]; ok {
+			watchedBalances[account] = balance
+		}
+	}
+	return watchedBalances
+}
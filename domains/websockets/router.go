@@ -0,0 +1,180 @@
+package websockets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/v4lproik/simple-blockchain-quickstart/common/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/middleware"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	. "github.com/v4lproik/simple-blockchain-quickstart/domains"
+	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
+)
+
+const (
+	// MaxMessageSizeInBytes size of the largest subscription a client can send
+	MaxMessageSizeInBytes = 8 * 1024
+	// WRITE_TIMEOUT_IN_SECONDS time given to a client to receive a message
+	WRITE_TIMEOUT_IN_SECONDS = 10
+	// PONG_TIMEOUT_IN_SECONDS time after which a client which hasn't answered the pings is disconnected
+	PONG_TIMEOUT_IN_SECONDS = 60
+	// PING_INTERVAL_IN_SECONDS must be shorter than the pong timeout
+	PING_INTERVAL_IN_SECONDS = 50
+)
+
+type WebsocketsEnv struct {
+	hub      *Hub
+	upgrader websocket.Upgrader
+}
+
+func NewWebsocketsEnv(hub *Hub, allowedOrigins []string) *WebsocketsEnv {
+	return &WebsocketsEnv{
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			// the subprotocol carrying the token is selected so the browsers accept the connection
+			Subprotocols: []string{middleware.AUTH_WEBSOCKET_PROTOCOL},
+			CheckOrigin:  checkOrigin(allowedOrigins),
+		},
+	}
+}
+
+// checkOrigin accepts the clients which aren't browsers, the pages served by this node and the ones served
+// from the allowed origins
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if originUrl, err := url.Parse(origin); err == nil && strings.EqualFold(originUrl.Host, r.Host) {
+			return true
+		}
+		for _, allowedOrigin := range allowedOrigins {
+			if strings.EqualFold(origin, allowedOrigin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func WebsocketsRegister(router *gin.RouterGroup, env *WebsocketsEnv) {
+	router.GET("", env.Subscribe)
+}
+
+type SubscriptionParams struct {
+	Action   string   `json:"action" binding:"required,oneof=subscribe unsubscribe"`
+	Topic    string   `json:"topic" binding:"required,oneof=new_heads pending_transactions balances"`
+	Accounts []string `json:"accounts" binding:"omitempty,max=100,dive,account"`
+}
+
+// Subscribe Upgrade the connection to a websocket on which the client subscribes to the events of the node
+// eg. {"action":"subscribe","topic":"balances","accounts":["0x..."]}
+func (env WebsocketsEnv) Subscribe(c *gin.Context) {
+	conn, err := env.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already answered the client
+		Logger.Debugf("Subscribe: failed to upgrade connection: %s", err)
+		return
+	}
+
+	client := env.hub.Register()
+	go writeMessages(conn, client)
+	env.readMessages(conn, client)
+}
+
+// readMessages handles the subscriptions of the client until it disconnects
+func (env WebsocketsEnv) readMessages(conn *websocket.Conn, client *Client) {
+	defer env.hub.Unregister(client)
+
+	conn.SetReadLimit(MaxMessageSizeInBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(PONG_TIMEOUT_IN_SECONDS * time.Second))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(PONG_TIMEOUT_IN_SECONDS * time.Second))
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				Logger.Debugf("readMessages: websocket closed: %s", err)
+			}
+			return
+		}
+
+		response, err := json.Marshal(env.handleSubscription(client, message))
+		if err != nil {
+			Logger.Errorf("readMessages: failed to marshal response: %s", err)
+			return
+		}
+		if !env.hub.reply(client, response) {
+			return
+		}
+	}
+}
+
+// handleSubscription applies the subscription sent by the client and returns the response to send back
+func (env WebsocketsEnv) handleSubscription(client *Client, message []byte) interface{} {
+	params := &SubscriptionParams{}
+	// check params
+	if err := ShouldBindMessage(message, "subscription cannot be processed", params); err != nil {
+		return err
+	}
+	if params.Action == SUBSCRIBE_ACTION && params.Topic == TOPIC_BALANCES && len(params.Accounts) == 0 {
+		return NewError(http.StatusBadRequest, "subscription cannot be processed", "accounts are required to watch balances")
+	}
+
+	// verified in parameter above
+	accounts := make([]models.Account, len(params.Accounts))
+	for i, account := range params.Accounts {
+		accounts[i], _ = models.NewAccount(account)
+	}
+
+	switch params.Action {
+	case SUBSCRIBE_ACTION:
+		if err := client.Subscribe(params.Topic, accounts); err != nil {
+			return NewError(http.StatusBadRequest, "subscription cannot be processed", err)
+		}
+	case UNSUBSCRIBE_ACTION:
+		client.Unsubscribe(params.Topic)
+	}
+
+	// render
+	serializer := &SubscriptionSerializer{action: params.Action, topic: params.Topic, accounts: accounts}
+	return gin.H{"subscription": serializer.Response()}
+}
+
+// writeMessages writes the messages queued for the client and pings it, the connection is closed once
+// the client is unregistered
+func writeMessages(conn *websocket.Conn, client *Client) {
+	ticker := time.NewTicker(PING_INTERVAL_IN_SECONDS * time.Second)
+	defer func() {
+		ticker.Stop()
+		_ = conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-client.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT_IN_SECONDS * time.Second))
+			if !ok {
+				_ = conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT_IN_SECONDS * time.Second))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
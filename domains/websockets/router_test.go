@@ -0,0 +1,240 @@
+package websockets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/middleware"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	"github.com/v4lproik/simple-blockchain-quickstart/test"
+)
+
+const (
+	account1 = "0x7b65a12633dbe9a413b17db515732d69e684ebe2"
+	account2 = "0xa6aa1c9106f0c0d0895bb72f40cfc830180ebeaf"
+
+	allowedOrigin = "http://wallet.example.com"
+)
+
+var SubscriptionDomainTests = []struct {
+	message      string
+	jsonResponse string
+	msg          string
+}{
+	{
+		message:      `not a json message`,
+		jsonResponse: `{"error":{"code":400,"status":"Bad Request","message":"subscription cannot be processed","context":\[.*\]}}`,
+		msg:          "a message which isn't json should be refused",
+	},
+	{
+		message:      `{"action":"subscribe","topic":"unknown"}`,
+		jsonResponse: `{"error":{"code":400,"status":"Bad Request","message":"subscription cannot be processed","context":\[\[{"field":"Topic","message":"Should be one of new_heads pending_transactions balances"}\]\]}}`,
+		msg:          "an unknown topic should be refused",
+	},
+	{
+		message:      `{"action":"subscribe","topic":"balances","accounts":["0x1"]}`,
+		jsonResponse: `{"error":{"code":400,"status":"Bad Request","message":"subscription cannot be processed","context":\[\[{"field":"Accounts\[0\]","message":"The account is not an Ethereum style account.*"}\]\]}}`,
+		msg:          "an invalid account should be refused",
+	},
+	{
+		message:      `{"action":"subscribe","topic":"balances"}`,
+		jsonResponse: `{"error":{"code":400,"status":"Bad Request","message":"subscription cannot be processed","context":\["accounts are required to watch balances"\]}}`,
+		msg:          "watching balances without accounts should be refused",
+	},
+	{
+		message:      `{"action":"subscribe","topic":"new_heads"}`,
+		jsonResponse: `{"subscription":{"action":"subscribe","topic":"new_heads"}}`,
+		msg:          "subscribing to the new heads should be acknowledged",
+	},
+	{
+		message:      `{"action":"unsubscribe","topic":"pending_transactions"}`,
+		jsonResponse: `{"subscription":{"action":"unsubscribe","topic":"pending_transactions"}}`,
+		msg:          "unsubscribing should be acknowledged",
+	},
+}
+
+func TestSubscription(t *testing.T) {
+	asserts := assert.New(t)
+	server, _, _ := newTestServer(t)
+	conn := dial(t, server)
+
+	for _, tt := range SubscriptionDomainTests {
+		asserts.Regexp("^"+tt.jsonResponse+"$", request(t, conn, tt.message), tt.msg)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	asserts := assert.New(t)
+	server, newHeads, pendingTxs := newTestServer(t)
+
+	headsConn := dial(t, server)
+	request(t, headsConn, `{"action":"subscribe","topic":"new_heads"}`)
+	balancesConn := dial(t, server)
+	request(t, balancesConn, `{"action":"subscribe","topic":"balances","accounts":["`+account1+`"]}`)
+	txsConn := dial(t, server)
+	request(t, txsConn, `{"action":"subscribe","topic":"pending_transactions"}`)
+
+	block := models.NewBlock(models.Hash{}, 1, 0, 0, 1, models.Account(account1), []models.Transaction{})
+	hash, _ := block.Hash()
+	// the state keeps the balances by checksummed account
+	balanceAccount1, _ := models.NewAccount(account1)
+	balanceAccount2, _ := models.NewAccount(account2)
+	newHeads <- models.NewHeadEvent{
+		Block: models.BlockDB{Hash: hash, Block: block},
+		Balances: map[models.Account]uint{
+			balanceAccount1: 1000050,
+			balanceAccount2: 999000,
+		},
+	}
+
+	t.Run("the new head should be sent to its subscribers", func(t *testing.T) {
+		asserts.Regexp(`^{"topic":"new_heads","data":{"hash":"`+hash.Hex()+`","parent":".*","height":1,"time":1,"miner":"`+account1+`","transactions":\[\]}}$`, read(t, headsConn))
+	})
+
+	t.Run("only the watched balances should be sent", func(t *testing.T) {
+		asserts.Equal(`{"topic":"balances","data":{"block_hash":"`+hash.Hex()+`","block_height":1,"balances":[{"account":"`+string(balanceAccount1)+`","balance":1000050}]}}`, read(t, balancesConn))
+	})
+
+	pendingTxs <- *models.NewTransaction(models.Account(account1), models.Account(account2), 10, 1, 1, "loan", 1, test.ChainId)
+
+	t.Run("the pending transaction should be sent to its subscribers only", func(t *testing.T) {
+		asserts.Regexp(`^{"topic":"pending_transactions","data":{"hash":".*","from":"`+account1+`","to":"`+account2+`","value":10,"fee":1,"nonce":1,"reason":"loan",.*}}$`, read(t, txsConn))
+		asserts.Equal("", tryRead(t, headsConn), "the new heads subscriber shouldn't receive the transaction")
+	})
+
+	t.Run("an unsubscribed client should not receive events anymore", func(t *testing.T) {
+		request(t, txsConn, `{"action":"unsubscribe","topic":"pending_transactions"}`)
+		pendingTxs <- *models.NewTransaction(models.Account(account2), models.Account(account1), 10, 1, 1, "birthday", 1, test.ChainId)
+		asserts.Equal("", tryRead(t, txsConn))
+	})
+}
+
+func TestOrigin(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + WEBSOCKETS_DOMAIN_URL
+
+	tests := []struct {
+		name         string
+		origin       string
+		expectedCode int
+	}{
+		{
+			name:         "a client which isn't a browser should be accepted",
+			origin:       "",
+			expectedCode: http.StatusSwitchingProtocols,
+		},
+		{
+			name:         "a page served by the node should be accepted",
+			origin:       server.URL,
+			expectedCode: http.StatusSwitchingProtocols,
+		},
+		{
+			name:         "a page served from an allowed origin should be accepted",
+			origin:       allowedOrigin,
+			expectedCode: http.StatusSwitchingProtocols,
+		},
+		{
+			name:         "a page served from another origin should be refused",
+			origin:       "http://evil.example.com",
+			expectedCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if conn != nil {
+				_ = conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("Dial() status = %d, want %d", resp.StatusCode, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestTokenSubprotocol(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + WEBSOCKETS_DOMAIN_URL
+
+	// a browser refuses the connection if the server doesn't select one of the subprotocols
+	dialer := websocket.Dialer{Subprotocols: []string{middleware.AUTH_WEBSOCKET_PROTOCOL, "a.jwt.token"}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != middleware.AUTH_WEBSOCKET_PROTOCOL {
+		t.Errorf("Subprotocol() = %q, want %q", conn.Subprotocol(), middleware.AUTH_WEBSOCKET_PROTOCOL)
+	}
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, chan models.NewHeadEvent, chan models.Transaction) {
+	test.InitTestContext()
+	services.ValidatorService{}.AddValidators()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	newHeads := make(chan models.NewHeadEvent)
+	pendingTxs := make(chan models.Transaction)
+	hub := NewHub()
+	go hub.Run(ctx, newHeads, pendingTxs)
+
+	r := gin.New()
+	WebsocketsRegister(r.Group(WEBSOCKETS_DOMAIN_URL), NewWebsocketsEnv(hub, []string{allowedOrigin}))
+	server := httptest.NewServer(r)
+	t.Cleanup(func() {
+		server.Close()
+		cancel()
+	})
+	return server, newHeads, pendingTxs
+}
+
+func dial(t *testing.T, server *httptest.Server) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + WEBSOCKETS_DOMAIN_URL
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func request(t *testing.T, conn *websocket.Conn, message string) string {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatalf("WriteMessage() error = %v", err)
+	}
+	return read(t, conn)
+}
+
+func read(t *testing.T, conn *websocket.Conn) string {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	return string(message)
+}
+
+// tryRead returns the message received within a short delay, if any
+func tryRead(t *testing.T, conn *websocket.Conn) string {
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		return ""
+	}
+	return string(message)
+}
@@ -0,0 +1,132 @@
+package websockets
+
+import (
+	"sort"
+
+	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
+)
+
+// EventResponse message sent to the clients subscribed to the topic
+type EventResponse struct {
+	Topic string      `json:"topic"`
+	Data  interface{} `json:"data"`
+}
+
+// subscriptions
+type SubscriptionSerializer struct {
+	action   string
+	topic    string
+	accounts []models.Account
+}
+
+type SubscriptionResponse struct {
+	Action   string           `json:"action"`
+	Topic    string           `json:"topic"`
+	Accounts []models.Account `json:"accounts,omitempty"`
+}
+
+func (s *SubscriptionSerializer) Response() SubscriptionResponse {
+	return SubscriptionResponse{
+		Action:   s.action,
+		Topic:    s.topic,
+		Accounts: s.accounts,
+	}
+}
+
+// new heads
+type NewHeadSerializer struct {
+	blockDB models.BlockDB
+}
+
+type NewHeadResponse struct {
+	Hash   models.Hash    `json:"hash"`
+	Parent models.Hash    `json:"parent"`
+	Height uint64         `json:"height"`
+	Time   uint64         `json:"time"`
+	Miner  models.Account `json:"miner"`
+	Txs    []models.Hash  `json:"transactions"`
+}
+
+func (n *NewHeadSerializer) Response() NewHeadResponse {
+	block := n.blockDB.Block
+	txs := make([]models.Hash, len(block.Txs))
+	for i, tx := range block.Txs {
+		txHash, _ := tx.Hash()
+		txs[i] = models.Hash(txHash)
+	}
+
+	return NewHeadResponse{
+		Hash:   n.blockDB.Hash,
+		Parent: block.Header.Parent,
+		Height: block.Header.Height,
+		Time:   block.Header.Time,
+		Miner:  block.Header.Miner,
+		Txs:    txs,
+	}
+}
+
+// pending transactions
+type PendingTxSerializer struct {
+	tx models.Transaction
+}
+
+type PendingTxResponse struct {
+	Hash    models.Hash    `json:"hash"`
+	From    models.Account `json:"from"`
+	To      models.Account `json:"to"`
+	Value   uint           `json:"value"`
+	Fee     uint           `json:"fee"`
+	Nonce   uint64         `json:"nonce"`
+	Reason  string         `json:"reason"`
+	Time    uint64         `json:"time"`
+	ChainId string         `json:"chain_id"`
+}
+
+func (p *PendingTxSerializer) Response() PendingTxResponse {
+	txHash, _ := p.tx.Hash()
+	return PendingTxResponse{
+		Hash:    models.Hash(txHash),
+		From:    p.tx.From,
+		To:      p.tx.To,
+		Value:   p.tx.Value,
+		Fee:     p.tx.Fee,
+		Nonce:   p.tx.Nonce,
+		Reason:  p.tx.Reason,
+		Time:    p.tx.Time,
+		ChainId: p.tx.ChainId,
+	}
+}
+
+// balances
+type BalancesSerializer struct {
+	blockDB  models.BlockDB
+	balances map[models.Account]uint
+}
+
+type BalanceResponse struct {
+	Account models.Account `json:"account"`
+	Balance uint           `json:"balance"`
+}
+
+type BalancesResponse struct {
+	BlockHash   models.Hash       `json:"block_hash"`
+	BlockHeight uint64            `json:"block_height"`
+	Balances    []BalanceResponse `json:"balances"`
+}
+
+func (b *BalancesSerializer) Response() BalancesResponse {
+	balances := make([]BalanceResponse, 0, len(b.balances))
+	for account, balance := range b.balances {
+		balances = append(balances, BalanceResponse{Account: account, Balance: balance})
+	}
+	// same order for every message
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Account < balances[j].Account
+	})
+
+	return BalancesResponse{
+		BlockHash:   b.blockDB.Hash,
+		BlockHeight: b.blockDB.Block.Header.Height,
+		Balances:    balances,
+	}
+}
@@ -15,6 +15,9 @@ type ApiConf struct {
 			AllowedMethods []string `env:"SBQ_SERVER_HTTP_CORS_ALLOWED_METHODS,required" envSeparator:","`
 			AllowedHeaders []string `env:"SBQ_SERVER_HTTP_CORS_ALLOWED_HEADERS,required" envSeparator:","`
 		}
+		Websocket struct {
+			AllowedOrigins []string `env:"SBQ_SERVER_WEBSOCKET_ALLOWED_ORIGINS" envSeparator:","`
+		}
 	}
 	Domains struct {
 		ToStart []string `env:"SBQ_DOMAINS_TO_START,required" envSeparator:","`
@@ -39,12 +42,26 @@ type ApiConf struct {
 				JkmsRefreshCacheTimeoutInSec   int    `env:"SBQ_JWT_JKMS_REFRESH_CACHE_TIMEOUT_IN_SEC,required"`
 			}
 		}
+		// the endpoints reserved to the operators of the node are disabled without token
+		OperatorToken string `env:"SBQ_OPERATOR_TOKEN"`
 	}
 	Consensus struct {
+		Engine                          string `env:"SBQ_CONSENSUS_ENGINE" envDefault:"pow"`
 		Complexity                      uint32 `env:"SBQ_CONSENSUS_COMPLEXITY,required"`
 		CreateNewBlockIntervalInSeconds uint32 `env:"SBQ_CONSENSUS_CREATE_NEW_BLOCK_INTERVAL_IN_SEC,required"`
+		SignerPasswordFilePath          string `env:"SBQ_CONSENSUS_SIGNER_PASSWORD_FILE_PATH"`
+	}
+	Mempool struct {
+		MaxSize         uint   `env:"SBQ_MEMPOOL_MAX_SIZE" envDefault:"5000"`
+		MaxTxsPerSender uint   `env:"SBQ_MEMPOOL_MAX_TXS_PER_SENDER" envDefault:"64"`
+		TxTtlInSeconds  uint64 `env:"SBQ_MEMPOOL_TX_TTL_IN_SEC" envDefault:"3600"`
+		EvictionPolicy  string `env:"SBQ_MEMPOOL_EVICTION_POLICY" envDefault:"lowest_fee"`
 	}
 	Synchronisation struct {
 		RefreshIntervalInSeconds uint32 `env:"SBQ_SYNCHRONISATION_INTERVAL_IN_SEC,required"`
 	}
+	Network struct {
+		Transport string `env:"SBQ_NETWORK_TRANSPORT" envDefault:"http"`
+		GrpcPort  uint64 `env:"SBQ_NETWORK_GRPC_PORT" envDefault:"0"`
+	}
 }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,24 +18,30 @@ import (
 	"github.com/v4lproik/simple-blockchain-quickstart/common/middleware"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/models"
 	"github.com/v4lproik/simple-blockchain-quickstart/common/services"
+	"github.com/v4lproik/simple-blockchain-quickstart/domains/accounts"
 	"github.com/v4lproik/simple-blockchain-quickstart/domains/auth"
 	"github.com/v4lproik/simple-blockchain-quickstart/domains/balances"
+	"github.com/v4lproik/simple-blockchain-quickstart/domains/blocks"
 	"github.com/v4lproik/simple-blockchain-quickstart/domains/healthz"
 	"github.com/v4lproik/simple-blockchain-quickstart/domains/nodes"
 	"github.com/v4lproik/simple-blockchain-quickstart/domains/transactions"
 	"github.com/v4lproik/simple-blockchain-quickstart/domains/wallets"
+	"github.com/v4lproik/simple-blockchain-quickstart/domains/websockets"
 	Logger "github.com/v4lproik/simple-blockchain-quickstart/log"
 )
 
 type Domain string
 
 const (
+	ACCOUNTS     Domain = "ACCOUNTS"
 	AUTH         Domain = "AUTH"
 	BALANCES     Domain = "BALANCES"
+	BLOCKS       Domain = "BLOCKS"
 	HEALTHZ      Domain = "HEALTHZ"
 	NODES        Domain = "NODES"
 	TRANSACTIONS Domain = "TRANSACTIONS"
 	WALLETS      Domain = "WALLETS"
+	WEBSOCKETS   Domain = "WEBSOCKETS"
 )
 
 var apiConf = ApiConf{}
@@ -92,16 +99,45 @@ func runHttpServer() {
 }
 
 func bindFunctionalDomains(r *gin.Engine) {
+	// the state and the block service share the storage, a bolt database can only be opened once
+	storage, err := models.NewStorage(opts.StorageBackend, opts.TransactionsFilePath)
+	if err != nil {
+		Logger.Fatalf("bindFunctionalDomains: cannot open the storage: %s", err)
+	}
+	keystoreService, err := services.NewEthKeystore(opts.KeystoreDirPath)
+	if err != nil {
+		Logger.Fatalf("bindFunctionalDomains: cannot create keystore service: %s", err)
+	}
+	engine, err := newConsensusEngine(keystoreService)
+	if err != nil {
+		Logger.Fatalf("bindFunctionalDomains: cannot create the consensus engine: %s", err)
+	}
 	// TODO: extract business logic and put it in a state service
-	state, err := models.NewStateFromFile(opts.GenesisFilePath, opts.TransactionsFilePath)
+	newState := models.NewStateFromStorage
+	if opts.VerifyChain {
+		newState = models.NewVerifiedStateFromStorage
+	}
+	state, err := newState(
+		opts.GenesisFilePath,
+		storage,
+		engine,
+	)
 	if err != nil {
 		Logger.Fatalf("bindFunctionalDomains: cannot initialise the state: %s", err)
 	}
 	// initiate services
-	fileTransactionService := services.NewFileTransactionService()
-	keystoreService, err := services.NewEthKeystore(opts.KeystoreDirPath)
+	mempoolOpts := apiConf.Mempool
+	fileTransactionService, err := services.NewFileTransactionService(
+		state,
+		services.NewMempoolConf(
+			mempoolOpts.MaxSize,
+			mempoolOpts.MaxTxsPerSender,
+			mempoolOpts.TxTtlInSeconds,
+			mempoolOpts.EvictionPolicy,
+		),
+	)
 	if err != nil {
-		Logger.Fatalf("bindFunctionalDomains: cannot create keystore service: %s", err)
+		Logger.Fatalf("bindFunctionalDomains: cannot create transaction service: %s", err)
 	}
 	jwtOpts := apiConf.Auth.Jwt
 	jwtService, err := services.NewJwtService(
@@ -134,28 +170,30 @@ func bindFunctionalDomains(r *gin.Engine) {
 	if err != nil {
 		Logger.Fatalf("bindFunctionalDomains: cannot create node service: %s", err)
 	}
-
-	miningAccount, _ := models.NewAccount(opts.MinerAddress)
-	blockService, err := services.NewFileBlockService(
-		opts.TransactionsFilePath,
-		apiConf.Consensus.Complexity,
-		miningAccount,
-	)
+	nodeIdentity, err := nodes.LoadOrCreateNodeIdentity(opts.IdentityKeyFilePath)
 	if err != nil {
-		Logger.Fatalf("bindFunctionalDomains: cannot create block service: %s", err)
+		Logger.Fatalf("bindFunctionalDomains: cannot load node identity: %s", err)
 	}
 
+	miningAccount, _ := models.NewAccount(opts.MinerAddress)
+	blockService := services.NewStorageBlockService(storage, miningAccount, engine)
+
 	// initiate middlewares
 	auto401 := apiConf.Auth.IsAuthenticationActivated
 	authMiddleware := middleware.AuthWebSessionMiddleware(auto401, jwtService)
+	operatorMiddleware := middleware.OperatorMiddleware(apiConf.Auth.OperatorToken)
 
 	// run domains
 	for _, domain := range apiConf.Domains.ToStart {
 		switch Domain(domain) {
+		case ACCOUNTS:
+			accounts.RunDomain(r, state, fileTransactionService, authMiddleware)
 		case AUTH:
 			auth.RunDomain(r, jwtService, &passwordService, userService, apiConf.Auth.IsJwksEndpointActivated)
 		case BALANCES:
 			balances.RunDomain(r, balances.NewBalancesEnv(state), authMiddleware)
+		case BLOCKS:
+			blocks.RunDomain(r, state, authMiddleware)
 		case HEALTHZ:
 			healthz.RunDomain(r)
 		case NODES:
@@ -167,21 +205,70 @@ func bindFunctionalDomains(r *gin.Engine) {
 				blockService,
 				apiConf.Synchronisation.RefreshIntervalInSeconds,
 				apiConf.Consensus.CreateNewBlockIntervalInSeconds,
+				nodes.NewNetworkNodeAddress(apiConf.Server.Address, uint64(apiConf.Server.Port)),
+				nodeIdentity,
+				nodes.NewTransportConf(apiConf.Network.Transport, apiConf.Network.GrpcPort),
+				operatorMiddleware,
 			); err != nil {
 				Logger.Fatalf("bindFunctionalDomains: cannot start the node domain: %w", err)
 			}
 		case TRANSACTIONS:
-			transactions.RunDomain(r, state, fileTransactionService, authMiddleware)
+			transactions.RunDomain(r, state, fileTransactionService, operatorMiddleware, authMiddleware)
 		case WALLETS:
 			wallets.RunDomain(r, &wallets.WalletsEnv{
 				Keystore: keystoreService,
 			}, authMiddleware)
+		case WEBSOCKETS:
+			websockets.RunDomain(r, state, fileTransactionService, apiConf.Server.Websocket.AllowedOrigins, authMiddleware)
 		default:
 			Logger.Fatalf("bindFunctionalDomains: the functional domain %s is unknown", domain)
 		}
 	}
 }
 
+// newConsensusEngine creates the engine of the configuration, the poa engine seals the blocks with the unlocked
+// keystore account of the miner
+func newConsensusEngine(keystoreService *services.EthKeystoreService) (models.Engine, error) {
+	consensusOpts := apiConf.Consensus
+	switch consensusOpts.Engine {
+	case models.POW_ENGINE:
+		return models.NewProofOfWork(
+			models.NewDifficulty(consensusOpts.Complexity, consensusOpts.CreateNewBlockIntervalInSeconds),
+		), nil
+	case models.POA_ENGINE:
+		genesis, err := models.ReadGenesisFile(opts.GenesisFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("newConsensusEngine: %w", err)
+		}
+		signers, err := genesis.SignerAccounts()
+		if err != nil {
+			return nil, fmt.Errorf("newConsensusEngine: %w", err)
+		}
+		engine, err := models.NewProofOfAuthority(signers)
+		if err != nil {
+			return nil, fmt.Errorf("newConsensusEngine: %w", err)
+		}
+
+		// without password the node follows the chain without sealing any block
+		if consensusOpts.SignerPasswordFilePath == "" {
+			Logger.Warnf("newConsensusEngine: no signer password file, this node won't seal any block")
+			return engine, nil
+		}
+		password, err := os.ReadFile(consensusOpts.SignerPasswordFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("newConsensusEngine: cannot read the signer password file: %w", err)
+		}
+		miningAccount, _ := models.NewAccount(opts.MinerAddress)
+		if err = keystoreService.Unlock(miningAccount, strings.TrimRight(string(password), "\r\n")); err != nil {
+			return nil, fmt.Errorf("newConsensusEngine: %w", err)
+		}
+		engine.Authorize(keystoreService.SignHash)
+		return engine, nil
+	default:
+		return nil, fmt.Errorf("newConsensusEngine: %s: %w", consensusOpts.Engine, models.ErrUnknownEngine)
+	}
+}
+
 func gracefullyShutdownServer(ctx context.Context, server *http.Server) {
 	<-ctx.Done()
 	Logger.Infof("runHttpServer: trying to gracefully close http server...")
@@ -17,6 +17,8 @@ var (
 	BlocksFilePath       = "../../test/testdata/blocks_test.db"
 	EmptyBlocksFilePath  = "../../test/testdata/blocks_empty.db"
 	KeystoreDirPath      = "../../test/testdata/keystore/"
+	NodesFilePath        = "../../test/testdata/network_nodes_test.toml"
+	ChainId              = "simple-blockchain-quickstart"
 
 	// functions that are used to verify whether a test is valid or not
 	StandardHttpValidationFunc = func(wCodeE int, wCodeA int, testName string, wBodyE string, wBodyA string, asserts *assert.Assertions) {